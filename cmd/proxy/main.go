@@ -1,39 +1,92 @@
 package main
 
 import (
+	"context"
+	"io"
 	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/openshift/elasticsearch-proxy/pkg/config"
 	auth "github.com/openshift/elasticsearch-proxy/pkg/handlers/authorization"
+	"github.com/openshift/elasticsearch-proxy/pkg/handlers/bulk"
+	"github.com/openshift/elasticsearch-proxy/pkg/handlers/documents"
+	"github.com/openshift/elasticsearch-proxy/pkg/handlers/indices"
+	"github.com/openshift/elasticsearch-proxy/pkg/handlers/kibana"
 	"github.com/openshift/elasticsearch-proxy/pkg/handlers/logging"
+	"github.com/openshift/elasticsearch-proxy/pkg/handlers/policy"
+	"github.com/openshift/elasticsearch-proxy/pkg/handlers/webhook"
 
 	"github.com/openshift/elasticsearch-proxy/pkg/proxy"
+	"github.com/openshift/elasticsearch-proxy/pkg/tracing"
+	"github.com/openshift/elasticsearch-proxy/pkg/util"
+	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
 )
 
 const (
 	serviceAccountTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	//tracingShutdownTimeout is the maximum duration to flush the pending spans on exit
+	tracingShutdownTimeout = time.Duration(5) * time.Second
 )
 
 func main() {
 	initLogging()
 
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "validate":
+			os.Exit(validate(os.Args[2:], os.Stdout, os.Stderr))
+		case "whoami":
+			os.Exit(whoami(os.Args[2:], os.Stdin, os.Stdout, os.Stderr))
+		}
+	}
+
 	opts, err := config.Init(os.Args[1:])
 	if err != nil {
 		log.Errorf("%s", err)
 		os.Exit(1)
 	}
+	if opts.DryRun {
+		os.Exit(report(opts, os.Stdout, os.Stderr))
+	}
+	if opts.LogFormat == config.LogFormatJSON {
+		log.SetFormatter(&log.JSONFormatter{})
+	}
+	util.SetSensitiveHeaders(opts.LogRedactHeaders)
+	shutdownTracing, err := tracing.Init(opts)
+	if err != nil {
+		log.Errorf("%s", err)
+		os.Exit(1)
+	}
 
 	proxyServer := proxy.NewProxyServer(opts)
 
 	log.Debugf("Registering Handlers....")
 	proxyServer.RegisterRequestHandlers(auth.NewHandlers(opts))
+	proxyServer.RegisterRequestHandlers(policy.NewHandlers(opts))
+	proxyServer.RegisterRequestHandlers(kibana.NewHandlers(opts))
+	proxyServer.RegisterRequestHandlers(indices.NewHandlers(opts))
+	proxyServer.RegisterRequestHandlers(bulk.NewHandlers(opts))
+	proxyServer.RegisterRequestHandlers(documents.NewHandlers(opts))
+	proxyServer.RegisterRequestHandlers(webhook.NewHandlers(opts))
 
 	var h http.Handler = proxyServer
-	if opts.RequestLogging {
-		h = logging.NewHandler(os.Stdout, h, true)
+	if opts.RequestLogging || opts.RequestLoggingFile != "" {
+		format, err := logging.NewFormatter(opts.RequestLoggingFormat)
+		if err != nil {
+			log.Errorf("Invalid request-logging-format: %v", err)
+			os.Exit(1)
+		}
+		out, err := requestLogOutput(opts)
+		if err != nil {
+			log.Errorf("Unable to open request-logging-file: %v", err)
+			os.Exit(1)
+		}
+		h = logging.NewHandler(out, h, true, format)
 	}
 	s := &proxy.Server{
 		Handler: h,
@@ -43,12 +96,63 @@ func main() {
 
 	if opts.MetricsListeningAddress != "" {
 		m := proxy.MetricsServer{
-			Handler: h,
+			Handler: proxyServer.AdminHandler(h),
 			Opts:    opts,
 		}
 		go m.ListenAndServe()
 	}
-	select {}
+
+	reloader := config.NewReloader(os.Args[1:], opts.ConfigFile, proxyServer.Reload, prometheus.DefaultRegisterer)
+	reloader.Run(terminated())
+
+	ctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+	defer cancel()
+	if err := shutdownTracing(ctx); err != nil {
+		log.Errorf("Unable to flush the pending spans: %v", err)
+	}
+}
+
+// terminated returns a channel closed when the proxy is asked to stop by SIGTERM or SIGINT
+func terminated() <-chan struct{} {
+	stop := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		sig := <-signals
+		log.Infof("Received %s, shutting down", sig)
+		close(stop)
+	}()
+	return stop
+}
+
+// requestLogOutput returns where requests are logged. The request-logging-file is reopened on
+// SIGUSR1 so it can be rotated by external tools
+func requestLogOutput(opts *config.Options) (io.Writer, error) {
+	if opts.RequestLoggingFile == "" {
+		return os.Stdout, nil
+	}
+	file, err := logging.NewRotatingFile(opts.RequestLoggingFile,
+		int64(opts.RequestLoggingFileMaxSize)*1024*1024,
+		opts.RequestLoggingFileRotateInterval,
+		opts.RequestLoggingFileMaxBackups,
+		opts.RequestLoggingFileMaxAge)
+	if err != nil {
+		return nil, err
+	}
+	reopen := make(chan os.Signal, 1)
+	signal.Notify(reopen, syscall.SIGUSR1)
+	go func() {
+		for range reopen {
+			log.Infof("Reopening %s", opts.RequestLoggingFile)
+			if err := file.Reopen(); err != nil {
+				log.Errorf("Unable to reopen %s: %v", opts.RequestLoggingFile, err)
+			}
+		}
+	}()
+	if opts.RequestLoggingStdout {
+		return io.MultiWriter(file, os.Stdout), nil
+	}
+	return file, nil
 }
 
 func initLogging() {
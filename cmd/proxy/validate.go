@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/openshift/elasticsearch-proxy/pkg/config"
+)
+
+// validate resolves and validates the options given by args and reports on them. It
+// returns the exit code of the command
+func validate(args []string, stdout, stderr io.Writer) int {
+	opts, err := config.Init(args)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return report(opts, stdout, stderr)
+}
+
+// report checks the certificates referenced by the options and prints the effective
+// configuration with secrets redacted. It returns the exit code of the command
+func report(opts *config.Options, stdout, stderr io.Writer) int {
+	effective, err := yaml.Marshal(opts.Effective())
+	if err != nil {
+		fmt.Fprintf(stderr, "Unable to print the effective configuration: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "%s", effective)
+
+	if problems := opts.CheckFiles(time.Now()); len(problems) != 0 {
+		fmt.Fprintf(stderr, "Invalid configuration:\n  %s\n", strings.Join(problems, "\n  "))
+		return 1
+	}
+	fmt.Fprintln(stderr, "Configuration is valid")
+	return 0
+}
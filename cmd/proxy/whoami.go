@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/openshift/elasticsearch-proxy/pkg/clients"
+	"github.com/openshift/elasticsearch-proxy/pkg/config"
+	auth "github.com/openshift/elasticsearch-proxy/pkg/handlers/authorization"
+)
+
+// whoami reports what the token given by --token, or read from stdin, resolves to using the
+// options given by the remaining args. It returns the exit code of the command
+func whoami(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	token, args := extractToken(args)
+	if token == "" {
+		line, err := bufio.NewReader(stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			fmt.Fprintf(stderr, "Unable to read the token from stdin: %v\n", err)
+			return 1
+		}
+		token = strings.TrimSpace(line)
+	}
+	if token == "" {
+		fmt.Fprintln(stderr, "A token is required either by --token or on stdin")
+		return 1
+	}
+
+	opts, err := config.Init(args)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	client, err := clients.NewOpenShiftClient()
+	if err != nil {
+		fmt.Fprintf(stderr, "Error constructing OpenShiftClient %v\n", err)
+		return 1
+	}
+	report, err := auth.Whoami(opts, client, token)
+	if err != nil {
+		fmt.Fprintf(stderr, "Unable to resolve the token: %v\n", err)
+		return 1
+	}
+	printWhoami(report, stdout)
+	return 0
+}
+
+// extractToken removes --token from the args and returns its value
+func extractToken(args []string) (string, []string) {
+	token := ""
+	rest := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--token" || arg == "-token":
+			if i+1 < len(args) {
+				token = args[i+1]
+				i++
+			}
+		case strings.HasPrefix(arg, "--token="):
+			token = strings.TrimPrefix(arg, "--token=")
+		case strings.HasPrefix(arg, "-token="):
+			token = strings.TrimPrefix(arg, "-token=")
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	return token, rest
+}
+
+func printWhoami(report *auth.WhoamiReport, out io.Writer) {
+	fmt.Fprintf(out, "Username: %s\n", report.Username)
+	fmt.Fprintf(out, "Groups:   %s\n", strings.Join(report.Groups, ", "))
+	fmt.Fprintln(out, "SubjectAccessReviews:")
+	for _, sar := range report.SubjectAccessReviews {
+		result := "denied"
+		if sar.Error != nil {
+			result = fmt.Sprintf("error (%v)", sar.Error)
+		} else if sar.Allowed {
+			result = "allowed"
+		}
+		fmt.Fprintf(out, "  namespace=%q verb=%q resource=%q resourceAPIGroup=%q: %s\n",
+			sar.Namespace, sar.Verb, sar.Resource, sar.ResourceAPIGroup, result)
+	}
+	fmt.Fprintf(out, "Projects: %s\n", strings.Join(report.Projects, ", "))
+	fmt.Fprintf(out, "Roles:    %s\n", strings.Join(report.Roles, ", "))
+	fmt.Fprintln(out, "Headers:")
+	names := make([]string, 0, len(report.Headers))
+	for name := range report.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range report.Headers[name] {
+			fmt.Fprintf(out, "  %s: %s\n", name, value)
+		}
+	}
+}
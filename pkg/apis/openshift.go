@@ -3,6 +3,7 @@ package apis
 // Project is a simple representation of an OpeShift project
 type Project struct {
 	Name string
+	UID  string
 }
 
 // UserInfo is a simple representation of an OpenShift User
@@ -18,6 +18,8 @@ import (
 
 	osprojectv1 "github.com/openshift/api/project/v1"
 	projectv1client "github.com/openshift/client-go/project/clientset/versioned/typed/project/v1"
+
+	"github.com/openshift/elasticsearch-proxy/pkg/util"
 )
 
 // OpenShiftClient abstracts kubeclient and calls
@@ -33,6 +35,7 @@ type OpenShiftClient interface {
 // DefaultOpenShiftClient is the default impl of OpenShiftClient
 type DefaultOpenShiftClient struct {
 	client *kubernetes.Clientset
+	logger *log.Entry
 }
 
 // TokenReview is simple struct wrapper around a kubernetes TokenReview
@@ -50,6 +53,35 @@ func (t *TokenReview) Groups() []string {
 	return t.Status.User.Groups
 }
 
+// Extra returns the extra fields associated with a given token
+func (t *TokenReview) Extra() map[string][]string {
+	extra := map[string][]string{}
+	for key, values := range t.Status.User.Extra {
+		extra[key] = []string(values)
+	}
+	return extra
+}
+
+// Redacted returns a copy of the review without the reviewed token which is safe to log
+func (t *TokenReview) Redacted() *TokenReview {
+	if t == nil || t.TokenReview == nil {
+		return t
+	}
+	review := t.TokenReview.DeepCopy()
+	if review.Spec.Token != "" {
+		review.Spec.Token = util.Redacted
+	}
+	return &TokenReview{review}
+}
+
+// String formats the review without the reviewed token
+func (t *TokenReview) String() string {
+	if t == nil || t.TokenReview == nil {
+		return "<nil>"
+	}
+	return t.Redacted().TokenReview.String()
+}
+
 // Namespace wrappers a core kube namespace type
 type Namespace struct {
 	Ns osprojectv1.Project
@@ -60,6 +92,11 @@ func (ns *Namespace) Name() string {
 	return ns.Ns.Name
 }
 
+// UID get the uid of a namespace
+func (ns *Namespace) UID() string {
+	return string(ns.Ns.UID)
+}
+
 // ListNamespaces associated with a given token
 func (c *DefaultOpenShiftClient) ListNamespaces(token string) (namespaces []Namespace, err error) {
 	if len(token) == 0 {
@@ -84,7 +121,7 @@ func (c *DefaultOpenShiftClient) ListNamespaces(token string) (namespaces []Name
 	if err != nil {
 		return nil, err
 	}
-	log.Debugf("Fetched projects: %v", projects)
+	c.logger.WithField("count", len(projects.Items)).Debug("Fetched projects")
 	for _, ns := range projects.Items {
 		namespaces = append(namespaces, Namespace{ns})
 	}
@@ -94,7 +131,7 @@ func (c *DefaultOpenShiftClient) ListNamespaces(token string) (namespaces []Name
 // TokenReview performs a tokenreview for a given token submitting to the apiserver
 // using the serviceaccount token. It returns a simplejson object of the response
 func (c *DefaultOpenShiftClient) TokenReview(token string) (*TokenReview, error) {
-	log.Debug("Performing TokenReview...")
+	c.logger.Debug("Performing TokenReview...")
 	review := &authenticationapi.TokenReview{
 		Spec: authenticationapi.TokenReviewSpec{
 			Token: token,
@@ -109,7 +146,12 @@ func (c *DefaultOpenShiftClient) TokenReview(token string) (*TokenReview, error)
 
 // SubjectAccessReview performs a SAR and returns true if the user is allowed
 func (c *DefaultOpenShiftClient) SubjectAccessReview(groups []string, user, namespace, verb, resource, resourceAPIGroup string) (bool, error) {
-	log.Debug("Performing SubjectAccessReview...")
+	c.logger.WithFields(log.Fields{
+		"user":      user,
+		"namespace": namespace,
+		"verb":      verb,
+		"resource":  resource,
+	}).Debug("Performing SubjectAccessReview...")
 	sar := &authorizationapi.SubjectAccessReview{
 		Spec: authorizationapi.SubjectAccessReviewSpec{
 			User:   user,
@@ -148,8 +190,9 @@ func NewOpenShiftClient() (OpenShiftClient, error) {
 		return nil, fmt.Errorf("failed to create kubernetes client: %v", err)
 	}
 
-	log.Tracef("Creating new OpenShift client %v", config.Host)
-	return &DefaultOpenShiftClient{client: clientset}, nil
+	logger := log.WithField("component", "openshift-client")
+	logger.Tracef("Creating new OpenShift client %v", config.Host)
+	return &DefaultOpenShiftClient{client: clientset, logger: logger}, nil
 }
 
 func getConfig() (*rest.Config, error) {
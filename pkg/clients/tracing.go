@@ -0,0 +1,67 @@
+package clients
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/openshift/elasticsearch-proxy/pkg/tracing"
+)
+
+// tracingClient records a span for each call of the OpenShiftClient as a child of the span
+// in its context. Tokens are never recorded
+type tracingClient struct {
+	ctx    context.Context
+	client OpenShiftClient
+}
+
+// WithTracing returns a client which records the calls to the client as spans of the
+// trace in the context
+func WithTracing(ctx context.Context, client OpenShiftClient) OpenShiftClient {
+	return &tracingClient{ctx: ctx, client: client}
+}
+
+func (c *tracingClient) start(name string, attrs ...attribute.KeyValue) trace.Span {
+	_, span := tracing.Tracer().Start(c.ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	return span
+}
+
+func end(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func (c *tracingClient) ListNamespaces(token string) ([]Namespace, error) {
+	span := c.start("ListNamespaces")
+	namespaces, err := c.client.ListNamespaces(token)
+	span.SetAttributes(attribute.Int("namespaces", len(namespaces)))
+	end(span, err)
+	return namespaces, err
+}
+
+func (c *tracingClient) TokenReview(token string) (*TokenReview, error) {
+	span := c.start("TokenReview")
+	review, err := c.client.TokenReview(token)
+	if err == nil && review != nil && review.TokenReview != nil {
+		span.SetAttributes(attribute.Bool("authenticated", review.Status.Authenticated))
+	}
+	end(span, err)
+	return review, err
+}
+
+func (c *tracingClient) SubjectAccessReview(groups []string, user, namespace, verb, resource, resourceAPIGroup string) (bool, error) {
+	span := c.start("SubjectAccessReview",
+		attribute.String("namespace", namespace),
+		attribute.String("verb", verb),
+		attribute.String("resource", resource),
+	)
+	allowed, err := c.client.SubjectAccessReview(groups, user, namespace, verb, resource, resourceAPIGroup)
+	span.SetAttributes(attribute.Bool("allowed", allowed))
+	end(span, err)
+	return allowed, err
+}
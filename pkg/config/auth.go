@@ -2,6 +2,8 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
+	"path"
 )
 
 type AuthConfig struct {
@@ -9,12 +11,69 @@ type AuthConfig struct {
 	AuthBackEndRoles   map[string]BackendRoleConfig
 }
 
-// BackendRoleConfig is for executing a SAR against the API server
+// BackendRoleConfig is for executing a SAR against the API server. The SAR may be combined
+// with checks of the user's groups and name as well as other rules. A role is given to a
+// user when every condition that is defined holds
 type BackendRoleConfig struct {
 	Namespace        string `json:"namespace,omitempty"`
 	Verb             string `json:"verb,omitempty"`
 	Resource         string `json:"resource,omitempty"`
 	ResourceAPIGroup string `json:"resourceAPIGroup,omitempty"`
+
+	//Groups holds when the user is a member of any of the groups
+	Groups []string `json:"groups,omitempty"`
+	//Usernames holds when the user's name matches any of the patterns (i.e. system:serviceaccount:openshift-logging:*)
+	Usernames []string `json:"usernames,omitempty"`
+
+	//AnyOf holds when at least one of the rules holds
+	AnyOf []BackendRoleConfig `json:"anyOf,omitempty"`
+	//AllOf holds when every rule holds
+	AllOf []BackendRoleConfig `json:"allOf,omitempty"`
+
+	//Expression is a CEL expression evaluated against the user's Identity. It is only
+	//supported on the top level rule of a backend role
+	Expression string `json:"expression,omitempty"`
+}
+
+// HasSAR returns true if the SubjectAccessReview of the rule is to be evaluated. A rule
+// without any other condition is evaluated as a SAR
+func (c *BackendRoleConfig) HasSAR() bool {
+	if c.Namespace != "" || c.Verb != "" || c.Resource != "" || c.ResourceAPIGroup != "" {
+		return true
+	}
+	return len(c.Groups) == 0 && len(c.Usernames) == 0 && len(c.AnyOf) == 0 && len(c.AllOf) == 0 && c.Expression == ""
+}
+
+// IsExpressionOnly returns true if the expression is the only condition of the rule
+func (c *BackendRoleConfig) IsExpressionOnly() bool {
+	return c.Expression != "" && !c.HasSAR() && len(c.Groups) == 0 && len(c.Usernames) == 0 && len(c.AnyOf) == 0 && len(c.AllOf) == 0
+}
+
+// Validate the rule and any of its nested rules
+func (c *BackendRoleConfig) Validate() error {
+	for _, pattern := range c.Usernames {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid username pattern %q: %v", pattern, err)
+		}
+	}
+	for i := range c.AnyOf {
+		if err := c.AnyOf[i].validateNested(); err != nil {
+			return fmt.Errorf("anyOf[%d]: %v", i, err)
+		}
+	}
+	for i := range c.AllOf {
+		if err := c.AllOf[i].validateNested(); err != nil {
+			return fmt.Errorf("allOf[%d]: %v", i, err)
+		}
+	}
+	return nil
+}
+
+func (c *BackendRoleConfig) validateNested() error {
+	if c.Expression != "" {
+		return fmt.Errorf("expression is only supported on the top level rule")
+	}
+	return c.Validate()
 }
 
 func parseBackendRoleConfig(value string) (*BackendRoleConfig, error) {
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/openshift/elasticsearch-proxy/pkg/util"
+)
+
+const (
+	redacted = "REDACTED"
+)
+
+// CheckFiles loads every certificate file referenced by the options and returns the problems
+// found, such as unreadable CAs, certificates that do not match their keys or are expired at now
+func (o *Options) CheckFiles(now time.Time) []string {
+	msgs := make([]string, 0)
+
+	if o.TLSCertFile == "" || o.TLSKeyFile == "" {
+		msgs = append(msgs, "tls-cert and tls-key are required to listen on tls")
+	} else if err := checkKeyPair(o.TLSCertFile, o.TLSKeyFile, now); err != nil {
+		msgs = append(msgs, fmt.Sprintf("%s: %v", o.optionName("tls-cert"), err))
+	}
+	if o.MetricsTLSCertFile != "" && o.MetricsTLSKeyFile != "" {
+		if err := checkKeyPair(o.MetricsTLSCertFile, o.MetricsTLSKeyFile, now); err != nil {
+			msgs = append(msgs, fmt.Sprintf("%s: %v", o.optionName("metrics-tls-cert"), err))
+		}
+	}
+
+	if o.TLSClientCAFile != "" {
+		if _, err := util.GetCertPool([]string{o.TLSClientCAFile}, false); err != nil {
+			msgs = append(msgs, fmt.Sprintf("%s: %v", o.optionName("tls-client-ca"), err))
+		}
+	}
+	for flagName, paths := range map[string][]string{
+		"openshift-ca":    o.OpenShiftCAs,
+		"upstream-ca":     o.UpstreamCAs,
+		"auth-webhook-ca": o.AuthWebhookCAs,
+	} {
+		if len(paths) == 0 {
+			continue
+		}
+		if _, err := util.GetCertPool(paths, false); err != nil {
+			msgs = append(msgs, fmt.Sprintf("%s: %v", o.optionName(flagName), err))
+		}
+	}
+	return msgs
+}
+
+// checkKeyPair verifies the certificate matches the key and is valid at now
+func checkKeyPair(certFile, keyFile string, now time.Time) error {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return fmt.Errorf("unable to load certificate %q with key %q: %v", certFile, keyFile, err)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return fmt.Errorf("unable to parse certificate %q: %v", certFile, err)
+	}
+	if now.After(cert.NotAfter) {
+		return fmt.Errorf("certificate %q expired on %s", certFile, cert.NotAfter.UTC().Format(time.RFC3339))
+	}
+	if now.Before(cert.NotBefore) {
+		return fmt.Errorf("certificate %q is not valid before %s", certFile, cert.NotBefore.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// Effective returns the resolved options keyed by their config file name so they can be
+// printed or used as a config file. Credentials in URLs and secret options are redacted
+func (o *Options) Effective() map[string]interface{} {
+	effective := map[string]interface{}{}
+	val := reflect.ValueOf(o).Elem()
+	for name, field := range optionFields() {
+		switch name {
+		case "config", cfgName("dry-run"), cfgName("auth-backend-role"):
+			// the backend roles are given in their nested form below
+			continue
+		}
+		value := val.FieldByIndex(field.Index).Interface()
+		switch v := value.(type) {
+		case time.Duration:
+			value = v.String()
+		case string:
+			value = redactValue(name, v)
+		}
+		effective[name] = value
+	}
+	effective[backendRolesKey] = o.AuthBackEndRoles
+	return effective
+}
+
+func redactValue(name, value string) string {
+	if value == "" {
+		return value
+	}
+	for _, secret := range []string{"password", "secret", "token"} {
+		if strings.Contains(name, secret) {
+			return redacted
+		}
+	}
+	if u, err := url.Parse(value); err == nil && u.User != nil {
+		if _, hasPassword := u.User.Password(); hasPassword {
+			u.User = url.UserPassword(u.User.Username(), redacted)
+			return u.String()
+		}
+	}
+	return value
+}
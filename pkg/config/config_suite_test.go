@@ -1,6 +1,7 @@
 package config_test
 
 import (
+	"os"
 	"testing"
 
 	. "github.com/onsi/ginkgo"
@@ -11,3 +12,16 @@ func TestConfig(t *testing.T) {
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "Config Suite")
 }
+
+// testDir holds the files written by the tests
+var testDir string
+
+var _ = BeforeSuite(func() {
+	var err error
+	testDir, err = os.MkdirTemp("", "config-test")
+	Expect(err).To(BeNil())
+})
+
+var _ = AfterSuite(func() {
+	Expect(os.RemoveAll(testDir)).To(Succeed())
+})
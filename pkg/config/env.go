@@ -0,0 +1,62 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const (
+	// envPrefix is prepended to the upper cased flag name to form the environment variable of an option
+	envPrefix = "ESPROXY_"
+)
+
+// envName returns the environment variable for an option (i.e. cache-expiry => ESPROXY_CACHE_EXPIRY)
+func envName(name string) string {
+	return envPrefix + strings.ToUpper(cfgName(name))
+}
+
+// loadEnv returns the option values set in the environment keyed by config name. The values of
+// list options are given one per line so that values like auth-backend-role may contain commas
+func loadEnv(lookup func(string) (string, bool)) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	msgs := make([]string, 0)
+
+	fields := optionFields()
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		env := envName(name)
+		value, found := lookup(env)
+		if !found {
+			continue
+		}
+		var raw interface{} = value
+		if fields[name].Type.Kind() == reflect.Slice {
+			items := []interface{}{}
+			for _, line := range strings.Split(value, "\n") {
+				if line = strings.TrimSpace(line); line != "" {
+					items = append(items, line)
+				}
+			}
+			raw = items
+		}
+		normalized, err := normalizeValue(raw, fields[name].Type)
+		if err != nil {
+			msgs = append(msgs, fmt.Sprintf("%s: %v", env, err))
+			continue
+		}
+		values[name] = normalized
+	}
+
+	if len(msgs) != 0 {
+		return nil, fmt.Errorf("Invalid configuration:\n  %s",
+			strings.Join(msgs, "\n  "))
+	}
+	return values, nil
+}
@@ -0,0 +1,92 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/google/cel-go/cel"
+)
+
+// Identity is the reviewed identity of a user that role expressions are evaluated against
+type Identity struct {
+	//Username from the TokenReview
+	Username string
+	//Groups from the TokenReview
+	Groups []string
+	//Extra fields from the TokenReview
+	Extra map[string][]string
+	//Subject of the client certificate in RFC 2253 Distinguished Names syntax
+	Subject string
+	//ProjectCount is the number of projects the user may access
+	ProjectCount int
+}
+
+// RoleExpression is a compiled CEL expression which gives a backend role to the
+// identities for which it evaluates to true
+type RoleExpression struct {
+	source  string
+	program cel.Program
+}
+
+// newExpressionEnv declares the variables available to role expressions
+func newExpressionEnv() (*cel.Env, error) {
+	return cel.NewEnv(
+		cel.Variable("username", cel.StringType),
+		cel.Variable("groups", cel.ListType(cel.StringType)),
+		cel.Variable("extra", cel.MapType(cel.StringType, cel.ListType(cel.StringType))),
+		cel.Variable("subject", cel.StringType),
+		cel.Variable("projectCount", cel.IntType),
+	)
+}
+
+// CompileRoleExpression parses and type checks a role expression which must evaluate to a bool
+// (i.e. "'logging-admins' in groups && projectCount > 0")
+func CompileRoleExpression(source string) (*RoleExpression, error) {
+	env, err := newExpressionEnv()
+	if err != nil {
+		return nil, err
+	}
+	ast, issues := env.Compile(source)
+	if issues != nil && issues.Err() != nil {
+		return nil, issues.Err()
+	}
+	if !cel.BoolType.IsAssignableType(ast.OutputType()) {
+		return nil, fmt.Errorf("expression must evaluate to a bool but evaluates to %v", ast.OutputType())
+	}
+	program, err := env.Program(ast)
+	if err != nil {
+		return nil, err
+	}
+	return &RoleExpression{source: source, program: program}, nil
+}
+
+// String returns the source of the expression
+func (e *RoleExpression) String() string {
+	return e.source
+}
+
+// Evaluate returns true if the expression holds for the identity
+func (e *RoleExpression) Evaluate(identity Identity) (bool, error) {
+	groups := identity.Groups
+	if groups == nil {
+		groups = []string{}
+	}
+	extra := identity.Extra
+	if extra == nil {
+		extra = map[string][]string{}
+	}
+	result, _, err := e.program.Eval(map[string]interface{}{
+		"username":     identity.Username,
+		"groups":       groups,
+		"extra":        extra,
+		"subject":      identity.Subject,
+		"projectCount": identity.ProjectCount,
+	})
+	if err != nil {
+		return false, fmt.Errorf("evaluating %q: %v", e.source, err)
+	}
+	allowed, ok := result.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("evaluating %q: expected a bool but got %v", e.source, result.Type())
+	}
+	return allowed, nil
+}
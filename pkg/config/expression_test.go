@@ -0,0 +1,58 @@
+package config_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"github.com/openshift/elasticsearch-proxy/pkg/config"
+)
+
+var _ = Describe("Role expressions", func() {
+
+	identity := config.Identity{
+		Username:     "jdoe",
+		Groups:       []string{"developers", "logging-admins"},
+		Extra:        map[string][]string{"scopes.authorization.openshift.io": {"user:full"}},
+		Subject:      "CN=jdoe,O=org",
+		ProjectCount: 3,
+	}
+
+	DescribeTable("when evaluating against an identity",
+		func(source string, exp bool) {
+			expression, err := config.CompileRoleExpression(source)
+			Expect(err).To(BeNil())
+			Expect(expression.Evaluate(identity)).To(Equal(exp))
+		},
+		Entry("username", `username == "jdoe"`, true),
+		Entry("groups", `"logging-admins" in groups`, true),
+		Entry("extra", `"user:full" in extra["scopes.authorization.openshift.io"]`, true),
+		Entry("missing extra", `"scopes" in extra && "user:full" in extra["scopes"]`, false),
+		Entry("subject", `subject.endsWith("O=org")`, true),
+		Entry("project count", `projectCount > 5`, false),
+		Entry("combination", `username.startsWith("system:") || ("developers" in groups && projectCount >= 3)`, true),
+	)
+
+	Context("when the identity has no groups or extra fields", func() {
+		It("should evaluate them as empty", func() {
+			expression, err := config.CompileRoleExpression(`size(groups) == 0 && size(extra) == 0`)
+			Expect(err).To(BeNil())
+			Expect(expression.Evaluate(config.Identity{})).To(BeTrue())
+		})
+	})
+
+	Context("when compiling an invalid expression", func() {
+		It("should report undeclared references", func() {
+			_, err := config.CompileRoleExpression(`user == "jdoe"`)
+			Expect(err).To(MatchError(ContainSubstring("undeclared reference to 'user'")))
+		})
+		It("should report type errors", func() {
+			_, err := config.CompileRoleExpression(`projectCount == "3"`)
+			Expect(err).To(MatchError(ContainSubstring("found no matching overload for '_==_'")))
+		})
+		It("should report expressions which do not evaluate to a bool", func() {
+			_, err := config.CompileRoleExpression(`projectCount + 1`)
+			Expect(err).To(MatchError("expression must evaluate to a bool but evaluates to int"))
+		})
+	})
+})
@@ -0,0 +1,204 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// backendRolesKey is the config file key for the nested form of auth-backend-role
+	backendRolesKey = "auth_backend_roles"
+)
+
+// fileConfig holds the values read from a configuration file keyed by
+// option name (i.e. the flag name with underscores instead of dashes)
+type fileConfig struct {
+	path         string
+	values       map[string]interface{}
+	backendRoles map[string]BackendRoleConfig
+}
+
+// loadConfigFile reads a YAML or JSON configuration file and normalizes its values
+// so they can be resolved onto Options. Unknown keys and values that can not be
+// converted to the type of the option are reported citing the file and the key
+func loadConfigFile(path string) (*fileConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read config file %q: %v", path, err)
+	}
+	// YAML is a superset of JSON so both formats are handled by the conversion
+	data, err = yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse config file %q: %v", path, err)
+	}
+
+	raw := map[string]interface{}{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("unable to parse config file %q: %v", path, err)
+	}
+
+	cfg := &fileConfig{
+		path:   path,
+		values: map[string]interface{}{},
+	}
+	fields := optionFields()
+	msgs := make([]string, 0)
+
+	keys := make([]string, 0, len(raw))
+	for key := range raw {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		name := strings.Replace(key, "-", "_", -1)
+		value := raw[key]
+		if name == backendRolesKey {
+			roles, errs := parseBackendRoles(value)
+			for _, err := range errs {
+				msgs = append(msgs, fmt.Sprintf("%s: %s%s", path, backendRolesKey, err))
+			}
+			cfg.backendRoles = roles
+			continue
+		}
+		field, found := fields[name]
+		if !found || name == "config" {
+			msgs = append(msgs, fmt.Sprintf("%s: %s: unknown option", path, key))
+			continue
+		}
+		normalized, err := normalizeValue(value, field.Type)
+		if err != nil {
+			msgs = append(msgs, fmt.Sprintf("%s: %s: %v", path, key, err))
+			continue
+		}
+		cfg.values[name] = normalized
+	}
+
+	if len(msgs) != 0 {
+		return nil, fmt.Errorf("Invalid configuration:\n  %s",
+			strings.Join(msgs, "\n  "))
+	}
+	return cfg, nil
+}
+
+// optionFields returns the fields of Options that can be resolved from a
+// flag keyed by their config file name
+func optionFields() map[string]reflect.StructField {
+	fields := map[string]reflect.StructField{}
+	typ := reflect.TypeOf(Options{})
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		flagName := field.Tag.Get("flag")
+		if flagName == "" {
+			continue
+		}
+		fields[cfgName(flagName)] = field
+	}
+	return fields
+}
+
+func cfgName(flagName string) string {
+	return strings.Replace(flagName, "-", "_", -1)
+}
+
+// normalizeValue converts a decoded config file value into a form accepted by options.Resolve,
+// verifying it can be coerced into the given type
+func normalizeValue(value interface{}, typ reflect.Type) (interface{}, error) {
+	if typ.Kind() == reflect.Slice {
+		switch v := value.(type) {
+		case []interface{}:
+			values := make([]interface{}, 0, len(v))
+			for _, item := range v {
+				s, err := scalarString(item)
+				if err != nil {
+					return nil, err
+				}
+				values = append(values, s)
+			}
+			return values, nil
+		default:
+			s, err := scalarString(value)
+			if err != nil {
+				return nil, err
+			}
+			return []interface{}{s}, nil
+		}
+	}
+
+	s, err := scalarString(value)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case typ == reflect.TypeOf(time.Duration(0)):
+		if _, err := time.ParseDuration(s); err != nil {
+			return nil, fmt.Errorf("invalid duration %q", s)
+		}
+	case typ.Kind() == reflect.Bool:
+		if _, err := strconv.ParseBool(s); err != nil {
+			return nil, fmt.Errorf("invalid boolean %q", s)
+		}
+	case typ.Kind() == reflect.Int:
+		if _, err := strconv.Atoi(s); err != nil {
+			return nil, fmt.Errorf("invalid integer %q", s)
+		}
+	}
+	return s, nil
+}
+
+func scalarString(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case nil:
+		return "", nil
+	}
+	return "", fmt.Errorf("expected a scalar value but got %T", value)
+}
+
+// parseBackendRoles converts the nested form of the backend roles into their configs. Errors
+// are prefixed with the path of the offending key relative to the backend roles key
+func parseBackendRoles(value interface{}) (map[string]BackendRoleConfig, []string) {
+	raw, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, []string{fmt.Sprintf(": expected a map of role name to SAR but got %T", value)}
+	}
+	roles := map[string]BackendRoleConfig{}
+	errs := make([]string, 0)
+	names := make([]string, 0, len(raw))
+	for name := range raw {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		data, err := json.Marshal(raw[name])
+		if err != nil {
+			errs = append(errs, fmt.Sprintf(".%s: %v", name, err))
+			continue
+		}
+		roleConfig := BackendRoleConfig{}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&roleConfig); err != nil {
+			errs = append(errs, fmt.Sprintf(".%s: %v", name, err))
+			continue
+		}
+		roles[name] = roleConfig
+	}
+	return roles, errs
+}
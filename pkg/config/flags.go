@@ -10,6 +10,8 @@ import (
 func newFlagSet() *flag.FlagSet {
 	flagSet := flag.NewFlagSet("elasticsearch-proxy", flag.ExitOnError)
 
+	flagSet.String("config", "", "path to a YAML or JSON file of options keyed by flag name (i.e. cache_expiry). Flags and ESPROXY_* environment variables take precedence over values in the file")
+	flagSet.Bool("dry-run", false, "validate the configuration and referenced certificates, print the effective configuration and exit")
 	flagSet.String("listening-address", ":8443", "<addr>:<port> to listen on for HTTPS clients")
 
 	flagSet.String("tls-cert", "", "path to certificate file")
@@ -26,6 +28,22 @@ func newFlagSet() *flag.FlagSet {
 	flagSet.Bool("proxy-websockets", true, "enables WebSocket proxying")
 	flagSet.Var(&util.StringArray{}, "openshift-ca", "paths to CA roots for the OpenShift API (may be given multiple times, defaults to /var/run/secrets/kubernetes.io/serviceaccount/ca.crt).")
 	flagSet.Bool("request-logging", false, "Log requests to stdout")
+	flagSet.String("request-logging-file", "", "Log requests to this file instead of stdout. Implies request-logging")
+	flagSet.Bool("request-logging-stdout", false, "Log requests to stdout as well as to request-logging-file")
+	flagSet.Int("request-logging-file-max-size", 100, "The size in megabytes after which the request-logging-file is rotated. Zero disables size based rotation")
+	flagSet.Duration("request-logging-file-rotate-interval", 0, "The age after which the request-logging-file is rotated. Zero disables age based rotation")
+	flagSet.Int("request-logging-file-max-backups", 5, "The number of rotated request-logging-files retained. Zero retains every file")
+	flagSet.Duration("request-logging-file-max-age", time.Duration(7*24)*time.Hour, "The age after which rotated request-logging-files are removed. Zero retains every file")
+	flagSet.String("request-logging-format", "clf", "The format of the request log: clf, json or a Go template of the entry (i.e. '{{.User}} {{.Method}} {{.URI}} {{.Status}} {{.Roles}}')")
+	flagSet.String("request-id-header", "X-Opaque-Id", "The request header whose value is used as the request ID when trust-request-id is set")
+	flagSet.Bool("trust-request-id", false, "Use the request ID given by the client in request-id-header instead of generating one")
+	flagSet.Bool("opaque-id-username", false, "Prefix the X-Opaque-Id forwarded to Elasticsearch with the authenticated username (i.e. jdoe/<request ID>)")
+	flagSet.String("tracing-exporter", "none", "Where OpenTelemetry spans are exported to: none, otlp, stdout or file")
+	flagSet.String("tracing-endpoint", "", "The URL of the OTLP/HTTP collector spans are exported to (i.e. http://collector:4318)")
+	flagSet.String("tracing-file", "", "The file spans are written to by the file exporter")
+	flagSet.String("log-format", "text", "The format of the log output: text or json")
+	flagSet.Var(&util.StringArray{}, "log-redact-header", "A header whose values are redacted from logs in addition to Authorization, Cookie and the forwarded access token (may be given multiple times)")
+	flagSet.Duration("log-level-max-duration", time.Duration(1)*time.Hour, "The longest duration the log level may be changed for using the admin API of the metrics listener. Zero disables changing it")
 
 	flagSet.Duration("upstream-flush", time.Duration(5)*time.Millisecond, "force flush upstream responses after this duration(useful for streaming responses). 0 to never force flush. Defaults to 5ms")
 	flagSet.Var(&util.StringArray{}, "upstream-ca", "paths to CA roots for the Upstream (target) Server (may be given multiple times, defaults to system trust store).")
@@ -36,6 +54,23 @@ func newFlagSet() *flag.FlagSet {
 	flagSet.Var(&util.StringArray{}, "auth-whitelisted-name", "A name compared against cert CN for which a request will be passed through")
 	flagSet.String("auth-admin-role", "", "The name of the only role that will be passed on the request if it is found in the list of roles")
 	flagSet.String("auth-default-role", "", "The role given to every request unless it has the auth-admin-role")
+	flagSet.String("cache-admin-role", "", "The role required to inspect and evict cached identities using the admin API of the metrics listener. Defaults to auth-admin-role")
+	flagSet.Var(&util.StringArray{}, "auth-index-pattern", "The pattern of the indices of a project given its {namespace} and {uid}, i.e. app.{namespace}.* where the namespace is followed by a character namespaces can not contain or by {uid} (may be given multiple times). Users are denied indices of projects they can not access")
+	flagSet.Bool("auth-index-rewrite", false, "Rewrite searches of users for every index or patterns broader than their projects (i.e. _all or app-*) to the auth-index-patterns of their projects")
+	flagSet.String("auth-policy-file", "", "A YAML or JSON access policy allowing or denying requests by backend role, method and path")
+	flagSet.Var(&util.StringArray{}, "auth-certificate-index-pattern", "The pattern of the indices a certificate may write to in bulk requests given as <subject>:<pattern>, i.e. CN=collector,OU=logging:app-* (may be given multiple times). Certificates without patterns are not restricted")
+	flagSet.String("auth-bulk-deny-mode", "request", "Whether forbidden items of bulk requests reject the whole request or are each answered with an error: request or item")
+	flagSet.String("auth-namespace-field", "", "The field holding the namespace of documents (i.e. kubernetes.namespace_name). Searches of users are filtered to the documents of their projects")
+	flagSet.Int("auth-namespace-filter-max-body-size", 10, "The size in megabytes of the largest search body filtered by auth-namespace-field, or multi get body authorized by auth-index-pattern or rewritten for the Kibana index of users. Zero means no limit")
+	flagSet.String("auth-kibana-index-mode", "shared", "Whether users share the index of Kibana or each use their own, named by a hash of their username and created on first use: shared or user")
+	flagSet.Var(&util.StringArray{}, "auth-kibana-shared-role", "A backend role, i.e. of infra users, which keeps the shared index of Kibana when auth-kibana-index-mode is user (may be given multiple times). The auth-admin-role always does")
+
+	//Auth webhook flags
+	flagSet.String("auth-webhook-url", "", "The URL of a policy service to POST a description of each authenticated request to for a decision")
+	flagSet.Var(&util.StringArray{}, "auth-webhook-ca", "paths to CA roots for the auth webhook (may be given multiple times, defaults to system trust store).")
+	flagSet.Duration("auth-webhook-timeout", time.Duration(5)*time.Second, "The maximum duration to wait for a decision from the auth webhook")
+	flagSet.Duration("auth-webhook-cache-expiry", time.Duration(1)*time.Minute, "The duration a decision of the auth webhook is cached. Zero disables caching")
+	flagSet.Bool("auth-webhook-fail-open", false, "Allow requests when the auth webhook fails to decide instead of rejecting them")
 
 	//net/http.Server timeouts for the server side of the proxy
 	flagSet.Duration("http-read-timeout", time.Duration(1)*time.Minute, "The maximum duration for reading the entire HTTP request. Zero means no timeout.")
@@ -2,18 +2,45 @@ package config
 
 import (
 	"crypto/tls"
+	"flag"
 	"fmt"
 	"net/http"
 	"net/url"
+	"os"
+	"sort"
 	"strings"
+	"text/template"
 	"time"
 
 	options "github.com/mreiferson/go-options"
 	log "github.com/sirupsen/logrus"
+
+	"github.com/openshift/elasticsearch-proxy/pkg/elasticsearch"
+)
+
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+
+	TracingExporterNone   = "none"
+	TracingExporterOTLP   = "otlp"
+	TracingExporterStdout = "stdout"
+	TracingExporterFile   = "file"
+
+	BulkDenyRequest = "request"
+	BulkDenyItem    = "item"
+
+	KibanaIndexShared = "shared"
+	KibanaIndexUser   = "user"
 )
 
 // Options that can be set by Command Line Flag, or Config File
 type Options struct {
+	//ConfigFile is a YAML or JSON file of options. Values given as flags take precedence
+	ConfigFile string `flag:"config"`
+	//DryRun validates the configuration and exits instead of serving
+	DryRun bool `flag:"dry-run"`
+
 	ProxyWebSockets  bool     `flag:"proxy-websockets"`
 	ListeningAddress string   `flag:"listening-address"`
 	TLSCertFile      string   `flag:"tls-cert"`
@@ -32,6 +59,41 @@ type Options struct {
 
 	SSLInsecureSkipVerify bool `flag:"ssl-insecure-skip-verify"`
 	RequestLogging        bool `flag:"request-logging"`
+	//RequestLoggingFormat is the format of the access log: clf, json or a template
+	RequestLoggingFormat string `flag:"request-logging-format"`
+	//RequestLoggingFile is a file requests are logged to instead of stdout
+	RequestLoggingFile string `flag:"request-logging-file"`
+	//RequestLoggingStdout logs requests to stdout as well as to the RequestLoggingFile
+	RequestLoggingStdout bool `flag:"request-logging-stdout"`
+	//RequestLoggingFileMaxSize is the size in megabytes after which the file is rotated
+	RequestLoggingFileMaxSize int `flag:"request-logging-file-max-size"`
+	//RequestLoggingFileRotateInterval is the age after which the file is rotated
+	RequestLoggingFileRotateInterval time.Duration `flag:"request-logging-file-rotate-interval"`
+	//RequestLoggingFileMaxBackups is the number of rotated files retained
+	RequestLoggingFileMaxBackups int `flag:"request-logging-file-max-backups"`
+	//RequestLoggingFileMaxAge is the age after which rotated files are removed
+	RequestLoggingFileMaxAge time.Duration `flag:"request-logging-file-max-age"`
+
+	//LogFormat is the format of the log output, text or json
+	LogFormat string `flag:"log-format"`
+	//LogLevelMaxDuration is the longest the log level may be changed for using the admin API
+	LogLevelMaxDuration time.Duration `flag:"log-level-max-duration"`
+	//RequestIDHeader is the request header whose value is used as the request ID when trusted
+	RequestIDHeader string `flag:"request-id-header"`
+	//TrustRequestID uses the request ID given by the client instead of generating one
+	TrustRequestID bool `flag:"trust-request-id"`
+	//OpaqueIDUsername prefixes the X-Opaque-Id forwarded to Elasticsearch with the username
+	OpaqueIDUsername bool `flag:"opaque-id-username"`
+
+	//TracingExporter is where spans are exported to: none, otlp, stdout or file
+	TracingExporter string `flag:"tracing-exporter"`
+	//TracingEndpoint is the URL of the OTLP/HTTP collector (i.e. http://collector:4318)
+	TracingEndpoint string `flag:"tracing-endpoint"`
+	//TracingFile is the file spans are written to by the file exporter
+	TracingFile string `flag:"tracing-file"`
+
+	//LogRedactHeaders are redacted from logs in addition to the headers carrying credentials
+	LogRedactHeaders []string `flag:"log-redact-header"`
 
 	//Auth Handler Configs
 
@@ -41,7 +103,9 @@ type Options struct {
 
 	//AuthBackEndRoles is a map of rolename to SubjectAccessReviews to check to apply a given role to a user
 	AuthBackEndRoles map[string]BackendRoleConfig
-	CacheExpiry      time.Duration `flag:"cache-expiry"`
+	//AuthRoleExpressions is a map of rolename to the compiled expression of the role, if any
+	AuthRoleExpressions map[string]*RoleExpression
+	CacheExpiry         time.Duration `flag:"cache-expiry"`
 	//AuthWhiteListedNames  is the list of names compared against cert CN for which a request will be passed through
 	//with no additional processing
 	AuthWhiteListedNames []string `flag:"auth-whitelisted-name"`
@@ -53,6 +117,49 @@ type Options struct {
 	//AuthDefaultRole is the role added when no other roles are provided
 	AuthDefaultRole string `flag:"auth-default-role"`
 
+	//CacheAdminRole is the role required to use the cache admin API. Defaults to AuthAdminRole
+	CacheAdminRole string `flag:"cache-admin-role"`
+
+	//AuthPolicyFile is an access policy allowing or denying requests by role, method and path
+	AuthPolicyFile string `flag:"auth-policy-file"`
+	//AuthPolicy is the access policy read from AuthPolicyFile, if any
+	AuthPolicy *AccessPolicy
+
+	//AuthIndexPatterns name the indices of a project by its namespace and uid (i.e. app.{namespace}.*).
+	//Requests of users for indices of other projects are rejected when given
+	AuthIndexPatterns []string `flag:"auth-index-pattern"`
+	//AuthIndexRewrite rewrites the targets of searches for every index or broader than the projects
+	//of the user to the indices of the projects
+	AuthIndexRewrite bool `flag:"auth-index-rewrite"`
+	//AuthCertificateIndexPatterns are the indices certificates may write to given as <subject>:<pattern>
+	AuthCertificateIndexPatterns []string `flag:"auth-certificate-index-pattern"`
+	//AuthCertificateIndices are the patterns of AuthCertificateIndexPatterns by certificate subject
+	AuthCertificateIndices map[string][]string
+	//AuthBulkDenyMode decides whether forbidden items of bulk requests reject the whole request or
+	//are answered with an error each: request or item
+	AuthBulkDenyMode string `flag:"auth-bulk-deny-mode"`
+	//AuthNamespaceField is the field of documents holding their namespace. Searches of users are
+	//filtered to the documents of their projects when given
+	AuthNamespaceField string `flag:"auth-namespace-field"`
+	//AuthNamespaceFilterMaxBodySize is the size in megabytes of the largest body filtered, or read to authorize
+	//or rewrite its indices. Zero means no limit
+	AuthNamespaceFilterMaxBodySize int `flag:"auth-namespace-filter-max-body-size"`
+	//AuthKibanaIndexMode decides whether users share the index of Kibana or are each given their own: shared or user
+	AuthKibanaIndexMode string `flag:"auth-kibana-index-mode"`
+	//AuthKibanaSharedRoles are the roles, i.e. of infra users, which keep the shared index of Kibana
+	AuthKibanaSharedRoles []string `flag:"auth-kibana-shared-role"`
+
+	//AuthWebhookURL is the endpoint of a policy service asked to allow or deny each request
+	AuthWebhookURL string `flag:"auth-webhook-url"`
+	//AuthWebhookCAs are the CA roots used to verify the policy service
+	AuthWebhookCAs []string `flag:"auth-webhook-ca"`
+	//AuthWebhookTimeout is the maximum duration to wait for a decision
+	AuthWebhookTimeout time.Duration `flag:"auth-webhook-timeout"`
+	//AuthWebhookCacheExpiry is the duration a decision is cached. Zero disables caching
+	AuthWebhookCacheExpiry time.Duration `flag:"auth-webhook-cache-expiry"`
+	//AuthWebhookFailOpen allows requests when the policy service fails to decide
+	AuthWebhookFailOpen bool `flag:"auth-webhook-fail-open"`
+
 	//net/http.Server timeouts for the server side of the proxy
 	HTTPReadTimeout  time.Duration `flag:"http-read-timeout"`
 	HTTPWriteTimeout time.Duration `flag:"http-write-timeout"`
@@ -65,6 +172,9 @@ type Options struct {
 	HTTPIdleConnTimeout       time.Duration `flag:"http-idle-conn-timeout"`
 	HTTPTLSHandshakeTimeout   time.Duration `flag:"http-tls-handshake-timeout"`
 	HTTPExpectContinueTimeout time.Duration `flag:"http-expect-continue-timeout"`
+
+	//sources maps a flag name to the config file key or environment variable its value was read from
+	sources map[string]string
 }
 
 // Init the configuration options based on the values passed via the CLI
@@ -74,7 +184,39 @@ func Init(args []string) (*Options, error) {
 
 	flagSet.Parse(args)
 
-	options.Resolve(opts, flagSet, nil)
+	//values are resolved in order of precedence: flag, environment, config file, default
+	cfg := map[string]interface{}{}
+	sources := map[string]string{}
+
+	path := flagSet.Lookup("config").Value.String()
+	if path == "" {
+		path = os.Getenv(envName("config"))
+	}
+	if path != "" {
+		fileCfg, err := loadConfigFile(path)
+		if err != nil {
+			return nil, err
+		}
+		for name, value := range fileCfg.values {
+			cfg[name] = value
+			sources[name] = fmt.Sprintf("%s: %s", path, name)
+		}
+		for name, roleConfig := range fileCfg.backendRoles {
+			opts.AuthBackEndRoles[name] = roleConfig
+		}
+	}
+
+	envCfg, err := loadEnv(os.LookupEnv)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range envCfg {
+		cfg[name] = value
+		sources[name] = envName(name)
+	}
+	opts.setSources(sources, flagSet)
+
+	options.Resolve(opts, flagSet, cfg)
 
 	if opts.SSLInsecureSkipVerify {
 		insecureTransport := &http.Transport{
@@ -90,26 +232,66 @@ func Init(args []string) (*Options, error) {
 
 func newOptions() *Options {
 	return &Options{
-		ProxyWebSockets:           true,
-		ListeningAddress:          ":443",
-		Elasticsearch:             "https://localhost:9200",
-		UpstreamFlush:             time.Duration(5) * time.Millisecond,
-		RequestLogging:            false,
-		AuthBackEndRoles:          map[string]BackendRoleConfig{},
-		AuthWhiteListedNames:      []string{},
-		AuthAdminRole:             "",
-		HTTPReadTimeout:           time.Duration(1) * time.Minute,
-		HTTPWriteTimeout:          time.Duration(1) * time.Minute,
-		HTTPIdleTimeout:           time.Duration(1) * time.Minute,
-		HTTPMaxConnsPerHost:       25,
-		HTTPMaxIdleConns:          25,
-		HTTPMaxIdleConnsPerHost:   25,
-		HTTPIdleConnTimeout:       time.Duration(1) * time.Minute,
-		HTTPTLSHandshakeTimeout:   time.Duration(10) * time.Second,
-		HTTPExpectContinueTimeout: time.Duration(1) * time.Second,
+		ProxyWebSockets:                true,
+		ListeningAddress:               ":443",
+		Elasticsearch:                  "https://localhost:9200",
+		UpstreamFlush:                  time.Duration(5) * time.Millisecond,
+		RequestLogging:                 false,
+		RequestLoggingFormat:           "clf",
+		RequestLoggingFileMaxSize:      100,
+		RequestLoggingFileMaxBackups:   5,
+		RequestLoggingFileMaxAge:       time.Duration(7*24) * time.Hour,
+		LogFormat:                      LogFormatText,
+		LogLevelMaxDuration:            time.Duration(1) * time.Hour,
+		LogRedactHeaders:               []string{},
+		RequestIDHeader:                "X-Opaque-Id",
+		TracingExporter:                TracingExporterNone,
+		AuthBackEndRoles:               map[string]BackendRoleConfig{},
+		AuthWhiteListedNames:           []string{},
+		AuthIndexPatterns:              []string{},
+		AuthAdminRole:                  "",
+		AuthNamespaceFilterMaxBodySize: 10,
+		AuthCertificateIndexPatterns:   []string{},
+		AuthBulkDenyMode:               BulkDenyRequest,
+		AuthKibanaIndexMode:            KibanaIndexShared,
+		AuthKibanaSharedRoles:          []string{},
+		AuthWebhookTimeout:             time.Duration(5) * time.Second,
+		AuthWebhookCacheExpiry:         time.Duration(1) * time.Minute,
+		HTTPReadTimeout:                time.Duration(1) * time.Minute,
+		HTTPWriteTimeout:               time.Duration(1) * time.Minute,
+		HTTPIdleTimeout:                time.Duration(1) * time.Minute,
+		HTTPMaxConnsPerHost:            25,
+		HTTPMaxIdleConns:               25,
+		HTTPMaxIdleConnsPerHost:        25,
+		HTTPIdleConnTimeout:            time.Duration(1) * time.Minute,
+		HTTPTLSHandshakeTimeout:        time.Duration(10) * time.Second,
+		HTTPExpectContinueTimeout:      time.Duration(1) * time.Second,
+	}
+}
+
+// setSources records where the values of options not set by flag were read from
+func (o *Options) setSources(sources map[string]string, flagSet *flag.FlagSet) {
+	setFlags := map[string]bool{}
+	flagSet.Visit(func(f *flag.Flag) {
+		setFlags[f.Name] = true
+	})
+	o.sources = map[string]string{}
+	for name, field := range optionFields() {
+		flagName := field.Tag.Get("flag")
+		if source, found := sources[name]; found && !setFlags[flagName] {
+			o.sources[flagName] = source
+		}
 	}
 }
 
+// optionName returns the name used to refer to an option in validation messages
+func (o *Options) optionName(flagName string) string {
+	if source, found := o.sources[flagName]; found {
+		return source
+	}
+	return flagName
+}
+
 // Validate the configuration options and return errors
 func (o *Options) Validate() error {
 	log.Tracef("Validating options: %v", o)
@@ -132,19 +314,65 @@ func (o *Options) Validate() error {
 	}
 
 	if len(o.TLSClientCAFile) > 0 && (len(o.TLSKeyFile) == 0 || len(o.TLSCertFile) == 0) {
-		msgs = append(msgs, "tls-client-ca requires tls-key-file or tls-cert-file to be set to listen on tls")
+		msgs = append(msgs, fmt.Sprintf("%s requires tls-key-file or tls-cert-file to be set to listen on tls", o.optionName("tls-client-ca")))
 	}
 
 	if o.MetricsListeningAddress != "" && (o.MetricsTLSCertFile == "" || o.MetricsTLSKeyFile == "") {
-		msgs = append(msgs, "metrics-listening-address requires metrics-tls-cert and metrics-tls-key to be set")
+		msgs = append(msgs, fmt.Sprintf("%s requires metrics-tls-cert and metrics-tls-key to be set", o.optionName("metrics-listening-address")))
+	}
+
+	if o.RequestLoggingFormat != "clf" && o.RequestLoggingFormat != "json" {
+		if _, err := template.New("request-logging-format").Parse(o.RequestLoggingFormat); err != nil {
+			msgs = append(msgs, fmt.Sprintf("%s must be clf, json or a valid template: %v", o.optionName("request-logging-format"), err))
+		}
+	}
+	if o.RequestLoggingFileMaxSize < 0 {
+		msgs = append(msgs, fmt.Sprintf("%s can not be negative", o.optionName("request-logging-file-max-size")))
+	}
+	if o.RequestLoggingFileRotateInterval < 0 {
+		msgs = append(msgs, fmt.Sprintf("%s can not be negative", o.optionName("request-logging-file-rotate-interval")))
+	}
+	if o.RequestLoggingFileMaxBackups < 0 {
+		msgs = append(msgs, fmt.Sprintf("%s can not be negative", o.optionName("request-logging-file-max-backups")))
+	}
+	if o.RequestLoggingFileMaxAge < 0 {
+		msgs = append(msgs, fmt.Sprintf("%s can not be negative", o.optionName("request-logging-file-max-age")))
+	}
+	if o.RequestLoggingStdout && o.RequestLoggingFile == "" {
+		msgs = append(msgs, fmt.Sprintf("%s requires request-logging-file to be set", o.optionName("request-logging-stdout")))
+	}
+	if o.LogFormat != LogFormatText && o.LogFormat != LogFormatJSON {
+		msgs = append(msgs, fmt.Sprintf("%s %q must be one of %s or %s", o.optionName("log-format"), o.LogFormat, LogFormatText, LogFormatJSON))
+	}
+	if o.TrustRequestID && o.RequestIDHeader == "" {
+		msgs = append(msgs, fmt.Sprintf("%s requires request-id-header to be set", o.optionName("trust-request-id")))
+	}
+	switch o.TracingExporter {
+	case TracingExporterNone, TracingExporterStdout:
+	case TracingExporterOTLP:
+		if endpoint, err := url.Parse(o.TracingEndpoint); err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") {
+			msgs = append(msgs, fmt.Sprintf("%s %q must be an http or https URL", o.optionName("tracing-endpoint"), o.TracingEndpoint))
+		}
+	case TracingExporterFile:
+		if o.TracingFile == "" {
+			msgs = append(msgs, fmt.Sprintf("%s requires tracing-file to be set", o.optionName("tracing-exporter")))
+		}
+	default:
+		msgs = append(msgs, fmt.Sprintf("%s %q must be one of %s, %s, %s or %s", o.optionName("tracing-exporter"), o.TracingExporter,
+			TracingExporterNone, TracingExporterOTLP, TracingExporterStdout, TracingExporterFile))
+	}
+	if o.LogLevelMaxDuration < 0 {
+		msgs = append(msgs, fmt.Sprintf("%s can not be negative", o.optionName("log-level-max-duration")))
 	}
 
 	//Auth Handler validations
 	if len(o.RawAuthBackEndRole) > 0 {
+		//roles given by auth-backend-role replace those of the same name from the config file
+		rawRoles := map[string]BackendRoleConfig{}
 		for _, raw := range o.RawAuthBackEndRole {
 			parts := strings.Split(raw, "=")
 			if len(parts) != 2 {
-				msgs = append(msgs, fmt.Sprintf("auth-backend-role %q should be name=SAR", raw))
+				msgs = append(msgs, fmt.Sprintf("%s %q should be name=SAR", o.optionName("auth-backend-role"), raw))
 				continue
 			}
 			name := parts[0]
@@ -154,40 +382,125 @@ func (o *Options) Validate() error {
 				msgs = append(msgs, fmt.Sprintf("Unable to parse backend roleConfig %q: %v", raw, err))
 				continue
 			}
-			if _, exists := o.AuthBackEndRoles[name]; exists {
+			if _, exists := rawRoles[name]; exists {
 				msgs = append(msgs, fmt.Sprintf("Backend role with that name %q already exists", raw))
 				continue
 			}
-			o.AuthBackEndRoles[name] = *roleConfig
+			rawRoles[name] = *roleConfig
+		}
+		if o.AuthBackEndRoles == nil {
+			o.AuthBackEndRoles = map[string]BackendRoleConfig{}
+		}
+		for name, roleConfig := range rawRoles {
+			o.AuthBackEndRoles[name] = roleConfig
+		}
+	}
+	o.AuthRoleExpressions = map[string]*RoleExpression{}
+	roleNames := make([]string, 0, len(o.AuthBackEndRoles))
+	for name := range o.AuthBackEndRoles {
+		roleNames = append(roleNames, name)
+	}
+	sort.Strings(roleNames)
+	for _, name := range roleNames {
+		roleConfig := o.AuthBackEndRoles[name]
+		if err := roleConfig.Validate(); err != nil {
+			msgs = append(msgs, fmt.Sprintf("Invalid backend role %q: %v", name, err))
+		}
+		if roleConfig.Expression != "" {
+			expression, err := CompileRoleExpression(roleConfig.Expression)
+			if err != nil {
+				msgs = append(msgs, fmt.Sprintf("Invalid backend role %q: expression %q: %v", name, roleConfig.Expression, err))
+				continue
+			}
+			o.AuthRoleExpressions[name] = expression
+		}
+	}
+
+	o.AuthPolicy = nil
+	if o.AuthPolicyFile != "" {
+		policy, err := LoadAccessPolicy(o.AuthPolicyFile)
+		if err != nil {
+			msgs = append(msgs, fmt.Sprintf("%s: %v", o.optionName("auth-policy-file"), err))
+		} else {
+			o.AuthPolicy = policy
+		}
+	}
+
+	for _, pattern := range o.AuthIndexPatterns {
+		if err := elasticsearch.ValidateIndexPattern(pattern); err != nil {
+			msgs = append(msgs, fmt.Sprintf("%s: %v", o.optionName("auth-index-pattern"), err))
+		} else if err := elasticsearch.ValidateNamespaceDelimiter(pattern); err != nil {
+			msgs = append(msgs, fmt.Sprintf("%s: %v", o.optionName("auth-index-pattern"), err))
+		}
+	}
+
+	if o.AuthIndexRewrite && len(o.AuthIndexPatterns) == 0 {
+		msgs = append(msgs, fmt.Sprintf("%s requires auth-index-pattern to be set", o.optionName("auth-index-rewrite")))
+	}
+
+	o.AuthCertificateIndices = map[string][]string{}
+	for _, value := range o.AuthCertificateIndexPatterns {
+		// index names can not contain a colon which subjects may
+		separator := strings.LastIndex(value, ":")
+		if separator <= 0 || separator == len(value)-1 {
+			msgs = append(msgs, fmt.Sprintf("%s %q must be given as <subject>:<pattern>", o.optionName("auth-certificate-index-pattern"), value))
+			continue
+		}
+		subject := value[:separator]
+		o.AuthCertificateIndices[subject] = append(o.AuthCertificateIndices[subject], value[separator+1:])
+	}
+
+	if o.AuthBulkDenyMode != BulkDenyRequest && o.AuthBulkDenyMode != BulkDenyItem {
+		msgs = append(msgs, fmt.Sprintf("%s %q must be one of %s or %s", o.optionName("auth-bulk-deny-mode"), o.AuthBulkDenyMode, BulkDenyRequest, BulkDenyItem))
+	}
+
+	if o.AuthNamespaceFilterMaxBodySize < 0 {
+		msgs = append(msgs, fmt.Sprintf("%s can not be negative", o.optionName("auth-namespace-filter-max-body-size")))
+	}
+
+	if o.AuthKibanaIndexMode != KibanaIndexShared && o.AuthKibanaIndexMode != KibanaIndexUser {
+		msgs = append(msgs, fmt.Sprintf("%s %q must be one of %s or %s", o.optionName("auth-kibana-index-mode"), o.AuthKibanaIndexMode, KibanaIndexShared, KibanaIndexUser))
+	}
+
+	if o.AuthWebhookURL != "" {
+		webhookURL, err := url.Parse(o.AuthWebhookURL)
+		if err != nil || (webhookURL.Scheme != "http" && webhookURL.Scheme != "https") {
+			msgs = append(msgs, fmt.Sprintf("%s %q must be an http or https URL", o.optionName("auth-webhook-url"), o.AuthWebhookURL))
 		}
 	}
+	if o.AuthWebhookTimeout < 0 {
+		msgs = append(msgs, fmt.Sprintf("%s can not be negative", o.optionName("auth-webhook-timeout")))
+	}
+	if o.AuthWebhookCacheExpiry < 0 {
+		msgs = append(msgs, fmt.Sprintf("%s can not be negative", o.optionName("auth-webhook-cache-expiry")))
+	}
 
 	if o.HTTPReadTimeout < 0 {
-		msgs = append(msgs, "http-read-timeout can not be negative")
+		msgs = append(msgs, fmt.Sprintf("%s can not be negative", o.optionName("http-read-timeout")))
 	}
 	if o.HTTPWriteTimeout < 0 {
-		msgs = append(msgs, "http-write-timeout can not be negative")
+		msgs = append(msgs, fmt.Sprintf("%s can not be negative", o.optionName("http-write-timeout")))
 	}
 	if o.HTTPIdleTimeout < 0 {
-		msgs = append(msgs, "http-idle-timeout can not be negative")
+		msgs = append(msgs, fmt.Sprintf("%s can not be negative", o.optionName("http-idle-timeout")))
 	}
 	if o.HTTPMaxConnsPerHost < 0 {
-		msgs = append(msgs, "http-max-conns-per-host can not be negative")
+		msgs = append(msgs, fmt.Sprintf("%s can not be negative", o.optionName("http-max-conns-per-host")))
 	}
 	if o.HTTPMaxIdleConns < 0 {
-		msgs = append(msgs, "http-max-idle-conns can not be negative")
+		msgs = append(msgs, fmt.Sprintf("%s can not be negative", o.optionName("http-max-idle-conns")))
 	}
 	if o.HTTPMaxIdleConnsPerHost < 0 {
-		msgs = append(msgs, "http-max-idle-conns-per-host can not be negative")
+		msgs = append(msgs, fmt.Sprintf("%s can not be negative", o.optionName("http-max-idle-conns-per-host")))
 	}
 	if o.HTTPIdleConnTimeout < 0 {
-		msgs = append(msgs, "http-idle-conn-timeout can not be negative")
+		msgs = append(msgs, fmt.Sprintf("%s can not be negative", o.optionName("http-idle-conn-timeout")))
 	}
 	if o.HTTPTLSHandshakeTimeout < 0 {
-		msgs = append(msgs, "http-tls-handshake-timeout can not be negative")
+		msgs = append(msgs, fmt.Sprintf("%s can not be negative", o.optionName("http-tls-handshake-timeout")))
 	}
 	if o.HTTPExpectContinueTimeout < 0 {
-		msgs = append(msgs, "http-expect-continue-timeout can not be negative")
+		msgs = append(msgs, fmt.Sprintf("%s can not be negative", o.optionName("http-expect-continue-timeout")))
 	}
 
 	if len(msgs) != 0 {
@@ -2,6 +2,8 @@ package config_test
 
 import (
 	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -18,6 +20,12 @@ func errorMessage(msgs ...string) string {
 	return strings.Join(result, "\n  ")
 }
 
+func writeConfigFile(name, content string) string {
+	path := filepath.Join(testDir, name)
+	Expect(os.WriteFile(path, []byte(content), 0600)).To(Succeed())
+	return path
+}
+
 var _ = Describe("Initializing Config options", func() {
 
 	Describe("when defining tls-client-ca without key or certs", func() {
@@ -137,7 +145,201 @@ var _ = Describe("Initializing Config options", func() {
 		})
 	})
 
+	Describe("when defining compound auth backend roles", func() {
+		It("should succeed", func() {
+			args := []string{"--auth-backend-role=infra={\"anyOf\":[{\"verb\":\"get\",\"resource\":\"pods/log\"},{\"allOf\":[{\"groups\":[\"admins\"]},{\"usernames\":[\"system:*\"]}]}]}"}
+			options, err := config.Init(args)
+			Expect(err).Should(BeNil())
+			Expect(options.AuthBackEndRoles).Should(Equal(map[string]config.BackendRoleConfig{
+				"infra": {
+					AnyOf: []config.BackendRoleConfig{
+						{Verb: "get", Resource: "pods/log"},
+						{AllOf: []config.BackendRoleConfig{{Groups: []string{"admins"}}, {Usernames: []string{"system:*"}}}},
+					},
+				},
+			}))
+		})
+		It("should fail with an invalid username pattern", func() {
+			args := []string{"--auth-backend-role=infra={\"anyOf\":[{\"usernames\":[\"[\"]}]}"}
+			options, err := config.Init(args)
+			Expect(options).Should(BeNil())
+			Expect(err.Error()).Should(
+				Equal(errorMessage("Invalid backend role \"infra\": anyOf[0]: invalid username pattern \"[\": syntax error in pattern")))
+		})
+	})
+
+	Describe("when defining auth backend roles with expressions", func() {
+		It("should compile the expressions", func() {
+			args := []string{"--auth-backend-role=infra={\"expression\":\"'logging-admins' in groups\"}", "--auth-backend-role=reader={\"verb\":\"get\"}"}
+			options, err := config.Init(args)
+			Expect(err).Should(BeNil())
+			Expect(options.AuthRoleExpressions).Should(HaveLen(1))
+			Expect(options.AuthRoleExpressions["infra"].String()).Should(Equal("'logging-admins' in groups"))
+		})
+		It("should fail with type errors", func() {
+			args := []string{"--auth-backend-role=infra={\"expression\":\"projectCount\"}"}
+			options, err := config.Init(args)
+			Expect(options).Should(BeNil())
+			Expect(err.Error()).Should(
+				Equal(errorMessage("Invalid backend role \"infra\": expression \"projectCount\": expression must evaluate to a bool but evaluates to int")))
+		})
+		It("should fail with nested expressions", func() {
+			args := []string{"--auth-backend-role=infra={\"allOf\":[{\"expression\":\"true\"}]}"}
+			options, err := config.Init(args)
+			Expect(options).Should(BeNil())
+			Expect(err.Error()).Should(
+				Equal(errorMessage("Invalid backend role \"infra\": allOf[0]: expression is only supported on the top level rule")))
+		})
+	})
+
+	Describe("when defining index patterns", func() {
+		It("should succeed with a project placeholder", func() {
+			options, err := config.Init([]string{"--auth-index-pattern=app.{namespace}.*", "--auth-index-pattern=project.{namespace}.{uid}.*"})
+			Expect(err).Should(BeNil())
+			Expect(options.AuthIndexPatterns).Should(Equal([]string{"app.{namespace}.*", "project.{namespace}.{uid}.*"}))
+		})
+		It("should fail when the namespace may be followed by the names of other projects", func() {
+			options, err := config.Init([]string{"--auth-index-pattern=app-{namespace}-*"})
+			Expect(options).Should(BeNil())
+			Expect(err.Error()).Should(Equal(errorMessage("auth-index-pattern: index pattern \"app-{namespace}-*\" must follow {namespace} by a character namespaces can not contain, such as a dot, or by {uid}")))
+		})
+		It("should fail without a project placeholder", func() {
+			options, err := config.Init([]string{"--auth-index-pattern=app-*"})
+			Expect(options).Should(BeNil())
+			Expect(err.Error()).Should(Equal(errorMessage("auth-index-pattern: index pattern \"app-*\" must contain {namespace} or {uid}")))
+		})
+		It("should rewrite targets when given patterns", func() {
+			options, err := config.Init([]string{"--auth-index-pattern=app.{namespace}.*", "--auth-index-rewrite"})
+			Expect(err).Should(BeNil())
+			Expect(options.AuthIndexRewrite).Should(BeTrue())
+		})
+		It("should fail to rewrite targets without patterns", func() {
+			options, err := config.Init([]string{"--auth-index-rewrite"})
+			Expect(options).Should(BeNil())
+			Expect(err.Error()).Should(Equal(errorMessage("auth-index-rewrite requires auth-index-pattern to be set")))
+		})
+	})
+
+	Describe("when inspecting bulk requests", func() {
+		It("should group the index patterns of certificates by subject", func() {
+			options, err := config.Init([]string{"--auth-certificate-index-pattern=CN=collector,OU=logging:app-*",
+				"--auth-certificate-index-pattern=CN=collector,OU=logging:infra-*", "--auth-bulk-deny-mode=item"})
+			Expect(err).Should(BeNil())
+			Expect(options.AuthCertificateIndices).Should(Equal(map[string][]string{"CN=collector,OU=logging": {"app-*", "infra-*"}}))
+			Expect(options.AuthBulkDenyMode).Should(Equal(config.BulkDenyItem))
+		})
+		It("should fail with a pattern without a subject", func() {
+			options, err := config.Init([]string{"--auth-certificate-index-pattern=app-*"})
+			Expect(options).Should(BeNil())
+			Expect(err.Error()).Should(Equal(errorMessage("auth-certificate-index-pattern \"app-*\" must be given as <subject>:<pattern>")))
+		})
+		It("should fail with an unknown deny mode", func() {
+			options, err := config.Init([]string{"--auth-bulk-deny-mode=line"})
+			Expect(options).Should(BeNil())
+			Expect(err.Error()).Should(Equal(errorMessage("auth-bulk-deny-mode \"line\" must be one of request or item")))
+		})
+	})
+
+	Describe("when filtering documents by namespace", func() {
+		It("should default the body limit", func() {
+			options, err := config.Init([]string{"--auth-namespace-field=kubernetes.namespace_name"})
+			Expect(err).Should(BeNil())
+			Expect(options.AuthNamespaceField).Should(Equal("kubernetes.namespace_name"))
+			Expect(options.AuthNamespaceFilterMaxBodySize).Should(Equal(10))
+		})
+		It("should fail with a negative body limit", func() {
+			options, err := config.Init([]string{"--auth-namespace-filter-max-body-size=-1"})
+			Expect(options).Should(BeNil())
+			Expect(err.Error()).Should(Equal(errorMessage("auth-namespace-filter-max-body-size can not be negative")))
+		})
+	})
+
+	Describe("when giving users their own index of Kibana", func() {
+		It("should default to the shared index", func() {
+			options, err := config.Init([]string{})
+			Expect(err).Should(BeNil())
+			Expect(options.AuthKibanaIndexMode).Should(Equal(config.KibanaIndexShared))
+			Expect(options.AuthKibanaSharedRoles).Should(BeEmpty())
+		})
+		It("should keep the shared index for the given roles", func() {
+			options, err := config.Init([]string{"--auth-kibana-index-mode=user", "--auth-kibana-shared-role=infra-reader"})
+			Expect(err).Should(BeNil())
+			Expect(options.AuthKibanaIndexMode).Should(Equal(config.KibanaIndexUser))
+			Expect(options.AuthKibanaSharedRoles).Should(Equal([]string{"infra-reader"}))
+		})
+		It("should fail with an unknown index mode", func() {
+			options, err := config.Init([]string{"--auth-kibana-index-mode=unique"})
+			Expect(options).Should(BeNil())
+			Expect(err.Error()).Should(Equal(errorMessage("auth-kibana-index-mode \"unique\" must be one of shared or user")))
+		})
+	})
+
+	Describe("when defining an access policy file", func() {
+		It("should load the rules and default to allow", func() {
+			path := writeConfigFile("policy.yaml", `
+rules:
+- name: cluster-settings
+  effect: deny
+  methods: [PUT]
+  paths: [/_cluster/settings]
+`)
+			options, err := config.Init([]string{"--auth-policy-file=" + path})
+			Expect(err).Should(BeNil())
+			Expect(options.AuthPolicy).Should(Equal(&config.AccessPolicy{
+				Default: config.PolicyEffectAllow,
+				Rules: []config.AccessRule{
+					{Name: "cluster-settings", Effect: "deny", Methods: []string{"PUT"}, Paths: []string{"/_cluster/settings"}},
+				},
+			}))
+		})
+		It("should fail for invalid rules", func() {
+			path := writeConfigFile("policy.yaml", "rules:\n- name: snapshots\n  effect: block\n")
+			options, err := config.Init([]string{"--auth-policy-file=" + path})
+			Expect(options).Should(BeNil())
+			Expect(err.Error()).Should(Equal(errorMessage(
+				"auth-policy-file: invalid access policy \"" + path + "\": rule \"snapshots\": effect \"block\" must be allow or deny")))
+		})
+		It("should fail for unknown keys", func() {
+			path := writeConfigFile("policy.yaml", "rules:\n- name: snapshots\n  effect: deny\n  path: /_snapshot\n")
+			options, err := config.Init([]string{"--auth-policy-file=" + path})
+			Expect(options).Should(BeNil())
+			Expect(err.Error()).Should(ContainSubstring("unknown field \"path\""))
+		})
+	})
+
 	// HTTPReadTimeout
+	Describe("when defining the log format", func() {
+		It("should accept json", func() {
+			options, err := config.Init([]string{"--log-format=json"})
+			Expect(err).Should(BeNil())
+			Expect(options.LogFormat).Should(Equal(config.LogFormatJSON))
+		})
+		It("should fail with an unknown format", func() {
+			options, err := config.Init([]string{"--log-format=xml"})
+			Expect(options).Should(BeNil())
+			Expect(err.Error()).Should(
+				Equal(errorMessage(`log-format "xml" must be one of text or json`)))
+		})
+	})
+
+	Describe("when defining the tracing exporter", func() {
+		It("should accept an OTLP endpoint", func() {
+			options, err := config.Init([]string{"--tracing-exporter=otlp", "--tracing-endpoint=http://collector:4318"})
+			Expect(err).Should(BeNil())
+			Expect(options.TracingEndpoint).Should(Equal("http://collector:4318"))
+		})
+		It("should fail without an OTLP endpoint", func() {
+			_, err := config.Init([]string{"--tracing-exporter=otlp"})
+			Expect(err.Error()).Should(
+				Equal(errorMessage(`tracing-endpoint "" must be an http or https URL`)))
+		})
+		It("should fail with the file exporter without a file", func() {
+			_, err := config.Init([]string{"--tracing-exporter=file"})
+			Expect(err.Error()).Should(
+				Equal(errorMessage("tracing-exporter requires tracing-file to be set")))
+		})
+	})
+
 	Describe("when defining HTTP server read timeout", func() {
 		Describe("to be non-negative", func() {
 			It("should succeed", func() {
@@ -159,6 +361,28 @@ var _ = Describe("Initializing Config options", func() {
 		})
 	})
 
+	Describe("when defining the request logging file", func() {
+		It("should default the rotation and retention", func() {
+			options, err := config.Init([]string{"--request-logging-file=/var/log/proxy/access.log"})
+			Expect(err).Should(BeNil())
+			Expect(options.RequestLoggingFile).Should(Equal("/var/log/proxy/access.log"))
+			Expect(options.RequestLoggingFileMaxSize).Should(Equal(100))
+			Expect(options.RequestLoggingFileRotateInterval).Should(Equal(time.Duration(0)))
+			Expect(options.RequestLoggingFileMaxBackups).Should(Equal(5))
+			Expect(options.RequestLoggingFileMaxAge).Should(Equal(168 * time.Hour))
+		})
+		It("should fail for negative retention", func() {
+			options, err := config.Init([]string{"--request-logging-file=access.log", "--request-logging-file-max-backups=-1"})
+			Expect(options).Should(BeNil())
+			Expect(err.Error()).Should(Equal(errorMessage("request-logging-file-max-backups can not be negative")))
+		})
+		It("should fail logging to stdout as well without a file", func() {
+			options, err := config.Init([]string{"--request-logging-stdout"})
+			Expect(options).Should(BeNil())
+			Expect(err.Error()).Should(Equal(errorMessage("request-logging-stdout requires request-logging-file to be set")))
+		})
+	})
+
 	// HTTPWriteTimeout
 	Describe("when defining HTTP server write timeout", func() {
 		Describe("to be non-negative", func() {
@@ -336,4 +560,171 @@ var _ = Describe("Initializing Config options", func() {
 			})
 		})
 	})
+
+	Describe("when defining a config file", func() {
+		Describe("in YAML", func() {
+			It("should apply the values and nested backend roles", func() {
+				path := writeConfigFile("config.yaml", `
+cache_expiry: 2m
+auth_admin_role: admin_reader
+upstream_ca:
+  - /foo/ca
+  - /bar/ca
+auth_backend_roles:
+  admin_reader:
+    namespace: default
+    verb: get
+    resource: pods/log
+`)
+				options, err := config.Init([]string{"--config=" + path})
+				Expect(err).Should(BeNil())
+				Expect(options.CacheExpiry).Should(Equal(2 * time.Minute))
+				Expect(options.AuthAdminRole).Should(Equal("admin_reader"))
+				Expect(options.UpstreamCAs).Should(Equal([]string{"/foo/ca", "/bar/ca"}))
+				Expect(options.AuthBackEndRoles).Should(Equal(map[string]config.BackendRoleConfig{
+					"admin_reader": {Namespace: "default", Verb: "get", Resource: "pods/log"},
+				}))
+			})
+		})
+		Describe("in JSON", func() {
+			It("should apply the values", func() {
+				path := writeConfigFile("config.json", `{"http-max-conns-per-host": 7, "request_logging": true}`)
+				options, err := config.Init([]string{"--config=" + path})
+				Expect(err).Should(BeNil())
+				Expect(options.HTTPMaxConnsPerHost).Should(Equal(7))
+				Expect(options.RequestLogging).Should(BeTrue())
+			})
+		})
+		Describe("and the same options as flags", func() {
+			It("should prefer the flags", func() {
+				path := writeConfigFile("config.yaml", `
+auth_default_role: file_role
+auth_backend_roles:
+  foo:
+    verb: list
+  bar:
+    verb: list
+`)
+				args := []string{"--config=" + path, "--auth-default-role=flag_role", "--auth-backend-role=foo={\"verb\":\"get\"}"}
+				options, err := config.Init(args)
+				Expect(err).Should(BeNil())
+				Expect(options.AuthDefaultRole).Should(Equal("flag_role"))
+				Expect(options.AuthBackEndRoles).Should(Equal(map[string]config.BackendRoleConfig{
+					"foo": {Verb: "get"},
+					"bar": {Verb: "list"},
+				}))
+			})
+			It("should not cite the file for invalid flag values", func() {
+				path := writeConfigFile("config.yaml", "http_read_timeout: 1s\n")
+				options, err := config.Init([]string{"--config=" + path, "--http-read-timeout=-1s"})
+				Expect(options).Should(BeNil())
+				Expect(err.Error()).Should(Equal(errorMessage("http-read-timeout can not be negative")))
+			})
+		})
+		Describe("with invalid content", func() {
+			It("should fail citing the file and unknown keys", func() {
+				path := writeConfigFile("config.yaml", "cache_expiry: 2m\nnot_an_option: true\n")
+				options, err := config.Init([]string{"--config=" + path})
+				Expect(options).Should(BeNil())
+				Expect(err.Error()).Should(Equal(errorMessage(path + ": not_an_option: unknown option")))
+			})
+			It("should fail citing the file and key for values of the wrong type", func() {
+				path := writeConfigFile("config.yaml", "cache_expiry: soon\nhttp_max_idle_conns: [1]\n")
+				options, err := config.Init([]string{"--config=" + path})
+				Expect(options).Should(BeNil())
+				Expect(err.Error()).Should(Equal(errorMessage(
+					path+": cache_expiry: invalid duration \"soon\"",
+					path+": http_max_idle_conns: expected a scalar value but got []interface {}",
+				)))
+			})
+			It("should fail citing the file and key for invalid backend roles", func() {
+				path := writeConfigFile("config.yaml", "auth_backend_roles:\n  foo:\n    verbs: get\n")
+				options, err := config.Init([]string{"--config=" + path})
+				Expect(options).Should(BeNil())
+				Expect(err.Error()).Should(Equal(errorMessage(
+					path + ": auth_backend_roles.foo: json: unknown field \"verbs\"",
+				)))
+			})
+			It("should fail citing the file and key for values that do not validate", func() {
+				path := writeConfigFile("config.yaml", "http_read_timeout: -1s\n")
+				options, err := config.Init([]string{"--config=" + path})
+				Expect(options).Should(BeNil())
+				Expect(err.Error()).Should(Equal(errorMessage(path + ": http_read_timeout can not be negative")))
+			})
+		})
+		Describe("that does not exist", func() {
+			It("should fail", func() {
+				options, err := config.Init([]string{"--config=/does/not/exist.yaml"})
+				Expect(options).Should(BeNil())
+				Expect(err.Error()).Should(ContainSubstring("unable to read config file \"/does/not/exist.yaml\""))
+			})
+		})
+	})
+
+	Describe("when defining environment variables", func() {
+		var envs []string
+
+		setenv := func(name, value string) {
+			Expect(os.Setenv(name, value)).To(Succeed())
+			envs = append(envs, name)
+		}
+
+		AfterEach(func() {
+			for _, name := range envs {
+				os.Unsetenv(name)
+			}
+			envs = nil
+		})
+
+		It("should apply the values", func() {
+			setenv("ESPROXY_CACHE_EXPIRY", "3m")
+			setenv("ESPROXY_SSL_INSECURE_SKIP_VERIFY", "false")
+			setenv("ESPROXY_HTTP_MAX_IDLE_CONNS", "3")
+			options, err := config.Init([]string{})
+			Expect(err).Should(BeNil())
+			Expect(options.CacheExpiry).Should(Equal(3 * time.Minute))
+			Expect(options.SSLInsecureSkipVerify).Should(BeFalse())
+			Expect(options.HTTPMaxIdleConns).Should(Equal(3))
+		})
+		It("should apply list values given one per line", func() {
+			setenv("ESPROXY_UPSTREAM_CA", "/foo/ca\n/bar/ca\n")
+			setenv("ESPROXY_AUTH_BACKEND_ROLE", "foo={\"verb\":\"get\",\"resource\":\"pods\"}\nbar={\"verb\":\"list\"}")
+			options, err := config.Init([]string{})
+			Expect(err).Should(BeNil())
+			Expect(options.UpstreamCAs).Should(Equal([]string{"/foo/ca", "/bar/ca"}))
+			Expect(options.AuthBackEndRoles).Should(Equal(map[string]config.BackendRoleConfig{
+				"foo": {Verb: "get", Resource: "pods"},
+				"bar": {Verb: "list"},
+			}))
+		})
+		It("should prefer flags over the environment", func() {
+			setenv("ESPROXY_AUTH_ADMIN_ROLE", "env_role")
+			setenv("ESPROXY_UPSTREAM_CA", "/env/ca")
+			options, err := config.Init([]string{"--auth-admin-role=flag_role", "--upstream-ca=/flag/ca"})
+			Expect(err).Should(BeNil())
+			Expect(options.AuthAdminRole).Should(Equal("flag_role"))
+			Expect(options.UpstreamCAs).Should(Equal([]string{"/flag/ca"}))
+		})
+		It("should prefer the environment over the config file", func() {
+			path := writeConfigFile("config.yaml", "auth_admin_role: file_role\nauth_default_role: file_default\n")
+			setenv("ESPROXY_CONFIG", path)
+			setenv("ESPROXY_AUTH_ADMIN_ROLE", "env_role")
+			options, err := config.Init([]string{})
+			Expect(err).Should(BeNil())
+			Expect(options.AuthAdminRole).Should(Equal("env_role"))
+			Expect(options.AuthDefaultRole).Should(Equal("file_default"))
+		})
+		It("should fail citing the variable for invalid values", func() {
+			setenv("ESPROXY_HTTP_IDLE_TIMEOUT", "later")
+			options, err := config.Init([]string{})
+			Expect(options).Should(BeNil())
+			Expect(err.Error()).Should(Equal(errorMessage("ESPROXY_HTTP_IDLE_TIMEOUT: invalid duration \"later\"")))
+		})
+		It("should fail citing the variable for values that do not validate", func() {
+			setenv("ESPROXY_HTTP_IDLE_TIMEOUT", "-1s")
+			options, err := config.Init([]string{})
+			Expect(options).Should(BeNil())
+			Expect(err.Error()).Should(Equal(errorMessage("ESPROXY_HTTP_IDLE_TIMEOUT can not be negative")))
+		})
+	})
 })
@@ -0,0 +1,99 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	PolicyEffectAllow = "allow"
+	PolicyEffectDeny  = "deny"
+)
+
+// AccessPolicy allows or denies requests by the backend roles of the user and the method
+// and path of the request. The rules are evaluated in order and the first rule matching
+// the request decides. Requests matching no rule are decided by the default effect
+type AccessPolicy struct {
+	//Default is the effect for requests matching no rule, allow unless given
+	Default string       `json:"default,omitempty"`
+	Rules   []AccessRule `json:"rules"`
+}
+
+// AccessRule matches a request when every condition that is defined holds
+type AccessRule struct {
+	//Name identifies the rule in errors and metrics
+	Name string `json:"name"`
+	//Effect is allow or deny
+	Effect string `json:"effect"`
+	//Roles holds when the user has any of the backend roles
+	Roles []string `json:"roles,omitempty"`
+	//Methods holds when the request has any of the methods
+	Methods []string `json:"methods,omitempty"`
+	//Paths holds when the path matches any of the patterns where * matches within a
+	//segment and ** matches any number of segments (i.e. /_nodes/*/hot_threads)
+	Paths []string `json:"paths,omitempty"`
+	//Actions holds when the request has any of the classified actions (i.e. cluster_admin)
+	Actions []string `json:"actions,omitempty"`
+}
+
+// LoadAccessPolicy reads a YAML or JSON access policy file and validates it
+func LoadAccessPolicy(file string) (*AccessPolicy, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read access policy %q: %v", file, err)
+	}
+	data, err = yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse access policy %q: %v", file, err)
+	}
+	policy := &AccessPolicy{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(policy); err != nil {
+		return nil, fmt.Errorf("unable to parse access policy %q: %v", file, err)
+	}
+	if err := policy.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid access policy %q: %v", file, err)
+	}
+	return policy, nil
+}
+
+// Validate the default effect and the rules
+func (p *AccessPolicy) Validate() error {
+	if p.Default == "" {
+		p.Default = PolicyEffectAllow
+	}
+	if p.Default != PolicyEffectAllow && p.Default != PolicyEffectDeny {
+		return fmt.Errorf("default %q must be %s or %s", p.Default, PolicyEffectAllow, PolicyEffectDeny)
+	}
+	names := map[string]bool{}
+	for i, rule := range p.Rules {
+		if rule.Name == "" {
+			return fmt.Errorf("rule %d requires a name", i)
+		}
+		if names[rule.Name] {
+			return fmt.Errorf("rule %q is defined more than once", rule.Name)
+		}
+		names[rule.Name] = true
+		if rule.Effect != PolicyEffectAllow && rule.Effect != PolicyEffectDeny {
+			return fmt.Errorf("rule %q: effect %q must be %s or %s", rule.Name, rule.Effect, PolicyEffectAllow, PolicyEffectDeny)
+		}
+		for _, pattern := range rule.Paths {
+			if !strings.HasPrefix(pattern, "/") {
+				return fmt.Errorf("rule %q: path %q must start with /", rule.Name, pattern)
+			}
+			for _, segment := range strings.Split(pattern, "/") {
+				if _, err := path.Match(segment, ""); err != nil {
+					return fmt.Errorf("rule %q: invalid path %q: %v", rule.Name, pattern, err)
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package config
+
+import (
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// reloadDelay is the time to wait for a burst of changes to the config file
+	// (i.e. a ConfigMap update) to settle before reloading
+	reloadDelay = 500 * time.Millisecond
+
+	// kubernetesDataDir is the symlink swapped by the kubelet when a mounted ConfigMap or Secret changes
+	kubernetesDataDir = "..data"
+)
+
+// Reloader resolves the options again from the original arguments, the environment
+// and the config file and applies them when they are valid
+type Reloader struct {
+	args  []string
+	path  string
+	apply func(opts *Options) error
+
+	reloadsTotal      *prometheus.CounterVec
+	lastReloadSuccess prometheus.Gauge
+}
+
+// NewReloader returns a Reloader for the given arguments which passes valid options to apply.
+// The config file at path, if any, is watched for changes when running
+func NewReloader(args []string, path string, apply func(opts *Options) error, reg prometheus.Registerer) *Reloader {
+	return &Reloader{
+		args:  args,
+		path:  path,
+		apply: apply,
+		reloadsTotal: promauto.With(reg).NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "config_reloads_total",
+				Help: "Tracks the number of configuration reloads by result.",
+			}, []string{"result"},
+		),
+		lastReloadSuccess: promauto.With(reg).NewGauge(
+			prometheus.GaugeOpts{
+				Name: "config_last_reload_success_timestamp_seconds",
+				Help: "Timestamp of the last successful configuration reload.",
+			},
+		),
+	}
+}
+
+// Reload resolves and validates the options and applies them. The current configuration
+// is left untouched when the options are invalid
+func (r *Reloader) Reload() error {
+	log.Info("Reloading configuration...")
+	opts, err := Init(r.args)
+	if err == nil {
+		err = r.apply(opts)
+	}
+	if err != nil {
+		log.Errorf("Failed to reload configuration: %v", err)
+		r.reloadsTotal.WithLabelValues("failure").Inc()
+		return err
+	}
+	r.reloadsTotal.WithLabelValues("success").Inc()
+	r.lastReloadSuccess.SetToCurrentTime()
+	return nil
+}
+
+// Run reloads the configuration on SIGHUP and whenever the config file changes
+// until stop is closed
+func (r *Reloader) Run(stop <-chan struct{}) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var events <-chan fsnotify.Event
+	var errors <-chan error
+	if r.path != "" {
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			log.Errorf("Unable to watch config file %q: %v", r.path, err)
+		} else {
+			defer watcher.Close()
+			// watch the directory as editors and the kubelet replace the file instead of writing to it
+			if err := watcher.Add(filepath.Dir(r.path)); err != nil {
+				log.Errorf("Unable to watch config file %q: %v", r.path, err)
+			} else {
+				events = watcher.Events
+				errors = watcher.Errors
+			}
+		}
+	}
+
+	var pending <-chan time.Time
+	for {
+		select {
+		case <-stop:
+			return
+		case <-hup:
+			log.Info("Received SIGHUP")
+			_ = r.Reload()
+		case event := <-events:
+			if r.isConfigChange(event) {
+				log.Debugf("Config file changed: %v", event)
+				pending = time.After(reloadDelay)
+			}
+		case err := <-errors:
+			log.Errorf("Error watching config file %q: %v", r.path, err)
+		case <-pending:
+			pending = nil
+			_ = r.Reload()
+		}
+	}
+}
+
+func (r *Reloader) isConfigChange(event fsnotify.Event) bool {
+	if event.Op == fsnotify.Chmod {
+		return false
+	}
+	name := filepath.Clean(event.Name)
+	return name == filepath.Clean(r.path) || filepath.Base(name) == kubernetesDataDir
+}
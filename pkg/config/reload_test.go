@@ -0,0 +1,101 @@
+package config_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/openshift/elasticsearch-proxy/pkg/config"
+)
+
+var _ = Describe("Reloader", func() {
+
+	var (
+		path     string
+		reg      *prometheus.Registry
+		applied  chan *config.Options
+		applyErr error
+		reloader *config.Reloader
+
+		expectReloads = func(success, failure int) {
+			expected := `
+# HELP config_reloads_total Tracks the number of configuration reloads by result.
+# TYPE config_reloads_total counter
+`
+			if failure > 0 {
+				expected += fmt.Sprintf("config_reloads_total{result=\"failure\"} %d\n", failure)
+			}
+			if success > 0 {
+				expected += fmt.Sprintf("config_reloads_total{result=\"success\"} %d\n", success)
+			}
+			Expect(testutil.GatherAndCompare(reg, strings.NewReader(expected), "config_reloads_total")).To(Succeed())
+		}
+	)
+
+	BeforeEach(func() {
+		path = writeConfigFile("config.yaml", "auth_admin_role: admin\n")
+		reg = prometheus.NewRegistry()
+		applied = make(chan *config.Options, 10)
+		applyErr = nil
+		reloader = config.NewReloader([]string{"--config=" + path}, path, func(opts *config.Options) error {
+			if applyErr != nil {
+				return applyErr
+			}
+			applied <- opts
+			return nil
+		}, reg)
+	})
+
+	Context("when the configuration is valid", func() {
+		It("should apply the options and count the success", func() {
+			Expect(os.WriteFile(path, []byte("auth_admin_role: other_admin\nauth_backend_roles:\n  other_admin:\n    verb: get\n"), 0600)).To(Succeed())
+			Expect(reloader.Reload()).To(Succeed())
+
+			var opts *config.Options
+			Expect(applied).To(Receive(&opts))
+			Expect(opts.AuthAdminRole).To(Equal("other_admin"))
+			Expect(opts.AuthBackEndRoles).To(Equal(map[string]config.BackendRoleConfig{"other_admin": {Verb: "get"}}))
+			expectReloads(1, 0)
+		})
+	})
+
+	Context("when the configuration is invalid", func() {
+		It("should not apply the options and count the failure", func() {
+			Expect(os.WriteFile(path, []byte("http_read_timeout: -1s\n"), 0600)).To(Succeed())
+			Expect(reloader.Reload()).To(Not(Succeed()))
+			Expect(applied).To(Not(Receive()))
+			expectReloads(0, 1)
+		})
+	})
+
+	Context("when the options can not be applied", func() {
+		It("should count the failure", func() {
+			applyErr = errors.New("failed")
+			Expect(reloader.Reload()).To(MatchError("failed"))
+			expectReloads(0, 1)
+		})
+	})
+
+	Context("when running", func() {
+		It("should reload when the config file changes", func() {
+			stop := make(chan struct{})
+			defer close(stop)
+			go reloader.Run(stop)
+
+			// give the watcher time to start before changing the file
+			time.Sleep(100 * time.Millisecond)
+			Expect(os.WriteFile(path, []byte("auth_default_role: reader\n"), 0600)).To(Succeed())
+
+			var opts *config.Options
+			Eventually(applied, 5*time.Second).Should(Receive(&opts))
+			Expect(opts.AuthDefaultRole).To(Equal("reader"))
+		})
+	})
+})
@@ -0,0 +1,155 @@
+package elasticsearch
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/openshift/elasticsearch-proxy/pkg/apis"
+)
+
+const (
+	NamespacePlaceholder = "{namespace}"
+	UIDPlaceholder       = "{uid}"
+
+	//KibanaUserIndexPrefix is followed by the hash of the username in the index of Kibana of a user
+	KibanaUserIndexPrefix = ".kibana."
+)
+
+var (
+	placeholderRE = regexp.MustCompile(`\{[^}]*\}`)
+)
+
+// IndexNaming is the convention the indices of projects are named by. Each pattern
+// is given the name and uid of a project, i.e. app.{namespace}.* or project.{namespace}.{uid}.*
+type IndexNaming struct {
+	patterns []string
+}
+
+// NewIndexNaming returns the naming of the given patterns which must have a
+// placeholder for the project
+func NewIndexNaming(patterns []string) (*IndexNaming, error) {
+	for _, pattern := range patterns {
+		if err := ValidateIndexPattern(pattern); err != nil {
+			return nil, err
+		}
+	}
+	return &IndexNaming{patterns: patterns}, nil
+}
+
+// ValidateIndexPattern returns an error when the pattern has no placeholder for the
+// project or an unknown placeholder
+func ValidateIndexPattern(pattern string) error {
+	if !strings.Contains(pattern, NamespacePlaceholder) && !strings.Contains(pattern, UIDPlaceholder) {
+		return fmt.Errorf("index pattern %q must contain %s or %s", pattern, NamespacePlaceholder, UIDPlaceholder)
+	}
+	for _, placeholder := range placeholderRE.FindAllString(pattern, -1) {
+		if placeholder != NamespacePlaceholder && placeholder != UIDPlaceholder {
+			return fmt.Errorf("index pattern %q has unknown placeholder %s", pattern, placeholder)
+		}
+	}
+	return nil
+}
+
+// ValidateNamespaceDelimiter returns an error when the namespace of the pattern may be followed by
+// characters of the names of other projects, i.e. app-{namespace}-* which for the project foo would
+// match the indices of the project foo-bar. The namespace must end the pattern or be followed by a
+// character namespaces can not contain, such as a dot, or by the uid of the project
+func ValidateNamespaceDelimiter(pattern string) error {
+	for rest := pattern; strings.Contains(rest, NamespacePlaceholder); {
+		rest = rest[strings.Index(rest, NamespacePlaceholder)+len(NamespacePlaceholder):]
+		if rest == "" || strings.Contains(rest, UIDPlaceholder) {
+			continue
+		}
+		if c := rest[0]; c == '-' || c == '*' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' {
+			return fmt.Errorf("index pattern %q must follow %s by a character namespaces can not contain, such as a dot, or by %s", pattern, NamespacePlaceholder, UIDPlaceholder)
+		}
+	}
+	return nil
+}
+
+// Patterns returns the index patterns of the projects
+func (n *IndexNaming) Patterns(projects []apis.Project) []string {
+	patterns := []string{}
+	for _, project := range projects {
+		for _, pattern := range n.patterns {
+			if project.UID == "" && strings.Contains(pattern, UIDPlaceholder) {
+				continue
+			}
+			replacer := strings.NewReplacer(NamespacePlaceholder, project.Name, UIDPlaceholder, project.UID)
+			patterns = append(patterns, replacer.Replace(pattern))
+		}
+	}
+	return patterns
+}
+
+// Permits returns true when every index the target resolves to is matched by any of the patterns.
+// The target may be a pattern itself (i.e. app-foo-*) or use date math (i.e. <app-foo-{now/d}>)
+func Permits(patterns []string, target string) bool {
+	target = ResolveDateMath(target)
+	for _, pattern := range patterns {
+		if contains(pattern, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// KibanaUserIndex returns the index of Kibana of a user. It is named by the SHA-1 of the username so
+// it is stable and a valid index name whatever the username is
+func KibanaUserIndex(username string) string {
+	sum := sha1.Sum([]byte(username))
+	return KibanaUserIndexPrefix + hex.EncodeToString(sum[:])
+}
+
+// PermitsKibanaIndex returns true for the indices of Kibana the user may access, which are every
+// index of Kibana but those of other users
+func PermitsKibanaIndex(username, index string) bool {
+	if !IsKibanaIndex(index) {
+		return false
+	}
+	return !strings.HasPrefix(index, KibanaUserIndexPrefix) || index == KibanaUserIndex(username)
+}
+
+// PatternsWithin returns the patterns whose every index is matched by the target, i.e.
+// app-foo-* for app-* and *
+func PatternsWithin(target string, patterns []string) []string {
+	within := []string{}
+	for _, pattern := range patterns {
+		if contains(target, pattern) {
+			within = append(within, pattern)
+		}
+	}
+	return within
+}
+
+// ResolveDateMath returns the pattern of the indices a date math target resolves to, i.e.
+// app-foo-* for <app-foo-{now/d}>, and other targets as given
+func ResolveDateMath(target string) string {
+	if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+		return target
+	}
+	return placeholderRE.ReplaceAllString(strings.TrimSuffix(strings.TrimPrefix(target, "<"), ">"), "*")
+}
+
+// contains returns true when every name matched by the target is matched by the pattern.
+// Only * is a wildcard, which in the target is only matched by a * of the pattern
+func contains(pattern, target string) bool {
+	if pattern == "" {
+		return target == ""
+	}
+	if pattern[0] == '*' {
+		for i := 0; i <= len(target); i++ {
+			if contains(pattern[1:], target[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if target == "" || target[0] == '*' || target[0] != pattern[0] {
+		return false
+	}
+	return contains(pattern[1:], target[1:])
+}
@@ -0,0 +1,84 @@
+package elasticsearch
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bmizerany/assert"
+
+	"github.com/openshift/elasticsearch-proxy/pkg/apis"
+)
+
+func TestValidateIndexPattern(t *testing.T) {
+	assert.Equal(t, nil, ValidateIndexPattern("app-{namespace}-*"))
+	assert.Equal(t, nil, ValidateIndexPattern("project.{namespace}.{uid}.*"))
+	assert.Equal(t, "index pattern \"app-*\" must contain {namespace} or {uid}", ValidateIndexPattern("app-*").Error())
+	assert.Equal(t, "index pattern \"app-{project}-{namespace}\" has unknown placeholder {project}", ValidateIndexPattern("app-{project}-{namespace}").Error())
+}
+
+func TestValidateNamespaceDelimiter(t *testing.T) {
+	assert.Equal(t, nil, ValidateNamespaceDelimiter("app.{namespace}.*"))
+	assert.Equal(t, nil, ValidateNamespaceDelimiter("app-{namespace}-{uid}-*"))
+	assert.Equal(t, nil, ValidateNamespaceDelimiter("logs-{namespace}"))
+	assert.Equal(t, nil, ValidateNamespaceDelimiter("app-{uid}-*"))
+	// the pattern of the project foo would permit the indices of the project foo-bar
+	assert.Equal(t, true, Permits([]string{"app-foo-*"}, "app-foo-bar-000001"))
+	assert.Equal(t, "index pattern \"app-{namespace}-*\" must follow {namespace} by a character namespaces can not contain, such as a dot, or by {uid}",
+		ValidateNamespaceDelimiter("app-{namespace}-*").Error())
+	assert.NotEqual(t, nil, ValidateNamespaceDelimiter("app-{namespace}*"))
+	assert.Equal(t, false, Permits([]string{"app.foo.*"}, "app.foo-bar.000001"))
+}
+
+func TestIndexNamingPatterns(t *testing.T) {
+	naming, err := NewIndexNaming([]string{"app-{namespace}-*", "project.{namespace}.{uid}.*"})
+	assert.Equal(t, nil, err)
+	patterns := naming.Patterns([]apis.Project{{Name: "foo", UID: "8d5b"}, {Name: "bar"}})
+	assert.Equal(t, []string{"app-foo-*", "project.foo.8d5b.*", "app-bar-*"}, patterns)
+}
+
+func TestPermits(t *testing.T) {
+	patterns := []string{"app-foo-*", "project.foo.8d5b.*"}
+	tests := []struct {
+		target  string
+		permits bool
+	}{
+		{"app-foo-000001", true},
+		{"app-foo-*", true},
+		{"app-foo-2024.*", true},
+		{"project.foo.8d5b.2024.01.02", true},
+		{"project.foo.*", false},
+		{"<app-foo-{now/d}>", true},
+		{"<app-bar-{now/d}>", false},
+		{"app-bar-000001", false},
+		{"app-*", false},
+		{"app-fo*", false},
+		{"*", false},
+		{"infra-000001", false},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.permits, Permits(patterns, test.target), test.target)
+	}
+}
+
+func TestPatternsWithin(t *testing.T) {
+	patterns := []string{"app-foo-*", "app-bar-*", "project.foo.8d5b.*"}
+	assert.Equal(t, patterns, PatternsWithin("*", patterns))
+	assert.Equal(t, []string{"app-foo-*", "app-bar-*"}, PatternsWithin("app-*", patterns))
+	assert.Equal(t, []string{"app-foo-*"}, PatternsWithin("*-foo-*", patterns))
+	assert.Equal(t, []string{}, PatternsWithin("app-foo-2024*", patterns))
+	assert.Equal(t, []string{}, PatternsWithin("infra-*", patterns))
+}
+
+func TestKibanaUserIndex(t *testing.T) {
+	assert.Equal(t, ".kibana.522b276a356bdf39013dfabea2cd43e141ecc9e8", KibanaUserIndex("alice"))
+	assert.Equal(t, true, strings.HasPrefix(KibanaUserIndex("system:serviceaccount:foo:bar"), ".kibana."))
+}
+
+func TestPermitsKibanaIndex(t *testing.T) {
+	assert.Equal(t, true, PermitsKibanaIndex("alice", ".kibana"))
+	assert.Equal(t, true, PermitsKibanaIndex("alice", ".kibana_7.10.0_001"))
+	assert.Equal(t, true, PermitsKibanaIndex("alice", ".kibana_task_manager"))
+	assert.Equal(t, true, PermitsKibanaIndex("alice", KibanaUserIndex("alice")))
+	assert.Equal(t, false, PermitsKibanaIndex("alice", KibanaUserIndex("bob")))
+	assert.Equal(t, false, PermitsKibanaIndex("alice", "app-foo-000001"))
+}
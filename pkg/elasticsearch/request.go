@@ -0,0 +1,406 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Action is what an Elasticsearch request does
+type Action string
+
+const (
+	ActionInfo          Action = "info"
+	ActionSearch        Action = "search"
+	ActionMultiSearch   Action = "msearch"
+	ActionCount         Action = "count"
+	ActionScroll        Action = "scroll"
+	ActionClearScroll   Action = "clear_scroll"
+	ActionAsyncSearch   Action = "async_search"
+	ActionFieldCaps     Action = "field_caps"
+	ActionGet           Action = "get"
+	ActionMultiGet      Action = "mget"
+	ActionIndex         Action = "index"
+	ActionUpdate        Action = "update"
+	ActionDelete        Action = "delete"
+	ActionBulk          Action = "bulk"
+	ActionDeleteByQuery Action = "delete_by_query"
+	ActionUpdateByQuery Action = "update_by_query"
+	ActionReindex       Action = "reindex"
+	ActionCreateIndex   Action = "create_index"
+	ActionDeleteIndex   Action = "delete_index"
+	//ActionIndexMetadata reads the mappings, settings, aliases or statistics of indices
+	ActionIndexMetadata Action = "index_metadata"
+	//ActionIndexAdmin changes the mappings, settings or aliases of indices or their state
+	ActionIndexAdmin Action = "index_admin"
+	ActionCat        Action = "cat"
+	//ActionClusterMonitor reads the state of the cluster
+	ActionClusterMonitor Action = "cluster_monitor"
+	//ActionClusterAdmin changes the cluster or reads or changes its security configuration
+	ActionClusterAdmin Action = "cluster_admin"
+	//ActionKibana is a request of Kibana to its own indices
+	ActionKibana Action = "kibana"
+	//ActionProxy is served by the proxy itself, i.e. /_proxy/whoami, and never forwarded
+	ActionProxy   Action = "proxy"
+	ActionUnknown Action = "unknown"
+)
+
+// Request is an Elasticsearch request classified by its method, path and query
+type Request struct {
+	Action Action
+	//Endpoint is the API of the request without the targets, i.e. _search or _cat/indices.
+	//It is empty for the document APIs given an index and ID
+	Endpoint string
+	//Indices are the indices, aliases, data streams or patterns the request targets as given
+	//in the path. They are empty when the request targets every index or none
+	Indices []string
+	//Format is the format requested for the response, i.e. json for _cat
+	Format string
+}
+
+// TargetsAll returns true when the request is for every index, either by giving none or _all
+// or * as target
+func (r *Request) TargetsAll() bool {
+	if len(r.Indices) == 0 {
+		return true
+	}
+	for _, index := range r.Indices {
+		if index == "_all" || index == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// TargetSegment returns the position of the segment of the path giving the targets of the request,
+// or where they are given when it has none, i.e. 2 for _cat/indices/<target>
+func (r *Request) TargetSegment() int {
+	switch {
+	case strings.HasPrefix(r.Endpoint, "_cat/"), r.Endpoint == "_resolve/index":
+		return 2
+	case r.Endpoint == "_data_stream":
+		return 1
+	}
+	return 0
+}
+
+// Classify returns the classification of the request
+func Classify(req *http.Request) *Request {
+	return ClassifyPath(req.Method, req.URL.EscapedPath(), req.URL.Query())
+}
+
+// ClassifyPath returns the classification of a request given its method, escaped path and query
+func ClassifyPath(method, path string, query url.Values) *Request {
+	segments := SplitPath(path)
+	var r *Request
+	switch {
+	case len(segments) == 0:
+		r = &Request{Action: ActionInfo}
+	case isAPI(segments[0]) && segments[0] != "_all":
+		r = classifyAPI(method, segments)
+	default:
+		r = classifyIndexAPI(method, segments[1:])
+		r.Indices = SplitTargets(segments[0])
+	}
+	r.Format = query.Get("format")
+	if isKibanaRequest(r) {
+		r.Action = ActionKibana
+	}
+	return r
+}
+
+// SplitPath returns the unescaped segments of the path ignoring empty segments so encoded
+// slashes, i.e. of date math index names, are kept within a segment and /_cluster/settings/
+// and //_cluster/settings are given the same segments
+func SplitPath(path string) []string {
+	segments := []string{}
+	for _, segment := range strings.Split(path, "/") {
+		if segment == "" {
+			continue
+		}
+		if unescaped, err := url.PathUnescape(segment); err == nil {
+			segment = unescaped
+		}
+		segments = append(segments, segment)
+	}
+	return segments
+}
+
+// SplitTargets returns the targets of a path segment, or of a value naming indices, separated by
+// commas ignoring empty targets
+func SplitTargets(segment string) []string {
+	targets := []string{}
+	for _, target := range strings.Split(segment, ",") {
+		if target = strings.TrimSpace(target); target != "" {
+			targets = append(targets, target)
+		}
+	}
+	return targets
+}
+
+// MultiSearchTargets returns the targets of the header of a search of a multi search which are given
+// by index or indices, as a string separated by commas or an array. It returns an error when they can
+// not be parsed or both are given, as either may be searched by Elasticsearch
+func MultiSearchTargets(header map[string]json.RawMessage) ([]string, error) {
+	raw, found := header["index"]
+	if indices, given := header["indices"]; given {
+		if found {
+			return nil, errors.New("both index and indices are given")
+		}
+		raw, found = indices, true
+	}
+	if !found {
+		return []string{}, nil
+	}
+	var index string
+	if err := json.Unmarshal(raw, &index); err == nil {
+		return SplitTargets(index), nil
+	}
+	var indices []string
+	if err := json.Unmarshal(raw, &indices); err != nil {
+		return nil, errors.New("the index can not be parsed")
+	}
+	targets := []string{}
+	for _, index := range indices {
+		targets = append(targets, SplitTargets(index)...)
+	}
+	return targets, nil
+}
+
+// SkipsMultiSearchLine returns true for the lines of a multi search body Elasticsearch skips instead
+// of reading them as the header of a search, which is only an empty first line
+func SkipsMultiSearchLine(number int, line []byte) bool {
+	return number == 1 && len(line) == 1 && line[0] == '\n'
+}
+
+func isAPI(segment string) bool {
+	return strings.HasPrefix(segment, "_")
+}
+
+func isRead(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead
+}
+
+// classifyAPI classifies the requests which do not start with a target
+func classifyAPI(method string, segments []string) *Request {
+	api := segments[0]
+	switch api {
+	case "_search":
+		if len(segments) > 1 {
+			switch segments[1] {
+			case "scroll":
+				if method == http.MethodDelete {
+					return &Request{Action: ActionClearScroll, Endpoint: "_search/scroll"}
+				}
+				return &Request{Action: ActionScroll, Endpoint: "_search/scroll"}
+			case "template", "point_in_time":
+				return &Request{Action: ActionSearch, Endpoint: "_search/" + segments[1]}
+			}
+		}
+		return &Request{Action: ActionSearch, Endpoint: api}
+	case "_cat":
+		return classifyCat(segments)
+	case "_resolve":
+		// _resolve/index/<name>
+		r := &Request{Action: ActionIndexMetadata, Endpoint: strings.Join(segments[:min(2, len(segments))], "/")}
+		if len(segments) > 2 {
+			r.Indices = SplitTargets(segments[2])
+		}
+		return r
+	case "_data_stream":
+		r := &Request{Action: ActionIndexAdmin, Endpoint: api}
+		if isRead(method) {
+			r.Action = ActionIndexMetadata
+		}
+		if len(segments) > 1 && !isAPI(segments[1]) {
+			r.Indices = SplitTargets(segments[1])
+		}
+		return r
+	case "_aliases", "_alias", "_mapping", "_mappings", "_settings":
+		// aliases are changed with POST _aliases and read otherwise
+		if isRead(method) {
+			return &Request{Action: ActionIndexMetadata, Endpoint: api}
+		}
+		return &Request{Action: ActionIndexAdmin, Endpoint: api}
+	case "_reindex":
+		return &Request{Action: ActionReindex, Endpoint: api}
+	case "_nodes", "_cluster", "_tasks", "_xpack", "_license", "_remote", "_ingest",
+		"_template", "_index_template", "_component_template", "_scripts", "_snapshot",
+		"_ilm", "_slm", "_ml", "_rollup", "_transform", "_watcher", "_ccr", "_autoscaling",
+		"_features", "_migration", "_script_context", "_script_language":
+		if isRead(method) {
+			return &Request{Action: ActionClusterMonitor, Endpoint: api}
+		}
+		return &Request{Action: ActionClusterAdmin, Endpoint: api}
+	case "_proxy":
+		return &Request{Action: ActionProxy, Endpoint: strings.Join(segments[:min(2, len(segments))], "/")}
+	case "_security", "_opendistro", "_plugins":
+		// the security configuration of Elasticsearch and the plugins of OpenSearch are
+		// administrative even when read
+		return &Request{Action: ActionClusterAdmin, Endpoint: api}
+	}
+	if r := classifyTargetedAPI(method, segments); r != nil {
+		return r
+	}
+	return &Request{Action: ActionUnknown, Endpoint: api}
+}
+
+// classifyCat classifies _cat/<api>[/<target>] where the targets are indices for the
+// APIs listing indices or their shards
+func classifyCat(segments []string) *Request {
+	r := &Request{Action: ActionCat, Endpoint: "_cat"}
+	if len(segments) < 2 {
+		return r
+	}
+	r.Endpoint = "_cat/" + segments[1]
+	if len(segments) > 2 {
+		switch segments[1] {
+		case "indices", "shards", "segments", "count", "recovery":
+			r.Indices = SplitTargets(segments[2])
+		}
+	}
+	return r
+}
+
+// classifyIndexAPI classifies the rest of a request which starts with its targets
+func classifyIndexAPI(method string, segments []string) *Request {
+	if len(segments) == 0 {
+		switch method {
+		case http.MethodPut:
+			return &Request{Action: ActionCreateIndex}
+		case http.MethodDelete:
+			return &Request{Action: ActionDeleteIndex}
+		case http.MethodGet, http.MethodHead:
+			return &Request{Action: ActionIndexMetadata}
+		}
+		return &Request{Action: ActionUnknown}
+	}
+	if segments[0] == "_doc" || !isAPI(segments[0]) {
+		// _doc is the type of typeless document APIs and any other name the mapping type of ES6
+		return classifyDocument(method, segments[0], segments[1:])
+	}
+	if r := classifyTargetedAPI(method, segments); r != nil {
+		return r
+	}
+	return &Request{Action: ActionUnknown, Endpoint: segments[0]}
+}
+
+// classifyTargetedAPI classifies the APIs which can be given targets. It returns nil for
+// the APIs it does not know
+func classifyTargetedAPI(method string, segments []string) *Request {
+	api := segments[0]
+	switch api {
+	case "_search":
+		if len(segments) > 1 && (segments[1] == "template" || segments[1] == "point_in_time") {
+			return &Request{Action: ActionSearch, Endpoint: "_search/" + segments[1]}
+		}
+		return &Request{Action: ActionSearch, Endpoint: api}
+	case "_msearch":
+		if len(segments) > 1 && segments[1] == "template" {
+			return &Request{Action: ActionMultiSearch, Endpoint: "_msearch/template"}
+		}
+		return &Request{Action: ActionMultiSearch, Endpoint: api}
+	case "_count":
+		return &Request{Action: ActionCount, Endpoint: api}
+	case "_async_search":
+		return &Request{Action: ActionAsyncSearch, Endpoint: api}
+	case "_field_caps":
+		return &Request{Action: ActionFieldCaps, Endpoint: api}
+	case "_explain", "_validate", "_termvectors", "_mtermvectors", "_terms_enum",
+		"_search_shards", "_rank_eval", "_pit", "_render", "_knn_search":
+		return &Request{Action: ActionSearch, Endpoint: api}
+	case "_mget":
+		return &Request{Action: ActionMultiGet, Endpoint: api}
+	case "_bulk":
+		return &Request{Action: ActionBulk, Endpoint: api}
+	case "_create":
+		return &Request{Action: ActionIndex, Endpoint: api}
+	case "_update":
+		return &Request{Action: ActionUpdate, Endpoint: api}
+	case "_source":
+		return &Request{Action: ActionGet, Endpoint: api}
+	case "_delete_by_query":
+		return &Request{Action: ActionDeleteByQuery, Endpoint: api}
+	case "_update_by_query":
+		return &Request{Action: ActionUpdateByQuery, Endpoint: api}
+	case "_mapping", "_mappings", "_settings", "_alias", "_aliases", "_ilm":
+		if isRead(method) {
+			return &Request{Action: ActionIndexMetadata, Endpoint: api}
+		}
+		return &Request{Action: ActionIndexAdmin, Endpoint: api}
+	case "_stats", "_segments", "_recovery", "_shard_stores", "_field_usage_stats":
+		return &Request{Action: ActionIndexMetadata, Endpoint: api}
+	case "_refresh", "_flush", "_forcemerge", "_cache", "_open", "_close", "_rollover",
+		"_shrink", "_split", "_clone", "_freeze", "_unfreeze", "_upgrade", "_block", "_disk_usage":
+		return &Request{Action: ActionIndexAdmin, Endpoint: api}
+	}
+	return nil
+}
+
+// classifyDocument classifies <type>/<id>[/<api>] of the document APIs as well as the
+// APIs given a mapping type in ES6, i.e. <type>/_search
+func classifyDocument(method, docType string, segments []string) *Request {
+	if len(segments) == 0 {
+		// documents are indexed with a generated ID by POST <index>/<type>
+		if method == http.MethodPost || method == http.MethodPut {
+			return &Request{Action: ActionIndex, Endpoint: docType}
+		}
+		return &Request{Action: ActionUnknown, Endpoint: docType}
+	}
+	if isAPI(segments[0]) {
+		if r := classifyTargetedAPI(method, segments); r != nil {
+			return r
+		}
+		// IDs may start with an underscore
+		if docType != "_doc" {
+			return &Request{Action: ActionUnknown, Endpoint: segments[0]}
+		}
+	}
+	if len(segments) > 1 {
+		switch segments[1] {
+		case "_update":
+			return &Request{Action: ActionUpdate, Endpoint: segments[1]}
+		case "_create":
+			return &Request{Action: ActionIndex, Endpoint: segments[1]}
+		case "_source":
+			return &Request{Action: ActionGet, Endpoint: segments[1]}
+		case "_explain", "_termvectors":
+			return &Request{Action: ActionSearch, Endpoint: segments[1]}
+		}
+		return &Request{Action: ActionUnknown, Endpoint: segments[1]}
+	}
+	switch method {
+	case http.MethodGet, http.MethodHead:
+		return &Request{Action: ActionGet}
+	case http.MethodPut, http.MethodPost:
+		return &Request{Action: ActionIndex}
+	case http.MethodDelete:
+		return &Request{Action: ActionDelete}
+	}
+	return &Request{Action: ActionUnknown}
+}
+
+// IsKibanaIndex returns true for the indices Kibana stores its saved objects and state in
+func IsKibanaIndex(index string) bool {
+	return strings.HasPrefix(index, ".kibana")
+}
+
+// isKibanaRequest returns true when the request reads or writes documents of Kibana indices
+// only. Changing the indices themselves is classified as such
+func isKibanaRequest(r *Request) bool {
+	if len(r.Indices) == 0 || r.Action == ActionCat {
+		return false
+	}
+	switch r.Action {
+	case ActionCreateIndex, ActionDeleteIndex, ActionIndexAdmin, ActionUnknown:
+		return false
+	}
+	for _, index := range r.Indices {
+		if !IsKibanaIndex(index) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,221 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestClassifyPath(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		action   Action
+		endpoint string
+		indices  []string
+	}{
+		{"info", "GET", "/", ActionInfo, "", nil},
+		{"ping", "HEAD", "/", ActionInfo, "", nil},
+
+		// search
+		{"search all", "GET", "/_search", ActionSearch, "_search", nil},
+		{"search index", "POST", "/app-foo-000001/_search", ActionSearch, "_search", []string{"app-foo-000001"}},
+		{"search indices", "GET", "/app-foo-*,infra-*/_search", ActionSearch, "_search", []string{"app-foo-*", "infra-*"}},
+		{"search _all", "GET", "/_all/_search", ActionSearch, "_search", []string{"_all"}},
+		{"search date math", "GET", "/%3Capp-%7Bnow%2Fd%7D%3E/_search", ActionSearch, "_search", []string{"<app-{now/d}>"}},
+		{"search ES6 type", "GET", "/project.foo.123/com.example.viaq.common/_search", ActionSearch, "_search", []string{"project.foo.123"}},
+		{"search template", "POST", "/app-*/_search/template", ActionSearch, "_search/template", []string{"app-*"}},
+		{"explain", "GET", "/app-foo/_explain/1", ActionSearch, "_explain", []string{"app-foo"}},
+		{"validate query", "GET", "/app-foo/_validate/query", ActionSearch, "_validate", []string{"app-foo"}},
+		{"open point in time ES7", "POST", "/app-foo/_pit", ActionSearch, "_pit", []string{"app-foo"}},
+		{"open point in time OpenSearch", "POST", "/app-foo/_search/point_in_time", ActionSearch, "_search/point_in_time", []string{"app-foo"}},
+		{"close point in time OpenSearch", "DELETE", "/_search/point_in_time", ActionSearch, "_search/point_in_time", nil},
+		{"msearch", "POST", "/_msearch", ActionMultiSearch, "_msearch", nil},
+		{"msearch index", "POST", "/app-foo/_msearch", ActionMultiSearch, "_msearch", []string{"app-foo"}},
+		{"msearch template", "POST", "/_msearch/template", ActionMultiSearch, "_msearch/template", nil},
+		{"count", "GET", "/app-foo/_count", ActionCount, "_count", []string{"app-foo"}},
+		{"scroll", "POST", "/_search/scroll", ActionScroll, "_search/scroll", nil},
+		{"scroll ES6 id in path", "GET", "/_search/scroll/DXF1ZXJ5", ActionScroll, "_search/scroll", nil},
+		{"clear scroll", "DELETE", "/_search/scroll", ActionClearScroll, "_search/scroll", nil},
+		{"async search", "POST", "/app-foo/_async_search", ActionAsyncSearch, "_async_search", []string{"app-foo"}},
+		{"get async search", "GET", "/_async_search/FmRldE8zREVEUzA2ZVpUeGs2ejJFUFEaMkZ5QTVrSTZSaVN3WlNFVmtlWHJsdzoxMDc=", ActionAsyncSearch, "_async_search", nil},
+		{"field caps", "GET", "/app-*/_field_caps", ActionFieldCaps, "_field_caps", []string{"app-*"}},
+		{"field caps all", "GET", "/_field_caps", ActionFieldCaps, "_field_caps", nil},
+
+		// documents
+		{"get ES7", "GET", "/app-foo/_doc/1", ActionGet, "", []string{"app-foo"}},
+		{"get ES6", "GET", "/project.foo.123/com.example.viaq.common/1", ActionGet, "", []string{"project.foo.123"}},
+		{"exists", "HEAD", "/app-foo/_doc/1", ActionGet, "", []string{"app-foo"}},
+		{"get source", "GET", "/app-foo/_source/1", ActionGet, "_source", []string{"app-foo"}},
+		{"get source ES6", "GET", "/app-foo/doc/1/_source", ActionGet, "_source", []string{"app-foo"}},
+		{"mget", "POST", "/_mget", ActionMultiGet, "_mget", nil},
+		{"index with ID", "PUT", "/app-foo/_doc/1", ActionIndex, "", []string{"app-foo"}},
+		{"index generated ID", "POST", "/app-foo/_doc", ActionIndex, "_doc", []string{"app-foo"}},
+		{"index ES6 generated ID", "POST", "/app-foo/doc", ActionIndex, "doc", []string{"app-foo"}},
+		{"create", "PUT", "/app-foo/_create/1", ActionIndex, "_create", []string{"app-foo"}},
+		{"create ES6", "PUT", "/app-foo/doc/1/_create", ActionIndex, "_create", []string{"app-foo"}},
+		{"update", "POST", "/app-foo/_update/1", ActionUpdate, "_update", []string{"app-foo"}},
+		{"update ES6", "POST", "/app-foo/_doc/1/_update", ActionUpdate, "_update", []string{"app-foo"}},
+		{"delete", "DELETE", "/app-foo/_doc/1", ActionDelete, "", []string{"app-foo"}},
+		{"bulk", "POST", "/_bulk", ActionBulk, "_bulk", nil},
+		{"bulk index", "POST", "/app-foo/_bulk", ActionBulk, "_bulk", []string{"app-foo"}},
+		{"bulk ES6 type", "POST", "/app-foo/doc/_bulk", ActionBulk, "_bulk", []string{"app-foo"}},
+		{"delete by query", "POST", "/app-foo/_delete_by_query", ActionDeleteByQuery, "_delete_by_query", []string{"app-foo"}},
+		{"update by query", "POST", "/app-foo/_update_by_query", ActionUpdateByQuery, "_update_by_query", []string{"app-foo"}},
+		{"reindex", "POST", "/_reindex", ActionReindex, "_reindex", nil},
+
+		// indices
+		{"create index", "PUT", "/app-foo", ActionCreateIndex, "", []string{"app-foo"}},
+		{"delete index", "DELETE", "/app-foo,app-bar", ActionDeleteIndex, "", []string{"app-foo", "app-bar"}},
+		{"get index", "GET", "/app-foo", ActionIndexMetadata, "", []string{"app-foo"}},
+		{"get mapping", "GET", "/app-foo/_mapping", ActionIndexMetadata, "_mapping", []string{"app-foo"}},
+		{"get mapping ES6 type", "GET", "/app-foo/_mapping/doc", ActionIndexMetadata, "_mapping", []string{"app-foo"}},
+		{"get all mappings", "GET", "/_mapping", ActionIndexMetadata, "_mapping", nil},
+		{"put mapping", "PUT", "/app-foo/_mapping", ActionIndexAdmin, "_mapping", []string{"app-foo"}},
+		{"put mapping ES6 type", "PUT", "/app-foo/doc/_mapping", ActionIndexAdmin, "_mapping", []string{"app-foo"}},
+		{"get settings", "GET", "/app-foo/_settings", ActionIndexMetadata, "_settings", []string{"app-foo"}},
+		{"put settings", "PUT", "/app-foo/_settings", ActionIndexAdmin, "_settings", []string{"app-foo"}},
+		{"get aliases", "GET", "/_aliases", ActionIndexMetadata, "_aliases", nil},
+		{"update aliases", "POST", "/_aliases", ActionIndexAdmin, "_aliases", nil},
+		{"get alias", "GET", "/app-foo/_alias/app-write", ActionIndexMetadata, "_alias", []string{"app-foo"}},
+		{"put alias", "PUT", "/app-foo/_alias/app-write", ActionIndexAdmin, "_alias", []string{"app-foo"}},
+		{"index stats", "GET", "/app-foo/_stats", ActionIndexMetadata, "_stats", []string{"app-foo"}},
+		{"all stats", "GET", "/_stats", ActionIndexMetadata, "_stats", nil},
+		{"refresh", "POST", "/app-foo/_refresh", ActionIndexAdmin, "_refresh", []string{"app-foo"}},
+		{"refresh all", "POST", "/_refresh", ActionIndexAdmin, "_refresh", nil},
+		{"rollover", "POST", "/app-write/_rollover", ActionIndexAdmin, "_rollover", []string{"app-write"}},
+		{"close", "POST", "/app-foo/_close", ActionIndexAdmin, "_close", []string{"app-foo"}},
+		{"resolve index", "GET", "/_resolve/index/app-*", ActionIndexMetadata, "_resolve/index", []string{"app-*"}},
+		{"get data stream", "GET", "/_data_stream/logs-app", ActionIndexMetadata, "_data_stream", []string{"logs-app"}},
+		{"delete data stream", "DELETE", "/_data_stream/logs-app", ActionIndexAdmin, "_data_stream", []string{"logs-app"}},
+		{"data stream stats", "GET", "/_data_stream/_stats", ActionIndexMetadata, "_data_stream", nil},
+
+		// cat
+		{"cat", "GET", "/_cat", ActionCat, "_cat", nil},
+		{"cat indices", "GET", "/_cat/indices", ActionCat, "_cat/indices", nil},
+		{"cat indices pattern", "GET", "/_cat/indices/app-*", ActionCat, "_cat/indices", []string{"app-*"}},
+		{"cat aliases", "GET", "/_cat/aliases/app-write", ActionCat, "_cat/aliases", nil},
+		{"cat health", "GET", "/_cat/health", ActionCat, "_cat/health", nil},
+
+		// cluster
+		{"cluster health", "GET", "/_cluster/health", ActionClusterMonitor, "_cluster", nil},
+		{"nodes stats", "GET", "/_nodes/stats", ActionClusterMonitor, "_nodes", nil},
+		{"cluster settings", "PUT", "/_cluster/settings", ActionClusterAdmin, "_cluster", nil},
+		{"get template", "GET", "/_template/common.all", ActionClusterMonitor, "_template", nil},
+		{"put index template", "PUT", "/_index_template/logs", ActionClusterAdmin, "_index_template", nil},
+		{"cancel task", "POST", "/_tasks/oTUltX4IQMOUUVeiohTt8A:12345/_cancel", ActionClusterAdmin, "_tasks", nil},
+		{"create snapshot", "PUT", "/_snapshot/backup/snapshot_1", ActionClusterAdmin, "_snapshot", nil},
+		{"security ES", "GET", "/_security/user", ActionClusterAdmin, "_security", nil},
+		{"security OpenDistro", "GET", "/_opendistro/_security/api/roles", ActionClusterAdmin, "_opendistro", nil},
+		{"security OpenSearch", "GET", "/_plugins/_security/api/roles", ActionClusterAdmin, "_plugins", nil},
+		{"ISM OpenSearch", "GET", "/_plugins/_ism/explain/app-foo", ActionClusterAdmin, "_plugins", nil},
+
+		// proxy
+		{"whoami", "GET", "/_proxy/whoami", ActionProxy, "_proxy/whoami", nil},
+		{"admin cache", "DELETE", "/_proxy/admin/cache/users/alice", ActionProxy, "_proxy/admin", nil},
+
+		// kibana
+		{"kibana search", "POST", "/.kibana/_search", ActionKibana, "_search", []string{".kibana"}},
+		{"kibana get", "GET", "/.kibana_1/_doc/config:7.10.2", ActionKibana, "", []string{".kibana_1"}},
+		{"kibana ES6 get", "GET", "/.kibana/doc/config:6.8.1", ActionKibana, "", []string{".kibana"}},
+		{"kibana task manager", "POST", "/.kibana_task_manager/_update_by_query", ActionKibana, "_update_by_query", []string{".kibana_task_manager"}},
+		{"kibana create index", "PUT", "/.kibana_2", ActionCreateIndex, "", []string{".kibana_2"}},
+		{"kibana and app", "POST", "/.kibana,app-foo/_search", ActionSearch, "_search", []string{".kibana", "app-foo"}},
+
+		// unknown
+		{"unknown API", "GET", "/_unknown", ActionUnknown, "_unknown", nil},
+		{"unknown index API", "GET", "/app-foo/_unknown/1/2", ActionUnknown, "_unknown", []string{"app-foo"}},
+		{"post index", "POST", "/app-foo", ActionUnknown, "", []string{"app-foo"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := ClassifyPath(test.method, test.path, url.Values{})
+			assert.Equal(t, test.action, r.Action)
+			assert.Equal(t, test.endpoint, r.Endpoint)
+			if len(test.indices) == 0 {
+				assert.Equal(t, 0, len(r.Indices))
+			} else {
+				assert.Equal(t, test.indices, r.Indices)
+			}
+		})
+	}
+}
+
+func TestClassify(t *testing.T) {
+	r := Classify(httptest.NewRequest("GET", "/_cat/indices/app-foo%2A?format=json&h=index", nil))
+	assert.Equal(t, ActionCat, r.Action)
+	assert.Equal(t, []string{"app-foo*"}, r.Indices)
+	assert.Equal(t, "json", r.Format)
+}
+
+func TestTargetsAll(t *testing.T) {
+	tests := []struct {
+		indices []string
+		all     bool
+	}{
+		{nil, true},
+		{[]string{"_all"}, true},
+		{[]string{"*"}, true},
+		{[]string{"app-foo", "*"}, true},
+		{[]string{"app-*"}, false},
+		{[]string{"app-foo"}, false},
+	}
+	for _, test := range tests {
+		r := &Request{Indices: test.indices}
+		assert.Equal(t, test.all, r.TargetsAll())
+	}
+}
+
+func TestTargetSegment(t *testing.T) {
+	tests := []struct {
+		method  string
+		path    string
+		segment int
+	}{
+		{"GET", "/app-foo/_search", 0},
+		{"GET", "/_search", 0},
+		{"GET", "/app-foo/_doc/1", 0},
+		{"GET", "/_cat/indices/app-foo", 2},
+		{"GET", "/_cat/shards", 2},
+		{"GET", "/_resolve/index/app-*", 2},
+		{"GET", "/_data_stream/logs-app", 1},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.segment, ClassifyPath(test.method, test.path, url.Values{}).TargetSegment(), test.path)
+	}
+}
+
+func TestSkipsMultiSearchLine(t *testing.T) {
+	assert.Equal(t, true, SkipsMultiSearchLine(1, []byte("\n")))
+	assert.Equal(t, false, SkipsMultiSearchLine(3, []byte("\n")))
+	assert.Equal(t, false, SkipsMultiSearchLine(1, []byte("{}\n")))
+}
+
+func TestMultiSearchTargets(t *testing.T) {
+	tests := []struct {
+		header  string
+		targets []string
+		err     string
+	}{
+		{`{}`, []string{}, ""},
+		{`{"index":"app-foo-*, app-bar-*"}`, []string{"app-foo-*", "app-bar-*"}, ""},
+		{`{"indices":["app-foo-*","app-bar-1,app-bar-2"]}`, []string{"app-foo-*", "app-bar-1", "app-bar-2"}, ""},
+		{`{"index":"app-foo-*","indices":"app-bar-*"}`, nil, "both index and indices are given"},
+		{`{"index":1}`, nil, "the index can not be parsed"},
+	}
+	for _, test := range tests {
+		header := map[string]json.RawMessage{}
+		assert.Equal(t, nil, json.Unmarshal([]byte(test.header), &header))
+		targets, err := MultiSearchTargets(header)
+		assert.Equal(t, test.targets, targets)
+		if test.err == "" {
+			assert.Equal(t, nil, err)
+		} else {
+			assert.Equal(t, test.err, err.Error())
+		}
+	}
+}
@@ -5,7 +5,10 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"k8s.io/apimachinery/pkg/util/sets"
@@ -13,6 +16,7 @@ import (
 	"github.com/openshift/elasticsearch-proxy/pkg/clients"
 	"github.com/openshift/elasticsearch-proxy/pkg/config"
 	"github.com/openshift/elasticsearch-proxy/pkg/handlers"
+	"github.com/openshift/elasticsearch-proxy/pkg/util"
 )
 
 const (
@@ -25,6 +29,8 @@ const (
 )
 
 type authorizationHandler struct {
+	//lock guards config which is replaced on Reload
+	lock               sync.RWMutex
 	config             *config.Options
 	osClient           clients.OpenShiftClient
 	cache              *rolesService
@@ -50,33 +56,97 @@ func (auth *authorizationHandler) Name() string {
 	return "authorization"
 }
 
+// Reload replaces the backend roles, admin role and default role with those of the given options
+// and invalidates the cached roles of every user. Other options require a restart
+func (auth *authorizationHandler) Reload(opts *config.Options) error {
+	auth.lock.Lock()
+	defer auth.lock.Unlock()
+
+	cfg := *auth.config
+	cfg.AuthBackEndRoles = opts.AuthBackEndRoles
+	cfg.AuthRoleExpressions = opts.AuthRoleExpressions
+	cfg.AuthAdminRole = opts.AuthAdminRole
+	cfg.AuthDefaultRole = opts.AuthDefaultRole
+	auth.config = &cfg
+	auth.cache.reload(opts.AuthBackEndRoles)
+
+	log.Infof("Reloaded %d backend roles with admin role %q and default role %q", len(cfg.AuthBackEndRoles), cfg.AuthAdminRole, cfg.AuthDefaultRole)
+	return nil
+}
+
+// CachedIdentities returns the users whose roles and projects are cached
+func (auth *authorizationHandler) CachedIdentities() []handlers.CachedIdentity {
+	identities := []handlers.CachedIdentity{}
+	now := time.Now()
+	for _, entry := range auth.cache.entries() {
+		roles := make([]string, 0, len(entry.roles))
+		for role := range entry.roles {
+			roles = append(roles, role)
+		}
+		sort.Strings(roles)
+		identities = append(identities, handlers.CachedIdentity{
+			Username:     entry.review.UserName(),
+			Roles:        roles,
+			ProjectCount: len(entry.projects),
+			Age:          now.Sub(entry.loadedAt).Truncate(time.Second).String(),
+		})
+	}
+	sort.Slice(identities, func(i, j int) bool {
+		return identities[i].Username < identities[j].Username
+	})
+	return identities
+}
+
+// EvictUser removes the cached roles and projects of a user
+func (auth *authorizationHandler) EvictUser(username string) int {
+	evicted := auth.cache.evict(username)
+	log.Infof("Evicted %d cached entries of user %q", evicted, username)
+	return evicted
+}
+
+// FlushCache removes the cached roles and projects of every user
+func (auth *authorizationHandler) FlushCache() int {
+	flushed := auth.cache.flush()
+	log.Infof("Flushed %d cached entries", flushed)
+	return flushed
+}
+
+func (auth *authorizationHandler) currentConfig() *config.Options {
+	auth.lock.RLock()
+	defer auth.lock.RUnlock()
+	return auth.config
+}
+
 // Process the request for authorization. The handler first attempts to get userinfo using bearer token
 // and falls back to the certificate subject or fails
 func (auth *authorizationHandler) Process(req *http.Request) (*http.Request, error) {
-	log.Tracef("Processing request in handler %q", auth.Name())
-	log.Tracef("ContentLength: %v ", req.ContentLength)
-	log.Tracef("Headers: %v ", req.Header)
+	logger := handlers.Logger(req.Context())
+	logger.Tracef("Processing request in handler %q", auth.Name())
+	logger.Tracef("ContentLength: %v ", req.ContentLength)
+	logger.Tracef("Headers: %v ", util.RedactHeaders(req.Header))
 
+	cfg := auth.currentConfig()
 	ctx := req.Context()
 	token := getBearerTokenFrom(req)
 	sanitizeHeaders(req)
 
 	if token != "" {
-		log.Trace("Handling a request with token...")
+		logger.Trace("Handling a request with token...")
 
-		rolesProjects, err := auth.cache.getRolesAndProjects(token)
+		rolesProjects, err := auth.cache.getRolesAndProjects(req.Context(), token)
 		if err != nil {
 			return req, err
 		}
 
 		username := rolesProjects.review.UserName()
 		if username == "" {
-			log.Trace("Unable to determine a user's identify from bearer token")
+			logger.Trace("Unable to determine a user's identify from bearer token")
 			return req, errors.New("Unable to determine username")
 		}
 
 		req.Header.Set(headerForwardedUser, username)
 		ctx = context.WithValue(ctx, handlers.UsernameKey, username)
+		ctx = context.WithValue(ctx, handlers.AuthMethodKey, handlers.AuthMethodToken)
 
 		projects := rolesProjects.projects
 
@@ -88,23 +158,31 @@ func (auth *authorizationHandler) Process(req *http.Request) (*http.Request, err
 		req.Header.Add(headerForwardedNamespace, strings.Join(projectNames, ","))
 		ctx = context.WithValue(ctx, handlers.ProjectsKey, projects)
 
+		identity := config.Identity{
+			Username:     username,
+			Groups:       rolesProjects.review.Groups(),
+			Extra:        rolesProjects.review.Extra(),
+			Subject:      auth.fnSubjectExtractor(req),
+			ProjectCount: len(projects),
+		}
+
 		var roles []string
 
-		for name := range auth.config.AuthBackEndRoles {
-			if _, ok := rolesProjects.roles[name]; ok {
+		for name := range cfg.AuthBackEndRoles {
+			if _, ok := rolesProjects.roles[name]; ok && evaluateExpression(logger, cfg, name, identity) {
 				roles = append(roles, name)
 			}
 		}
 
-		if len(roles) == 0 && auth.config.AuthDefaultRole != "" {
-			log.Debugf("User has no roles. Adding default role: %s", auth.config.AuthDefaultRole)
-			roles = append(roles, auth.config.AuthDefaultRole)
+		if len(roles) == 0 && cfg.AuthDefaultRole != "" {
+			logger.Debugf("User has no roles. Adding default role: %s", cfg.AuthDefaultRole)
+			roles = append(roles, cfg.AuthDefaultRole)
 		}
 
 		rs := sets.NewString(roles...)
-		if rs.Has(auth.config.AuthAdminRole) {
-			log.Debugf("User has the configurated admin role %v. Removing all other roles.", auth.config.AuthAdminRole)
-			roles = []string{auth.config.AuthAdminRole}
+		if rs.Has(cfg.AuthAdminRole) {
+			logger.Debugf("User has the configurated admin role %v. Removing all other roles.", cfg.AuthAdminRole)
+			roles = []string{cfg.AuthAdminRole}
 			rs = sets.NewString(roles...)
 		}
 
@@ -112,24 +190,63 @@ func (auth *authorizationHandler) Process(req *http.Request) (*http.Request, err
 		ctx = context.WithValue(ctx, handlers.RolesKey, roles)
 
 	} else {
-		log.Trace("Handling a request without token...")
+		logger.Trace("Handling a request without token...")
 
 		subject := auth.fnSubjectExtractor(req)
 		if strings.TrimSpace(subject) == "" {
-			log.Trace("Unable to determine a user's identify from certificate subject")
+			logger.Trace("Unable to determine a user's identify from certificate subject")
 			return req, errors.New("Unable to determine username")
 		}
 
 		req.Header.Set(headerForwardedUser, subject)
 		ctx = context.WithValue(ctx, handlers.SubjectKey, subject)
+		ctx = context.WithValue(ctx, handlers.AuthMethodKey, handlers.AuthMethodCertificate)
+
+		if roles := certificateRoles(logger, cfg, subject); len(roles) > 0 {
+			req.Header.Add(headerForwardedRoles, strings.Join(roles, ","))
+			ctx = context.WithValue(ctx, handlers.RolesKey, roles)
+		}
 	}
 
 	req.Header.Add(headerForwardedFor, "localhost")
-	log.Tracef("Authenticated user %q", req.Header.Get(headerForwardedUser))
+	logger.Tracef("Authenticated user %q", req.Header.Get(headerForwardedUser))
 
 	return req.WithContext(ctx), nil
 }
 
+// evaluateExpression returns true if the backend role has no expression or its expression
+// holds for the identity
+func evaluateExpression(logger *log.Entry, cfg *config.Options, name string, identity config.Identity) bool {
+	expression, found := cfg.AuthRoleExpressions[name]
+	if !found {
+		return true
+	}
+	allowed, err := expression.Evaluate(identity)
+	if err != nil {
+		logger.Warnf("Unable to evaluate %s expression for user %q: %v", name, identity.Username, err)
+		return false
+	}
+	logger.Debugf("%q for %q expression: %v", identity.Username, name, allowed)
+	return allowed
+}
+
+// certificateRoles returns the backend roles given to a certificate subject. Only roles
+// whose rule is an expression can be evaluated without a token
+func certificateRoles(logger *log.Entry, cfg *config.Options, subject string) []string {
+	identity := config.Identity{Subject: subject}
+	roles := []string{}
+	for name, rule := range cfg.AuthBackEndRoles {
+		if rule.IsExpressionOnly() && evaluateExpression(logger, cfg, name, identity) {
+			roles = append(roles, name)
+		}
+	}
+	if sets.NewString(roles...).Has(cfg.AuthAdminRole) {
+		return []string{cfg.AuthAdminRole}
+	}
+	sort.Strings(roles)
+	return roles
+}
+
 func sanitizeHeaders(req *http.Request) {
 	req.Header.Del(headerAuthorization)
 	req.Header.Del(headerForwardedRoles)
@@ -58,6 +58,7 @@ var _ = Describe("Process", func() {
 			})
 			It("should store subject into the request context", func() {
 				Expect(req.Context().Value(handlers.SubjectKey)).To(Equal("CN=foo,OU=org-unit,O=org"))
+				Expect(req.Context().Value(handlers.AuthMethodKey)).To(Equal(handlers.AuthMethodCertificate))
 			})
 		})
 		Context("with empty bearer token and does not error", func() {
@@ -68,6 +69,20 @@ var _ = Describe("Process", func() {
 				Expect(req.Header.Get("X-Forwarded-User")).To(Equal("CN=foo,OU=org-unit,O=org"))
 			})
 		})
+		Context("and a backend role is given by an expression", func() {
+			BeforeEach(func() {
+				expression, err := config.CompileRoleExpression(`subject.startsWith("CN=foo,")`)
+				Expect(err).To(BeNil())
+				handler.config.AuthBackEndRoles["cert_reader"] = config.BackendRoleConfig{Expression: expression.String()}
+				handler.config.AuthRoleExpressions = map[string]*config.RoleExpression{"cert_reader": expression}
+				req, err = handler.Process(req)
+				Expect(err).To(BeNil())
+			})
+			It("should add the roles whose expression holds for the subject", func() {
+				Expect(req.Header["X-Forwarded-Roles"]).To(Equal([]string{"cert_reader"}))
+				Expect(req.Context().Value(handlers.RolesKey)).To(Equal([]string{"cert_reader"}))
+			})
+		})
 		Context("and it returns an empty subject", func() {
 			It("should error", func() {
 				handler.fnSubjectExtractor = func(req *http.Request) string {
@@ -85,7 +100,7 @@ var _ = Describe("Process", func() {
 			req.Header.Set("Authorization", "Bearer somebearertoken")
 			cacheEntry = &rolesProjects{
 				review: &clients.TokenReview{
-					&authenticationapi.TokenReview{
+					TokenReview: &authenticationapi.TokenReview{
 						Status: authenticationapi.TokenReviewStatus{
 							User: authenticationapi.UserInfo{
 								Username: "myname",
@@ -109,7 +124,7 @@ var _ = Describe("Process", func() {
 			}
 			otherCacheEntry = &rolesProjects{
 				review: &clients.TokenReview{
-					&authenticationapi.TokenReview{
+					TokenReview: &authenticationapi.TokenReview{
 						Status: authenticationapi.TokenReviewStatus{
 							User: authenticationapi.UserInfo{
 								Username: "other",
@@ -173,6 +188,7 @@ var _ = Describe("Process", func() {
 				}
 				wantRoles := []string{"roleA", "roleB"}
 				Expect(req.Context().Value(handlers.UsernameKey)).To(Equal("myname"))
+				Expect(req.Context().Value(handlers.AuthMethodKey)).To(Equal(handlers.AuthMethodToken))
 				Expect(req.Context().Value(handlers.ProjectsKey)).To(ConsistOf(wantProjects))
 				Expect(req.Context().Value(handlers.RolesKey)).To(ConsistOf(wantRoles))
 			})
@@ -223,6 +239,58 @@ var _ = Describe("Process", func() {
 				})
 			})
 
+			Context("and a backend role has an expression", func() {
+
+				BeforeEach(func() {
+					expression, err := config.CompileRoleExpression(`username == "myname" && projectCount == 2`)
+					Expect(err).To(BeNil())
+					handler.config.AuthRoleExpressions = map[string]*config.RoleExpression{"roleA": expression}
+				})
+
+				It("should keep the role when the expression holds", func() {
+					req.Header.Set("Authorization", "Bearer somebearertoken")
+					req, err = handler.Process(req)
+					Expect(err).To(BeNil())
+					Expect(req.Context().Value(handlers.RolesKey)).To(ConsistOf([]string{"roleA", "roleB"}))
+				})
+
+				It("should remove the role when the expression does not hold", func() {
+					cacheEntry.projects = cacheEntry.projects[:1]
+					req.Header.Set("Authorization", "Bearer somebearertoken")
+					req, err = handler.Process(req)
+					Expect(err).To(BeNil())
+					Expect(req.Header["X-Forwarded-Roles"]).To(Equal([]string{"roleB"}))
+					Expect(req.Context().Value(handlers.RolesKey)).To(ConsistOf([]string{"roleB"}))
+				})
+			})
+
+			Context("and the backend roles are reloaded", func() {
+
+				BeforeEach(func() {
+					Expect(handler.Reload(&config.Options{
+						AuthBackEndRoles: map[string]config.BackendRoleConfig{
+							"roleA":        {},
+							"admin_reader": {},
+						},
+						AuthAdminRole: "admin_reader",
+					})).To(Succeed())
+					req.Header.Set("Authorization", "Bearer somebearertoken")
+					req, err = handler.Process(req)
+					Expect(err).To(BeNil())
+				})
+
+				It("should apply the reloaded roles to the request", func() {
+					Expect(req.Header["X-Forwarded-Roles"]).To(Equal([]string{"admin_reader"}))
+					Expect(req.Context().Value(handlers.RolesKey)).To(ConsistOf([]string{"admin_reader"}))
+				})
+
+				It("should replace the backend roles", func() {
+					Expect(handler.config.AuthBackEndRoles).To(HaveLen(2))
+					Expect(handler.config.AuthBackEndRoles).To(HaveKey("admin_reader"))
+					Expect(handler.config.AuthBackEndRoles).To(Not(HaveKey("roleB")))
+				})
+			})
+
 			Context("and has the spec'd admin role", func() {
 
 				BeforeEach(func() {
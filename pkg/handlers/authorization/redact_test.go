@@ -0,0 +1,54 @@
+package authorization
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/openshift/elasticsearch-proxy/pkg/config"
+)
+
+const secretToken = "sha256~secrettoken"
+
+var _ = Describe("Redaction of logs", func() {
+
+	var (
+		out   *bytes.Buffer
+		level log.Level
+	)
+
+	BeforeEach(func() {
+		out = &bytes.Buffer{}
+		level = log.GetLevel()
+		log.SetOutput(out)
+		log.SetLevel(log.TraceLevel)
+	})
+
+	AfterEach(func() {
+		log.SetOutput(os.Stderr)
+		log.SetLevel(level)
+	})
+
+	It("should not log the token of a request processed at trace level", func() {
+		handler := &authorizationHandler{
+			config: &config.Options{AuthBackEndRoles: map[string]config.BackendRoleConfig{"key": {}}},
+			cache:  NewRolesProjectsService(120, time.Minute, map[string]config.BackendRoleConfig{"key": {}}, &mockOpenShiftClient{}),
+			fnSubjectExtractor: func(req *http.Request) string {
+				return ""
+			},
+		}
+		req, _ := http.NewRequest("GET", "https://someplace/foo/_search", nil)
+		req.Header.Set("Authorization", "Bearer "+secretToken)
+		req.Header.Set("X-Forwarded-Access-Token", secretToken)
+		_, err := handler.Process(req)
+		Expect(err).To(BeNil())
+
+		Expect(out.Len()).ToNot(BeZero())
+		Expect(out.String()).ToNot(ContainSubstring(secretToken))
+	})
+})
@@ -0,0 +1,92 @@
+package authorization
+
+import (
+	"path"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/openshift/elasticsearch-proxy/pkg/clients"
+	"github.com/openshift/elasticsearch-proxy/pkg/config"
+)
+
+// evaluateRule returns true when every condition of the rule holds for the user. Group and name
+// checks are evaluated first so SARs are only performed when they may change the outcome
+func evaluateRule(logger *log.Entry, client clients.OpenShiftClient, userName string, groups []string, rule config.BackendRoleConfig) (bool, error) {
+	if len(rule.Groups) > 0 && !inAnyGroup(groups, rule.Groups) {
+		return false, nil
+	}
+	if len(rule.Usernames) > 0 && !matchesAnyName(userName, rule.Usernames) {
+		return false, nil
+	}
+	if rule.HasSAR() {
+		allowed, err := client.SubjectAccessReview(groups, userName, rule.Namespace, rule.Verb, rule.Resource, rule.ResourceAPIGroup)
+		if err != nil || !allowed {
+			return false, err
+		}
+	}
+	if len(rule.AllOf) > 0 {
+		if allowed, err := evaluateAllOf(logger, client, userName, groups, rule.AllOf); err != nil || !allowed {
+			return false, err
+		}
+	}
+	if len(rule.AnyOf) > 0 {
+		if allowed, err := evaluateAnyOf(logger, client, userName, groups, rule.AnyOf); err != nil || !allowed {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// evaluateAllOf returns false when any rule does not hold regardless of errors evaluating the others
+func evaluateAllOf(logger *log.Entry, client clients.OpenShiftClient, userName string, groups []string, rules []config.BackendRoleConfig) (bool, error) {
+	var lastErr error
+	for _, rule := range rules {
+		allowed, err := evaluateRule(logger, client, userName, groups, rule)
+		if err != nil {
+			logger.Debugf("Unable to evaluate rule %+v for %q: %v", rule, userName, err)
+			lastErr = err
+			continue
+		}
+		if !allowed {
+			return false, nil
+		}
+	}
+	return lastErr == nil, lastErr
+}
+
+// evaluateAnyOf returns true when any rule holds regardless of errors evaluating the others
+func evaluateAnyOf(logger *log.Entry, client clients.OpenShiftClient, userName string, groups []string, rules []config.BackendRoleConfig) (bool, error) {
+	var lastErr error
+	for _, rule := range rules {
+		allowed, err := evaluateRule(logger, client, userName, groups, rule)
+		if err != nil {
+			logger.Debugf("Unable to evaluate rule %+v for %q: %v", rule, userName, err)
+			lastErr = err
+			continue
+		}
+		if allowed {
+			return true, nil
+		}
+	}
+	return false, lastErr
+}
+
+func inAnyGroup(groups, wanted []string) bool {
+	for _, group := range groups {
+		for _, w := range wanted {
+			if group == w {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func matchesAnyName(userName string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, userName); matched {
+			return true
+		}
+	}
+	return false
+}
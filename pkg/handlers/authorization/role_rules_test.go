@@ -0,0 +1,158 @@
+package authorization
+
+import (
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/openshift/elasticsearch-proxy/pkg/config"
+)
+
+var _ = Describe("#evaluateRule", func() {
+
+	var (
+		client  *mockOpenShiftClient
+		groups  []string
+		allowed = config.BackendRoleConfig{Verb: "allowed"}
+		denied  = config.BackendRoleConfig{Verb: "denied"}
+		failed  = config.BackendRoleConfig{Verb: "failed"}
+
+		evaluate = func(rule config.BackendRoleConfig) (bool, error) {
+			return evaluateRule(log.NewEntry(log.StandardLogger()), client, "system:serviceaccount:openshift-logging:collector", groups, rule)
+		}
+	)
+
+	BeforeEach(func() {
+		groups = []string{"developers", "logging-admins"}
+		client = &mockOpenShiftClient{
+			sarResponses: map[string]bool{
+				"allowed": true,
+				"denied":  false,
+			},
+			sarErrs: map[string]error{
+				"failed": errors.New("review failed"),
+			},
+		}
+	})
+
+	Context("with a SAR", func() {
+		It("should hold when the SAR is allowed", func() {
+			Expect(evaluate(allowed)).To(BeTrue())
+		})
+		It("should not hold when the SAR is denied", func() {
+			Expect(evaluate(denied)).To(BeFalse())
+		})
+		It("should return the error when the SAR fails", func() {
+			_, err := evaluate(failed)
+			Expect(err).To(MatchError("review failed"))
+		})
+	})
+
+	Context("with groups", func() {
+		It("should hold when the user is in any of the groups", func() {
+			Expect(evaluate(config.BackendRoleConfig{Groups: []string{"admins", "logging-admins"}})).To(BeTrue())
+			Expect(client.sarCounter).To(BeZero(), "Exp. no SAR for a group only rule")
+		})
+		It("should not hold when the user is in none of the groups", func() {
+			Expect(evaluate(config.BackendRoleConfig{Groups: []string{"admins"}})).To(BeFalse())
+		})
+		It("should not perform the SAR when the user is in none of the groups", func() {
+			Expect(evaluate(config.BackendRoleConfig{Groups: []string{"admins"}, Verb: "allowed"})).To(BeFalse())
+			Expect(client.sarCounter).To(BeZero())
+		})
+		It("should require the SAR as well when the user is in the groups", func() {
+			Expect(evaluate(config.BackendRoleConfig{Groups: []string{"developers"}, Verb: "denied"})).To(BeFalse())
+			Expect(evaluate(config.BackendRoleConfig{Groups: []string{"developers"}, Verb: "allowed"})).To(BeTrue())
+		})
+	})
+
+	Context("with username patterns", func() {
+		It("should hold when the username matches any pattern", func() {
+			Expect(evaluate(config.BackendRoleConfig{Usernames: []string{"kube:admin", "system:serviceaccount:openshift-logging:*"}})).To(BeTrue())
+		})
+		It("should not hold when the username matches no pattern", func() {
+			Expect(evaluate(config.BackendRoleConfig{Usernames: []string{"system:serviceaccount:default:*"}})).To(BeFalse())
+		})
+	})
+
+	Context("with anyOf", func() {
+		It("should hold when any rule holds", func() {
+			Expect(evaluate(config.BackendRoleConfig{AnyOf: []config.BackendRoleConfig{denied, allowed}})).To(BeTrue())
+		})
+		It("should not hold when no rule holds", func() {
+			Expect(evaluate(config.BackendRoleConfig{AnyOf: []config.BackendRoleConfig{denied, denied}})).To(BeFalse())
+		})
+		It("should stop at the first rule that holds", func() {
+			Expect(evaluate(config.BackendRoleConfig{AnyOf: []config.BackendRoleConfig{allowed, denied}})).To(BeTrue())
+			Expect(client.sarCounter).To(Equal(1))
+		})
+		It("should hold when a rule holds and another fails", func() {
+			Expect(evaluate(config.BackendRoleConfig{AnyOf: []config.BackendRoleConfig{failed, allowed}})).To(BeTrue())
+		})
+		It("should return the error when no rule holds and one fails", func() {
+			_, err := evaluate(config.BackendRoleConfig{AnyOf: []config.BackendRoleConfig{failed, denied}})
+			Expect(err).To(MatchError("review failed"))
+		})
+	})
+
+	Context("with allOf", func() {
+		It("should hold when every rule holds", func() {
+			Expect(evaluate(config.BackendRoleConfig{AllOf: []config.BackendRoleConfig{allowed, allowed}})).To(BeTrue())
+		})
+		It("should not hold when any rule does not hold", func() {
+			Expect(evaluate(config.BackendRoleConfig{AllOf: []config.BackendRoleConfig{allowed, denied}})).To(BeFalse())
+		})
+		It("should stop at the first rule that does not hold", func() {
+			Expect(evaluate(config.BackendRoleConfig{AllOf: []config.BackendRoleConfig{denied, allowed}})).To(BeFalse())
+			Expect(client.sarCounter).To(Equal(1))
+		})
+		It("should not hold when a rule fails and another does not hold", func() {
+			Expect(evaluate(config.BackendRoleConfig{AllOf: []config.BackendRoleConfig{failed, denied}})).To(BeFalse())
+		})
+		It("should return the error when the other rules hold and one fails", func() {
+			_, err := evaluate(config.BackendRoleConfig{AllOf: []config.BackendRoleConfig{allowed, failed}})
+			Expect(err).To(MatchError("review failed"))
+		})
+	})
+
+	Context("with nested rules", func() {
+		// can get pods/log in openshift-logging OR is in group logging-admins AND can list namespaces
+		infraReader := config.BackendRoleConfig{
+			AnyOf: []config.BackendRoleConfig{
+				{Namespace: "openshift-logging", Verb: "denied", Resource: "pods/log"},
+				{
+					AllOf: []config.BackendRoleConfig{
+						{Groups: []string{"logging-admins"}},
+						{Verb: "allowed", Resource: "namespaces"},
+					},
+				},
+			},
+		}
+		It("should hold when a nested combination holds", func() {
+			Expect(evaluate(infraReader)).To(BeTrue())
+		})
+		It("should not hold when no nested combination holds", func() {
+			groups = []string{"developers"}
+			Expect(evaluate(infraReader)).To(BeFalse())
+		})
+	})
+})
+
+var _ = Describe("#evaluateRoles with compound rules", func() {
+	It("should only return roles whose rules hold", func() {
+		client := &mockOpenShiftClient{sarResponses: map[string]bool{"list": true}}
+		backendRoles := map[string]config.BackendRoleConfig{
+			"infra-reader": {
+				AllOf: []config.BackendRoleConfig{
+					{Groups: []string{"logging-admins"}},
+					{Verb: "list", Resource: "namespaces"},
+				},
+			},
+			"collector": {Usernames: []string{"system:serviceaccount:openshift-logging:*"}},
+		}
+		roles := evaluateRoles(log.NewEntry(log.StandardLogger()), client, "auser", []string{"logging-admins"}, backendRoles)
+		Expect(roles).To(Equal(map[string]struct{}{"infra-reader": {}}))
+	})
+})
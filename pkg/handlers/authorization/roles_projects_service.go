@@ -1,6 +1,10 @@
 package authorization
 
 import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/openshift/elasticsearch-proxy/pkg/apis"
@@ -10,6 +14,7 @@ import (
 	"github.com/openshift/elasticsearch-proxy/pkg/config"
 	"github.com/openshift/elasticsearch-proxy/pkg/handlers"
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/sync/singleflight"
 )
 
 var (
@@ -17,7 +22,16 @@ var (
 )
 
 type rolesService struct {
-	cache gcache.Cache
+	cache  gcache.Cache
+	client clients.OpenShiftClient
+	//loads ensures the roles and projects of a token are loaded once by concurrent requests
+	loads singleflight.Group
+
+	//lock guards roleConfig and generation which are replaced on reload
+	lock       sync.RWMutex
+	roleConfig map[string]config.BackendRoleConfig
+	//generation is incremented on reload so entries loaded with the previous roles are not cached
+	generation uint64
 }
 
 func NewRolesProjectsService(size int, expiry time.Duration, roleConfig map[string]config.BackendRoleConfig, client clients.OpenShiftClient) *rolesService {
@@ -25,8 +39,34 @@ func NewRolesProjectsService(size int, expiry time.Duration, roleConfig map[stri
 		cache: gcache.New(size).
 			LRU().
 			Expiration(expiry).
-			LoaderFunc(loadFromOpenshift(roleConfig, client)).
 			Build(),
+		client:     client,
+		roleConfig: roleConfig,
+	}
+}
+
+func (s *rolesService) backendRoles() (map[string]config.BackendRoleConfig, uint64) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.roleConfig, s.generation
+}
+
+// reload replaces the backend roles evaluated for a user and purges every cached entry
+// so they are evaluated again on the next request
+func (s *rolesService) reload(roleConfig map[string]config.BackendRoleConfig) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.roleConfig = roleConfig
+	s.generation++
+	s.cache.Purge()
+}
+
+// store caches the entry unless it was loaded with the roles of a previous generation
+func (s *rolesService) store(token string, loaded *rolesProjects, generation uint64) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if generation == s.generation {
+		_ = s.cache.Set(token, loaded)
 	}
 }
 
@@ -34,10 +74,26 @@ type rolesProjects struct {
 	review   *clients.TokenReview
 	roles    map[string]struct{}
 	projects []apis.Project
+	loadedAt time.Time
 }
 
-func (s *rolesService) getRolesAndProjects(token string) (*rolesProjects, error) {
+// getRolesAndProjects returns the cached roles and projects of the token or loads them from
+// OpenShift, tracing the calls as part of the request of the context
+func (s *rolesService) getRolesAndProjects(ctx context.Context, token string) (*rolesProjects, error) {
 	v, err := s.cache.Get(token)
+	if err == gcache.KeyNotFoundError && s.client != nil {
+		roleConfig, generation := s.backendRoles()
+		// requests after a reload do not wait for a load with the previous roles
+		key := strconv.FormatUint(generation, 10) + "/" + token
+		v, err, _ = s.loads.Do(key, func() (interface{}, error) {
+			loaded, err := loadFromOpenshift(ctx, roleConfig, s.client, token)
+			if err != nil {
+				return nil, err
+			}
+			s.store(token, loaded, generation)
+			return loaded, nil
+		})
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -45,57 +101,92 @@ func (s *rolesService) getRolesAndProjects(token string) (*rolesProjects, error)
 	return cacheVal, nil
 }
 
-func loadFromOpenshift(roleConfig map[string]config.BackendRoleConfig, client clients.OpenShiftClient) func(key interface{}) (interface{}, error) {
-	return func(key interface{}) (interface{}, error) {
-		token := key.(string)
-		tokenReview, err := client.TokenReview(token)
-		log.Debugf("TokenReview: %v", tokenReview)
-		if err != nil {
-			log.Errorf("Error fetching user info %v", err)
-			return nil, err
-		}
-		if !tokenReview.Status.Authenticated {
-			return nil, handlers.NewError("401", tokenReview.Status.Error)
+// entries returns the cached entries which have not expired
+func (s *rolesService) entries() []*rolesProjects {
+	entries := []*rolesProjects{}
+	for _, v := range s.cache.GetALL(true) {
+		entries = append(entries, v.(*rolesProjects))
+	}
+	return entries
+}
+
+// evict removes the cached entries of a user and returns the number removed
+func (s *rolesService) evict(username string) int {
+	evicted := 0
+	for token, v := range s.cache.GetALL(false) {
+		if v.(*rolesProjects).review.UserName() == username && s.cache.Remove(token) {
+			evicted++
 		}
+	}
+	return evicted
+}
 
-		username := tokenReview.UserName()
-		groups := tokenReview.Groups()
-		log.Debugf("User is %q in Groups: %v", username, groups)
+// flush removes every cached entry and returns the number removed
+func (s *rolesService) flush() int {
+	count := s.cache.Len(false)
+	s.cache.Purge()
+	return count
+}
 
-		roles := evaluateRoles(client, username, groups, roleConfig)
-		projects, err := listProjects(client, token)
-		if err != nil {
-			return nil, err
-		}
-		return &rolesProjects{review: tokenReview, roles: roles, projects: projects}, nil
+// loadFromOpenshift reviews the token and evaluates the backend roles and projects of its user.
+// The calls to OpenShift are traced and logged as part of the request of the context
+func loadFromOpenshift(ctx context.Context, roleConfig map[string]config.BackendRoleConfig, client clients.OpenShiftClient, token string) (*rolesProjects, error) {
+	logger := handlers.Logger(ctx)
+	client = clients.WithTracing(ctx, client)
+	tokenReview, err := client.TokenReview(token)
+	logger.Debugf("TokenReview: %v", tokenReview.Redacted())
+	if err != nil {
+		logger.Errorf("Error fetching user info %v", err)
+		return nil, err
+	}
+	if !tokenReview.Status.Authenticated {
+		return nil, handlers.NewError("401", tokenReview.Status.Error)
 	}
+
+	username := tokenReview.UserName()
+	groups := tokenReview.Groups()
+	logger.Debugf("User is %q in Groups: %v", username, groups)
+
+	roles := evaluateRoles(logger, client, username, groups, roleConfig)
+	projects, err := listProjects(logger, client, token)
+	if err != nil {
+		return nil, err
+	}
+	return &rolesProjects{review: tokenReview, roles: roles, projects: projects, loadedAt: time.Now()}, nil
 }
 
-func evaluateRoles(client clients.OpenShiftClient, userName string, groups []string, roleConfig map[string]config.BackendRoleConfig) map[string]struct{} {
+func evaluateRoles(logger *log.Entry, client clients.OpenShiftClient, userName string, groups []string, roleConfig map[string]config.BackendRoleConfig) map[string]struct{} {
 	roles := map[string]struct{}{}
-	for name, sar := range roleConfig {
-		if allowed, err := client.SubjectAccessReview(groups, userName, sar.Namespace, sar.Verb, sar.Resource, sar.ResourceAPIGroup); err == nil {
-			log.Debugf("%q for %q SAR: %v", userName, name, allowed)
+	names := make([]string, 0, len(roleConfig))
+	for name := range roleConfig {
+		names = append(names, name)
+	}
+	// evaluate in a stable order so the SARs performed for a user are predictable
+	sort.Strings(names)
+	for _, name := range names {
+		rule := roleConfig[name]
+		if allowed, err := evaluateRule(logger, client, userName, groups, rule); err == nil {
+			logger.Debugf("%q for %q rule: %v", userName, name, allowed)
 			if allowed {
 				roles[name] = exists
 			}
 		} else {
-			log.Warnf("Unable to evaluate %s SAR for user %s", name, userName)
+			logger.Warnf("Unable to evaluate %s rule for user %s: %v", name, userName, err)
 		}
 	}
 	return roles
 }
 
-func listProjects(client clients.OpenShiftClient, token string) ([]apis.Project, error) {
+func listProjects(logger *log.Entry, client clients.OpenShiftClient, token string) ([]apis.Project, error) {
 	var namespaces []clients.Namespace
 	namespaces, err := client.ListNamespaces(token)
 	if err != nil {
-		log.Errorf("There was an error fetching projects: %v", err)
+		logger.Errorf("There was an error fetching projects: %v", err)
 		return nil, err
 	}
 	projects := make([]apis.Project, len(namespaces))
 	for i, ns := range namespaces {
-		projects[i] = apis.Project{Name: ns.Name()}
+		projects[i] = apis.Project{Name: ns.Name(), UID: ns.UID()}
 	}
 	return projects, nil
 }
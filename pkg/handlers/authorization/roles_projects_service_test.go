@@ -1,6 +1,7 @@
 package authorization
 
 import (
+	"context"
 	"testing"
 
 	. "github.com/onsi/ginkgo"
@@ -14,6 +15,12 @@ import (
 	"github.com/openshift/elasticsearch-proxy/pkg/apis"
 	"github.com/openshift/elasticsearch-proxy/pkg/clients"
 	"github.com/openshift/elasticsearch-proxy/pkg/config"
+	"github.com/openshift/elasticsearch-proxy/pkg/tracing"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
 	authenticationv1 "k8s.io/api/authentication/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -44,7 +51,7 @@ var _ = Describe("#evaluateRoles", func() {
 			},
 		}
 		groups := []string{}
-		roles := evaluateRoles(client, "auser", groups, backendRoles)
+		roles := evaluateRoles(log.NewEntry(log.StandardLogger()), client, "auser", groups, backendRoles)
 		Expect(roles).To(Equal(map[string]struct{}{"allowed": struct{}{}}))
 	})
 
@@ -72,27 +79,27 @@ var _ = Describe("RolesProjectsService", func() {
 
 		It("should return the error when unable to do a tokenreview", func() {
 			service = newService(&mockOpenShiftClient{tokenReviewErr: errors.New("failed to get token")})
-			_, err = service.getRolesAndProjects(token)
+			_, err = service.getRolesAndProjects(context.Background(), token)
 			Expect(err).To(BeEquivalentTo(errors.New("failed to get token")))
 		})
 		It("should return a 401 error when token is expired", func() {
 			service = newService(&mockOpenShiftClient{tokenReviewStatusErr: "token expired"})
-			_, err = service.getRolesAndProjects(token)
+			_, err = service.getRolesAndProjects(context.Background(), token)
 			Expect(err).To(BeEquivalentTo(errors.New("got 401 token expired")))
 		})
 		It("should return an empty role set when subjectaccessreviews fail", func() {
 			service = newService(&mockOpenShiftClient{subjectAccessErr: errors.New("review failed")})
-			rolesAndProjects, err = service.getRolesAndProjects(token)
+			rolesAndProjects, err = service.getRolesAndProjects(context.Background(), token)
 			expectValidRolesProjects(rolesAndProjects, err, map[string]struct{}{})
 		})
 		It("should return the error when unable to retrieve a project list", func() {
 			service = newService(&mockOpenShiftClient{projectsErr: errors.New("projects failed")})
-			_, err = service.getRolesAndProjects(token)
+			_, err = service.getRolesAndProjects(context.Background(), token)
 			Expect(err).To(BeEquivalentTo(errors.New("projects failed")))
 		})
 		It("should return roles and projects when successful", func() {
 			service = newService(&mockOpenShiftClient{})
-			rolesAndProjects, err = service.getRolesAndProjects(token)
+			rolesAndProjects, err = service.getRolesAndProjects(context.Background(), token)
 			expectValidRolesProjects(rolesAndProjects, err, map[string]struct{}{"key": exists})
 		})
 	})
@@ -102,31 +109,102 @@ func TestCacheExpiry(t *testing.T) {
 	client := &mockOpenShiftClient{}
 	duration := time.Millisecond * 50
 	s := NewRolesProjectsService(120, duration, map[string]config.BackendRoleConfig{"key": {}}, client)
-	s.getRolesAndProjects(token)
+	s.getRolesAndProjects(context.Background(), token)
 	assert.Equal(t, 1, client.tokenReviewCounter)
-	s.getRolesAndProjects(token)
+	s.getRolesAndProjects(context.Background(), token)
 	assert.Equal(t, 1, client.tokenReviewCounter)
 	time.Sleep(duration)
-	s.getRolesAndProjects(token)
+	s.getRolesAndProjects(context.Background(), token)
 	assert.Equal(t, 2, client.tokenReviewCounter)
 }
 
+func TestReloadPurgesCache(t *testing.T) {
+	client := &mockOpenShiftClient{}
+	s := NewRolesProjectsService(120, time.Minute, map[string]config.BackendRoleConfig{"key": {}}, client)
+	rolesAndProjects, _ := s.getRolesAndProjects(context.Background(), token)
+	assert.DeepEqual(t, map[string]struct{}{"key": exists}, rolesAndProjects.roles)
+
+	s.reload(map[string]config.BackendRoleConfig{"other": {}})
+	rolesAndProjects, _ = s.getRolesAndProjects(context.Background(), token)
+	assert.Equal(t, 2, client.tokenReviewCounter)
+	assert.DeepEqual(t, map[string]struct{}{"other": exists}, rolesAndProjects.roles)
+}
+
+func TestReloadDuringLoadDoesNotCacheStaleRoles(t *testing.T) {
+	client := &mockOpenShiftClient{}
+	s := NewRolesProjectsService(120, time.Minute, map[string]config.BackendRoleConfig{"key": {}}, client)
+	client.onTokenReview = func() {
+		client.onTokenReview = nil
+		s.reload(map[string]config.BackendRoleConfig{"other": {}})
+	}
+	rolesAndProjects, _ := s.getRolesAndProjects(context.Background(), token)
+	assert.DeepEqual(t, map[string]struct{}{"key": exists}, rolesAndProjects.roles)
+	assert.Equal(t, 0, len(s.entries()))
+
+	rolesAndProjects, _ = s.getRolesAndProjects(context.Background(), token)
+	assert.Equal(t, 2, client.tokenReviewCounter)
+	assert.DeepEqual(t, map[string]struct{}{"other": exists}, rolesAndProjects.roles)
+}
+
+func TestEvictAndFlushCache(t *testing.T) {
+	client := &mockOpenShiftClient{}
+	s := NewRolesProjectsService(120, time.Minute, map[string]config.BackendRoleConfig{"key": {}}, client)
+	s.getRolesAndProjects(context.Background(), token)
+	s.getRolesAndProjects(context.Background(), "othertoken")
+	assert.Equal(t, 2, len(s.entries()))
+
+	assert.Equal(t, 0, s.evict("someoneelse"))
+	assert.Equal(t, 2, s.evict("jdoe"))
+	assert.Equal(t, 0, len(s.entries()))
+
+	s.getRolesAndProjects(context.Background(), token)
+	assert.Equal(t, 3, client.tokenReviewCounter)
+	assert.Equal(t, 1, s.flush())
+	assert.Equal(t, 0, len(s.entries()))
+}
+
+func TestLoadTracesOpenShiftCalls(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+	ctx, span := tracing.Tracer().Start(context.Background(), "handler authorization")
+	s := NewRolesProjectsService(120, time.Minute, map[string]config.BackendRoleConfig{"key": {}}, &mockOpenShiftClient{})
+	s.getRolesAndProjects(ctx, token)
+	span.End()
+
+	names := []string{}
+	for _, ended := range recorder.Ended()[:3] {
+		names = append(names, ended.Name())
+		assert.Equal(t, span.SpanContext().SpanID(), ended.Parent().SpanID())
+	}
+	assert.DeepEqual(t, []string{"TokenReview", "SubjectAccessReview", "ListNamespaces"}, names)
+}
+
 type mockOpenShiftClient struct {
 	tokenReviewStatusErr string
 	tokenReviewErr       error
 	subjectAccessErr     error
 	projectsErr          error
 	tokenReviewCounter   int
+	sarCounter           int
 	sarResponses         map[string]bool
+	sarErrs              map[string]error
+	//onTokenReview is called during each token review when given
+	onTokenReview func()
 }
 
 func (c *mockOpenShiftClient) TokenReview(token string) (*clients.TokenReview, error) {
 	c.tokenReviewCounter++
+	if c.onTokenReview != nil {
+		c.onTokenReview()
+	}
 	authenticated := true
 	if c.tokenReviewStatusErr != "" {
 		authenticated = false
 	}
-	return &clients.TokenReview{&authenticationv1.TokenReview{
+	return &clients.TokenReview{TokenReview: &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: token},
 		Status: authenticationv1.TokenReviewStatus{
 			Authenticated: authenticated,
 			User:          authenticationv1.UserInfo{Username: "jdoe", Groups: []string{"foo", "bar"}},
@@ -136,6 +214,10 @@ func (c *mockOpenShiftClient) TokenReview(token string) (*clients.TokenReview, e
 }
 
 func (c *mockOpenShiftClient) SubjectAccessReview(groups []string, user, namespace, verb, resource, apiGroup string) (bool, error) {
+	c.sarCounter++
+	if err, ok := c.sarErrs[verb]; ok {
+		return false, err
+	}
 	if c.sarResponses != nil {
 		if value, ok := c.sarResponses[verb]; ok {
 			return value, nil
@@ -0,0 +1,117 @@
+package authorization
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/openshift/elasticsearch-proxy/pkg/apis"
+	"github.com/openshift/elasticsearch-proxy/pkg/clients"
+	"github.com/openshift/elasticsearch-proxy/pkg/config"
+	"github.com/openshift/elasticsearch-proxy/pkg/handlers"
+)
+
+// forwardedHeaders are the headers set by the handler on the request sent upstream
+var forwardedHeaders = []string{
+	headerForwardedUser,
+	headerForwardedRoles,
+	headerForwardedNamespace,
+	headerForwardedFor,
+}
+
+// SARResult is the outcome of a SubjectAccessReview performed for a user
+type SARResult struct {
+	Namespace        string
+	Verb             string
+	Resource         string
+	ResourceAPIGroup string
+	Allowed          bool
+	Error            error
+}
+
+// WhoamiReport describes what a token resolves to and what is sent upstream for it
+type WhoamiReport struct {
+	Username             string
+	Groups               []string
+	SubjectAccessReviews []SARResult
+	Projects             []string
+	Roles                []string
+	//Headers are the headers that would be sent upstream
+	Headers http.Header
+}
+
+// Whoami processes a request bearing the token as the handler would and reports the reviewed
+// identity, every SAR performed, the roles selected and the headers forwarded upstream
+func Whoami(opts *config.Options, client clients.OpenShiftClient, token string) (*WhoamiReport, error) {
+	recorder := &recordingClient{OpenShiftClient: client}
+	handler := &authorizationHandler{
+		config:   opts,
+		osClient: recorder,
+		// cache the review so the request is processed with the same result that is reported
+		cache:              NewRolesProjectsService(1, time.Minute, opts.AuthBackEndRoles, recorder),
+		fnSubjectExtractor: defaultCertSubjectExtractor,
+	}
+	rolesProjects, err := handler.cache.getRolesAndProjects(context.Background(), token)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, "/", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(headerAuthorization, "Bearer "+token)
+	if req, err = handler.Process(req); err != nil {
+		return nil, err
+	}
+
+	report := &WhoamiReport{
+		Username:             rolesProjects.review.UserName(),
+		Groups:               rolesProjects.review.Groups(),
+		SubjectAccessReviews: recorder.results(),
+		Headers:              http.Header{},
+	}
+	if projects, ok := req.Context().Value(handlers.ProjectsKey).([]apis.Project); ok {
+		for _, project := range projects {
+			report.Projects = append(report.Projects, project.Name)
+		}
+	}
+	if roles, ok := req.Context().Value(handlers.RolesKey).([]string); ok {
+		report.Roles = roles
+	}
+	for _, name := range forwardedHeaders {
+		if values, found := req.Header[http.CanonicalHeaderKey(name)]; found {
+			report.Headers[http.CanonicalHeaderKey(name)] = values
+		}
+	}
+	return report, nil
+}
+
+// recordingClient records the outcome of every SubjectAccessReview
+type recordingClient struct {
+	clients.OpenShiftClient
+	lock    sync.Mutex
+	reviews []SARResult
+}
+
+func (c *recordingClient) SubjectAccessReview(groups []string, user, namespace, verb, resource, resourceAPIGroup string) (bool, error) {
+	allowed, err := c.OpenShiftClient.SubjectAccessReview(groups, user, namespace, verb, resource, resourceAPIGroup)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.reviews = append(c.reviews, SARResult{
+		Namespace:        namespace,
+		Verb:             verb,
+		Resource:         resource,
+		ResourceAPIGroup: resourceAPIGroup,
+		Allowed:          allowed,
+		Error:            err,
+	})
+	return allowed, err
+}
+
+func (c *recordingClient) results() []SARResult {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return append([]SARResult{}, c.reviews...)
+}
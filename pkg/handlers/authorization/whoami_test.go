@@ -0,0 +1,75 @@
+package authorization
+
+import (
+	"errors"
+	"net/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/openshift/elasticsearch-proxy/pkg/config"
+)
+
+var _ = Describe("#Whoami", func() {
+
+	var (
+		opts   *config.Options
+		client *mockOpenShiftClient
+	)
+
+	BeforeEach(func() {
+		client = &mockOpenShiftClient{sarResponses: map[string]bool{"get": true, "list": false}}
+		opts = &config.Options{
+			AuthBackEndRoles: map[string]config.BackendRoleConfig{
+				"reader":      {Namespace: "openshift-logging", Verb: "get", Resource: "pods/log"},
+				"lister":      {Verb: "list", Resource: "namespaces"},
+				"grouped":     {Groups: []string{"foo"}},
+				"unavailable": {Verb: "watch"},
+			},
+			AuthDefaultRole: "project_user",
+		}
+		client.sarErrs = map[string]error{"watch": errors.New("review failed")}
+	})
+
+	It("should report the identity, SARs, roles and forwarded headers", func() {
+		report, err := Whoami(opts, client, "sometoken")
+		Expect(err).To(BeNil())
+		Expect(report.Username).To(Equal("jdoe"))
+		Expect(report.Groups).To(Equal([]string{"foo", "bar"}))
+		Expect(report.SubjectAccessReviews).To(Equal([]SARResult{
+			{Verb: "list", Resource: "namespaces", Allowed: false},
+			{Namespace: "openshift-logging", Verb: "get", Resource: "pods/log", Allowed: true},
+			{Verb: "watch", Error: errors.New("review failed")},
+		}))
+		Expect(report.Projects).To(Equal([]string{"myproject"}))
+		Expect(report.Roles).To(ConsistOf("grouped", "reader"))
+		Expect(report.Headers).To(Equal(http.Header{
+			"X-Forwarded-User":  {"jdoe"},
+			"X-Forwarded-Roles": {"grouped,reader"},
+			"X-Ocp-Ns":          {"\"myproject\""},
+			"X-Forwarded-For":   {"localhost"},
+		}))
+		Expect(client.tokenReviewCounter).To(Equal(1))
+	})
+
+	It("should report the admin role alone", func() {
+		opts.AuthAdminRole = "reader"
+		report, err := Whoami(opts, client, "sometoken")
+		Expect(err).To(BeNil())
+		Expect(report.Roles).To(Equal([]string{"reader"}))
+		Expect(report.Headers.Get("X-Forwarded-Roles")).To(Equal("reader"))
+	})
+
+	It("should report the default role when no other applies", func() {
+		opts.AuthBackEndRoles = map[string]config.BackendRoleConfig{"lister": {Verb: "list"}}
+		report, err := Whoami(opts, client, "sometoken")
+		Expect(err).To(BeNil())
+		Expect(report.Roles).To(Equal([]string{"project_user"}))
+	})
+
+	It("should return the error when the token can not be reviewed", func() {
+		client.tokenReviewStatusErr = "token expired"
+		_, err := Whoami(opts, client, "sometoken")
+		Expect(err).To(MatchError("got 401 token expired"))
+	})
+})
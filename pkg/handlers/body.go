@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// ReadBody reads the body of the request which must not be larger than the limit, unless zero. The
+// body is read within the http-read-timeout of the server
+func ReadBody(req *http.Request, maxBodySize int64) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return []byte{}, nil
+	}
+	defer req.Body.Close()
+	var reader io.Reader = req.Body
+	if maxBodySize > 0 {
+		reader = io.LimitReader(req.Body, maxBodySize+1)
+	}
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			return nil, NewError("408", "Timed out reading the request body")
+		}
+		return nil, NewError("400", "Unable to read the request body")
+	}
+	if maxBodySize > 0 && int64(len(data)) > maxBodySize {
+		return nil, NewError("413", fmt.Sprintf("Request body larger than %d bytes can not be inspected", maxBodySize))
+	}
+	return data, nil
+}
+
+// SetBody replaces the body of the request by the data, setting its type when the request has none
+func SetBody(req *http.Request, data []byte, contentType string) {
+	req.Body = ioutil.NopCloser(bytes.NewReader(data))
+	req.ContentLength = int64(len(data))
+	req.Header.Set("Content-Length", strconv.Itoa(len(data)))
+	if req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+}
@@ -0,0 +1,149 @@
+package bulk
+
+import (
+	"net/http"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/openshift/elasticsearch-proxy/pkg/apis"
+	"github.com/openshift/elasticsearch-proxy/pkg/config"
+	"github.com/openshift/elasticsearch-proxy/pkg/elasticsearch"
+	"github.com/openshift/elasticsearch-proxy/pkg/handlers"
+)
+
+type bulkHandler struct {
+	//lock guards every field which are replaced on Reload
+	lock sync.RWMutex
+	//naming is nil when the indices of users are not restricted
+	naming       *elasticsearch.IndexNaming
+	certificates map[string][]string
+	adminRole    string
+	denyMode     string
+}
+
+// NewHandlers is the initializer for this handler. No handler is returned when neither the
+// indices of projects nor those of certificates are configured
+func NewHandlers(opts *config.Options) []handlers.RequestHandler {
+	if len(opts.AuthIndexPatterns) == 0 && len(opts.AuthCertificateIndices) == 0 {
+		return []handlers.RequestHandler{}
+	}
+	handler, err := newBulkHandler(opts)
+	if err != nil {
+		log.Fatalf("Error constructing the bulk handler %v", err)
+	}
+	return []handlers.RequestHandler{handler}
+}
+
+func newBulkHandler(opts *config.Options) (*bulkHandler, error) {
+	handler := &bulkHandler{}
+	if err := handler.apply(opts); err != nil {
+		return nil, err
+	}
+	return handler, nil
+}
+
+func (h *bulkHandler) Name() string {
+	return "bulk"
+}
+
+// Reload replaces the indices of projects and certificates, the admin role and the deny mode with
+// those of the given options
+func (h *bulkHandler) Reload(opts *config.Options) error {
+	if err := h.apply(opts); err != nil {
+		return err
+	}
+	log.Infof("Reloaded %d index patterns and the indices of %d certificates for bulk requests", len(opts.AuthIndexPatterns), len(opts.AuthCertificateIndices))
+	return nil
+}
+
+func (h *bulkHandler) apply(opts *config.Options) error {
+	var naming *elasticsearch.IndexNaming
+	if len(opts.AuthIndexPatterns) > 0 {
+		var err error
+		if naming, err = elasticsearch.NewIndexNaming(opts.AuthIndexPatterns); err != nil {
+			return err
+		}
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.naming = naming
+	h.certificates = opts.AuthCertificateIndices
+	h.adminRole = opts.AuthAdminRole
+	h.denyMode = opts.AuthBulkDenyMode
+	return nil
+}
+
+// permissions are the indices a request may write to
+type permissions struct {
+	patterns []string
+	//kibanaUser is the user whose indices of Kibana are permitted besides the patterns. Certificates
+	//have none and are only permitted the indices of Kibana matched by their patterns
+	kibanaUser string
+}
+
+func (p *permissions) permits(index string) bool {
+	if p.kibanaUser != "" && elasticsearch.PermitsKibanaIndex(p.kibanaUser, index) {
+		return true
+	}
+	return elasticsearch.Permits(p.patterns, index)
+}
+
+// permissions returns the indices the request may write to and nil when they are not restricted
+func (h *bulkHandler) permissions(req *http.Request) (*permissions, string) {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	ctx := req.Context()
+	roles, _ := ctx.Value(handlers.RolesKey).([]string)
+	for _, role := range roles {
+		if h.adminRole != "" && role == h.adminRole {
+			return nil, h.denyMode
+		}
+	}
+	switch method, _ := ctx.Value(handlers.AuthMethodKey).(string); method {
+	case handlers.AuthMethodToken:
+		if h.naming == nil {
+			return nil, h.denyMode
+		}
+		projects, _ := ctx.Value(handlers.ProjectsKey).([]apis.Project)
+		username, _ := ctx.Value(handlers.UsernameKey).(string)
+		return &permissions{patterns: h.naming.Patterns(projects), kibanaUser: username}, h.denyMode
+	case handlers.AuthMethodCertificate:
+		subject, _ := ctx.Value(handlers.SubjectKey).(string)
+		if patterns, found := h.certificates[subject]; found {
+			return &permissions{patterns: patterns}, h.denyMode
+		}
+	}
+	return nil, h.denyMode
+}
+
+// Process inspects the actions of bulk requests as their body is sent to Elasticsearch. Actions
+// for indices outside of the projects of users, and their own indices of Kibana, or of the patterns
+// of certificates, either fail the whole request or are removed from the request and answered with
+// an error each. Requests are recognized by their endpoint as those for the indices of Kibana only are
+// classified as kibana requests. Requests of the admin role and of certificates without patterns are
+// not inspected
+func (h *bulkHandler) Process(req *http.Request) (*http.Request, error) {
+	logger := handlers.Logger(req.Context())
+	esRequest := handlers.ESRequest(req.Context())
+	if esRequest == nil || esRequest.Endpoint != "_bulk" || req.Body == nil || req.Body == http.NoBody {
+		return req, nil
+	}
+	permissions, denyMode := h.permissions(req)
+	if permissions == nil {
+		logger.Trace("Allowing bulk actions for every index")
+		return req, nil
+	}
+	defaultIndex := ""
+	if len(esRequest.Indices) > 0 {
+		defaultIndex = esRequest.Indices[0]
+	}
+	inspector := newInspector(req.Body, permissions, defaultIndex, denyMode == config.BulkDenyItem, logger)
+	if denyMode == config.BulkDenyItem {
+		// forbidden items are removed from the body and answered in the response
+		return handlers.WithInspectedBody(req, inspector, inspector.response.ModifyResponse), nil
+	}
+	req = req.Clone(req.Context())
+	req.Body = inspector
+	return req, nil
+}
@@ -0,0 +1,201 @@
+package bulk
+
+import (
+	"io/ioutil"
+	"net/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/openshift/elasticsearch-proxy/pkg/config"
+	"github.com/openshift/elasticsearch-proxy/pkg/elasticsearch"
+	"github.com/openshift/elasticsearch-proxy/pkg/handlers"
+	"github.com/openshift/elasticsearch-proxy/test"
+)
+
+const (
+	collector = "CN=collector,OU=logging"
+)
+
+var _ = Describe("Process", func() {
+
+	var (
+		handler *bulkHandler
+		opts    *config.Options
+		fixture *test.RequestFixture
+
+		process = func(path, body string) *http.Request {
+			req, err := fixture.Process("POST", path, body)
+			Expect(err).To(BeNil())
+			return req
+		}
+		respondJSON = func(req *http.Request, status int, body string) *http.Response {
+			resp, err := test.Respond(req, status, "application/json", body)
+			Expect(err).To(BeNil())
+			return resp
+		}
+	)
+
+	BeforeEach(func() {
+		opts = &config.Options{
+			AuthIndexPatterns:      []string{"app-{namespace}-*"},
+			AuthCertificateIndices: map[string][]string{collector: {"infra-*", "audit-*"}},
+			AuthAdminRole:          "admin_reader",
+			AuthBulkDenyMode:       config.BulkDenyRequest,
+		}
+	})
+
+	JustBeforeEach(func() {
+		var err error
+		handler, err = newBulkHandler(opts)
+		Expect(err).To(BeNil())
+		fixture = test.NewRequestFixture(handler)
+		fixture.Subject = collector
+	})
+
+	Context("when denying the request", func() {
+
+		It("should pass the actions for permitted indices", func() {
+			body := `{"index":{"_index":"app-foo-000001","_id":"1"}}
+{"message":"started"}
+{"delete":{"_index":"app-bar-000001","_id":"2"}}
+
+{"update":{"_index":".kibana","_id":"config"}}
+{"doc":{"theme":"dark"}}
+{"create":{"_index":"<app-foo-{now/d}>"}}
+{"message":"stopped"}`
+			req := process("/_bulk", body)
+			Expect(test.Read(req.Body)).To(Equal(body))
+			Expect(req.Header.Get("Accept-Encoding")).To(Equal("gzip"))
+		})
+
+		It("should fail the request on an action for a forbidden index", func() {
+			req := process("/_bulk", `{"index":{"_index":"app-foo-000001"}}
+{"message":"started"}
+{"index":{"_index":"app-other-000001"}}
+{"message":"started"}
+`)
+			data, err := test.Read(req.Body)
+			Expect(data).To(Equal("{\"index\":{\"_index\":\"app-foo-000001\"}}\n{\"message\":\"started\"}\n"))
+			Expect(test.Failure(err, http.StatusForbidden)).To(Equal("Forbidden index app-other-000001 in bulk index on line 3"))
+		})
+
+		It("should check actions without an index against the index of the path", func() {
+			_, err := test.Read(process("/app-foo-000001/_bulk", "{\"index\":{}}\n{}\n").Body)
+			Expect(err).To(BeNil())
+			_, err = test.Read(process("/app-foo-000001/_bulk", "{\"index\":{\"_index\":\"app-other-000001\"}}\n{}\n").Body)
+			Expect(test.Failure(err, http.StatusForbidden)).To(Equal("Forbidden index app-other-000001 in bulk index on line 1"))
+		})
+
+		It("should check the actions of bulk requests for the indices of Kibana", func() {
+			_, err := test.Read(process("/.kibana/_bulk", "{\"index\":{\"_id\":\"config\"}}\n{}\n").Body)
+			Expect(err).To(BeNil())
+			_, err = test.Read(process("/.kibana/_bulk", "{\"index\":{\"_index\":\"app-other-000001\"}}\n{}\n").Body)
+			Expect(test.Failure(err, http.StatusForbidden)).To(Equal("Forbidden index app-other-000001 in bulk index on line 1"))
+		})
+
+		It("should not mistake a source for an action", func() {
+			_, err := test.Read(process("/_bulk", "{\"index\":{\"_index\":\"app-foo-000001\"}}\n{\"delete\":{\"_index\":\"app-other-000001\"}}\n").Body)
+			Expect(err).To(BeNil())
+		})
+
+		It("should fail the request on a malformed action", func() {
+			_, err := test.Read(process("/_bulk", "{\"index\":{\"_index\":\"app-foo-000001\"}}\n{}\nnot json\n").Body)
+			Expect(test.Failure(err, http.StatusBadRequest)).To(Equal("Unable to parse the bulk action on line 3"))
+			_, err = test.Read(process("/_bulk", "{\"upsert\":{\"_index\":\"app-foo-000001\"}}\n{}\n").Body)
+			Expect(test.Failure(err, http.StatusBadRequest)).To(Equal("Unknown bulk action upsert on line 1"))
+		})
+
+		It("should only pass the actions of users for their own indices of Kibana", func() {
+			_, err := test.Read(process("/_bulk", "{\"index\":{\"_index\":\""+elasticsearch.KibanaUserIndex("alice")+"\"}}\n{}\n").Body)
+			Expect(err).To(BeNil())
+			_, err = test.Read(process("/_bulk", "{\"index\":{\"_index\":\""+elasticsearch.KibanaUserIndex("bob")+"\"}}\n{}\n").Body)
+			Expect(test.Failure(err, http.StatusForbidden)).To(Equal("Forbidden index " + elasticsearch.KibanaUserIndex("bob") + " in bulk index on line 1"))
+		})
+
+		It("should check the actions of certificates against their patterns", func() {
+			fixture.AuthMethod = handlers.AuthMethodCertificate
+			fixture.Roles = []string{}
+			_, err := test.Read(process("/_bulk", "{\"index\":{\"_index\":\"infra-000001\"}}\n{}\n").Body)
+			Expect(err).To(BeNil())
+			_, err = test.Read(process("/_bulk", "{\"index\":{\"_index\":\"app-foo-000001\"}}\n{}\n").Body)
+			Expect(test.Failure(err, http.StatusForbidden)).To(Equal("Forbidden index app-foo-000001 in bulk index on line 1"))
+			_, err = test.Read(process("/_bulk", "{\"update\":{\"_index\":\".kibana\",\"_id\":\"config\"}}\n{}\n").Body)
+			Expect(test.Failure(err, http.StatusForbidden)).To(Equal("Forbidden index .kibana in bulk update on line 1"))
+		})
+
+		It("should not inspect the actions of the admin role or certificates without patterns", func() {
+			fixture.Roles = []string{"admin_reader"}
+			body := "{\"index\":{\"_index\":\"app-other-000001\"}}\n{}\n"
+			Expect(test.Read(process("/_bulk", body).Body)).To(Equal(body))
+
+			opts.AuthCertificateIndices = map[string][]string{}
+			handler, _ = newBulkHandler(opts)
+			fixture.Handler = handler
+			fixture.AuthMethod = handlers.AuthMethodCertificate
+			fixture.Roles = []string{}
+			Expect(test.Read(process("/_bulk", body).Body)).To(Equal(body))
+		})
+	})
+
+	Context("when denying items", func() {
+
+		BeforeEach(func() {
+			opts.AuthBulkDenyMode = config.BulkDenyItem
+		})
+
+		It("should remove forbidden items and add their errors to the response", func() {
+			req := process("/_bulk?refresh=true&filter_path=items.*.error", `{"index":{"_index":"app-other-000001","_id":"1"}}
+{"message":"started"}
+{"index":{"_index":"app-foo-000001","_id":"2"}}
+{"message":"started"}
+{"delete":{"_index":"infra-000001","_id":"3"}}
+{"create":{"_index":"app-bar-000001"}}
+{"message":"stopped"}
+`)
+			Expect(req.RequestURI).To(Equal("/_bulk?refresh=true"))
+			Expect(req.ContentLength).To(BeEquivalentTo(-1))
+			Expect(req.Header.Get("Accept-Encoding")).To(BeEmpty())
+			Expect(test.Read(req.Body)).To(Equal(`{"index":{"_index":"app-foo-000001","_id":"2"}}
+{"message":"started"}
+{"create":{"_index":"app-bar-000001"}}
+{"message":"stopped"}
+`))
+
+			resp := respondJSON(req, http.StatusOK, `{"took":3,"errors":false,"items":[{"index":{"_index":"app-foo-000001","_id":"2","status":201}},{"create":{"_index":"app-bar-000001","_id":"x","status":201}}]}`)
+			data, err := ioutil.ReadAll(resp.Body)
+			Expect(err).To(BeNil())
+			Expect(resp.ContentLength).To(BeEquivalentTo(len(data)))
+			Expect(string(data)).To(Equal(`{"errors":true,"items":[` +
+				`{"index":{"_index":"app-other-000001","_id":"1","status":403,"error":{"type":"security_exception","reason":"Forbidden index app-other-000001"}}},` +
+				`{"index":{"_index":"app-foo-000001","_id":"2","status":201}},` +
+				`{"delete":{"_index":"infra-000001","_id":"3","status":403,"error":{"type":"security_exception","reason":"Forbidden index infra-000001"}}},` +
+				`{"create":{"_index":"app-bar-000001","_id":"x","status":201}}],"took":3}`))
+		})
+
+		It("should respond with the errors of every item when all are forbidden", func() {
+			req := process("/_bulk", "{\"index\":{\"_index\":\"app-other-000001\"}}\n{}\n")
+			Expect(test.Read(req.Body)).To(BeEmpty())
+			resp := respondJSON(req, http.StatusBadRequest, `{"error":{"type":"action_request_validation_exception"},"status":400}`)
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			data, _ := ioutil.ReadAll(resp.Body)
+			Expect(string(data)).To(Equal(`{"errors":true,"items":[{"index":{"_index":"app-other-000001","status":403,"error":{"type":"security_exception","reason":"Forbidden index app-other-000001"}}}],"took":0}`))
+		})
+
+		It("should leave responses as they are without forbidden items", func() {
+			req := process("/_bulk", "{\"index\":{\"_index\":\"app-foo-000001\"}}\n{}\n")
+			_, err := test.Read(req.Body)
+			Expect(err).To(BeNil())
+			body := `{"took":1,"errors":false,"items":[{"index":{"status":201}}]}`
+			data, _ := ioutil.ReadAll(respondJSON(req, http.StatusOK, body).Body)
+			Expect(string(data)).To(Equal(body))
+		})
+	})
+})
+
+var _ = Describe("NewHandlers", func() {
+	It("should not return a handler without index patterns of projects or certificates", func() {
+		Expect(NewHandlers(&config.Options{})).To(BeEmpty())
+		Expect(NewHandlers(&config.Options{AuthCertificateIndices: map[string][]string{collector: {"infra-*"}}})).To(HaveLen(1))
+	})
+})
@@ -0,0 +1,167 @@
+package bulk
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/openshift/elasticsearch-proxy/pkg/handlers"
+)
+
+// actions are the bulk actions and whether they are followed by a source line
+var actions = map[string]bool{
+	"index":  true,
+	"create": true,
+	"update": true,
+	"delete": false,
+}
+
+// inspector checks the index of each action of a bulk body as it is read. Only the line being
+// read is held so bodies of any size are inspected as they are sent to Elasticsearch
+type inspector struct {
+	body         io.ReadCloser
+	reader       *bufio.Reader
+	permissions  *permissions
+	defaultIndex string
+	//dropItems removes forbidden items instead of failing the request
+	dropItems bool
+	logger    *log.Entry
+
+	line int
+	//source is true when the next line is the source of the last action
+	source bool
+	//skip is true when the source of the last action is removed with it
+	skip bool
+	//response answers the actions removed from the request
+	response *handlers.MergedResponse
+	//pending is the data not read yet
+	pending []byte
+	err     error
+}
+
+func newInspector(body io.ReadCloser, permissions *permissions, defaultIndex string, dropItems bool, logger *log.Entry) *inspector {
+	return &inspector{
+		body:         body,
+		reader:       bufio.NewReader(body),
+		permissions:  permissions,
+		defaultIndex: defaultIndex,
+		dropItems:    dropItems,
+		logger:       logger,
+		response:     handlers.NewMergedResponse("bulk", "items", map[string]json.RawMessage{"errors": json.RawMessage("true")}),
+	}
+}
+
+func (i *inspector) Read(p []byte) (int, error) {
+	for len(i.pending) == 0 {
+		if i.err != nil {
+			return 0, i.err
+		}
+		line, err := i.reader.ReadBytes('\n')
+		i.err = err
+		if len(line) == 0 {
+			continue
+		}
+		i.line++
+		if i.source {
+			i.source = false
+			if i.skip {
+				i.skip = false
+				continue
+			}
+			i.pending = line
+			continue
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			// empty lines are skipped by Elasticsearch where an action is expected
+			i.pending = line
+			continue
+		}
+		forward, err := i.inspectAction(line)
+		if err != nil {
+			i.err = &handlers.RequestBodyError{Err: err}
+			return 0, i.err
+		}
+		if forward {
+			i.pending = line
+		}
+	}
+	n := copy(p, i.pending)
+	i.pending = i.pending[n:]
+	return n, nil
+}
+
+func (i *inspector) Close() error {
+	return i.body.Close()
+}
+
+// inspectAction returns true when the action is for an index which is permitted. A forbidden
+// action is removed, with its source, when items are dropped and fails the request otherwise
+func (i *inspector) inspectAction(line []byte) (bool, error) {
+	action := map[string]json.RawMessage{}
+	if err := json.Unmarshal(line, &action); err != nil || len(action) != 1 {
+		return false, handlers.NewError("400", fmt.Sprintf("Unable to parse the bulk action on line %d", i.line))
+	}
+	name := ""
+	var rawMetadata json.RawMessage
+	for key, value := range action {
+		name, rawMetadata = key, value
+	}
+	hasSource, known := actions[name]
+	if !known {
+		return false, handlers.NewError("400", fmt.Sprintf("Unknown bulk action %s on line %d", name, i.line))
+	}
+	metadata := struct {
+		Index string          `json:"_index"`
+		ID    json.RawMessage `json:"_id"`
+	}{}
+	if err := json.Unmarshal(rawMetadata, &metadata); err != nil {
+		return false, handlers.NewError("400", fmt.Sprintf("Unable to parse the bulk action on line %d", i.line))
+	}
+	i.source = hasSource
+	index := metadata.Index
+	if index == "" {
+		index = i.defaultIndex
+	}
+	// an action without an index is rejected by Elasticsearch
+	if index == "" || i.permissions.permits(index) {
+		i.response.Forward()
+		return true, nil
+	}
+
+	i.logger.Debugf("Denied bulk %s of index %s outside of the permitted indices on line %d", name, index, i.line)
+	if !i.dropItems {
+		return false, handlers.NewError("403", fmt.Sprintf("Forbidden index %s in bulk %s on line %d", index, name, i.line))
+	}
+	id := ""
+	if err := json.Unmarshal(metadata.ID, &id); err != nil && len(metadata.ID) > 0 {
+		id = string(metadata.ID)
+	}
+	i.skip = hasSource
+	i.response.Deny(deniedResult(name, index, id))
+	return false, nil
+}
+
+type itemResult struct {
+	Index  string              `json:"_index"`
+	ID     string              `json:"_id,omitempty"`
+	Status int                 `json:"status"`
+	Error  handlers.ErrorCause `json:"error"`
+}
+
+// deniedResult returns the item answering an action removed from the request
+func deniedResult(action, index, id string) json.RawMessage {
+	data, _ := json.Marshal(map[string]itemResult{
+		action: {
+			Index:  index,
+			ID:     id,
+			Status: http.StatusForbidden,
+			Error:  handlers.SecurityException("Forbidden index " + index),
+		},
+	})
+	return data
+}
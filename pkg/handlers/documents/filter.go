@@ -0,0 +1,236 @@
+package documents
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/openshift/elasticsearch-proxy/pkg/apis"
+	"github.com/openshift/elasticsearch-proxy/pkg/handlers"
+)
+
+var (
+	matchAll = json.RawMessage(`{"match_all":{}}`)
+
+	// queryStringParams are the parameters of the query given by the q parameter
+	queryStringParams = []string{"q", "df", "default_operator", "analyzer", "analyze_wildcard", "lenient"}
+
+	// unfilteredKeys are the parts of a search body whose results are not restricted by its query
+	unfilteredKeys = []string{"suggest", "knn"}
+
+	// aggregationKeys are the keys of the aggregations of a search body or of an aggregation
+	aggregationKeys = map[string]bool{"aggs": true, "aggregations": true}
+)
+
+// namespaceFilter restricts the query of a search to the documents of projects
+type namespaceFilter struct {
+	terms json.RawMessage
+}
+
+func newNamespaceFilter(field string, projects []apis.Project) *namespaceFilter {
+	names := make([]string, 0, len(projects))
+	for _, project := range projects {
+		names = append(names, project.Name)
+	}
+	terms, _ := json.Marshal(map[string]interface{}{
+		"terms": map[string][]string{field: names},
+	})
+	return &namespaceFilter{terms: terms}
+}
+
+// wrap returns a bool query matching the documents of the query which belong to the projects.
+// The query is required so the scores of its documents are kept
+func (f *namespaceFilter) wrap(query json.RawMessage) json.RawMessage {
+	if len(bytes.TrimSpace(query)) == 0 || string(bytes.TrimSpace(query)) == "null" {
+		query = matchAll
+	}
+	wrapped, _ := json.Marshal(map[string]interface{}{
+		"bool": map[string][]json.RawMessage{
+			"must":   {query},
+			"filter": {f.terms},
+		},
+	})
+	return wrapped
+}
+
+// apply returns the search body with its query wrapped by the filter
+func (f *namespaceFilter) apply(body map[string]json.RawMessage) ([]byte, error) {
+	for _, key := range unfilteredKeys {
+		if _, found := body[key]; found {
+			return nil, handlers.NewError("403", "Forbidden to search with "+key+" when documents are filtered by namespace")
+		}
+	}
+	for key, raw := range body {
+		var value interface{}
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, handlers.NewError("400", "Unable to parse the search body")
+		}
+		if part := unfilteredPart(key, value); part != "" {
+			return nil, handlers.NewError("403", "Forbidden to search with "+part+" when documents are filtered by namespace")
+		}
+	}
+	body["query"] = f.wrap(body["query"])
+	return json.Marshal(body)
+}
+
+// unfilteredPart returns the name of the part of the value given for the key of a search body whose
+// results are not restricted by its query, at any depth. global aggregations are for every document
+// of the targets while terms lookups, more like this documents, indexed shapes and percolated
+// documents are read from a document of any index
+func unfilteredPart(key string, value interface{}) string {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		if aggregationKeys[key] {
+			for _, aggregation := range value {
+				if aggregation, ok := aggregation.(map[string]interface{}); ok {
+					if _, found := aggregation["global"]; found {
+						return "global aggregations"
+					}
+				}
+			}
+		}
+		switch {
+		case key == "terms" && isTermsLookup(value):
+			return "terms lookups"
+		case key == "more_like_this" && (hasDocuments(value["like"]) || hasDocuments(value["unlike"])):
+			return "more like this documents"
+		case (key == "geo_shape" || key == "shape") && hasIndexedShape(value):
+			return "indexed shapes"
+		case key == "percolate" && (value["index"] != nil || value["id"] != nil):
+			return "percolated documents"
+		}
+		for child, childValue := range value {
+			if part := unfilteredPart(child, childValue); part != "" {
+				return part
+			}
+		}
+	case []interface{}:
+		for _, item := range value {
+			if part := unfilteredPart("", item); part != "" {
+				return part
+			}
+		}
+	}
+	return ""
+}
+
+// isTermsLookup returns true when a terms query gives the terms of a field by the document
+// holding them, i.e. {"user.id":{"index":"users","id":"2","path":"followers"}}
+func isTermsLookup(terms map[string]interface{}) bool {
+	for _, value := range terms {
+		if lookup, ok := value.(map[string]interface{}); ok {
+			_, id := lookup["id"]
+			_, path := lookup["path"]
+			if id && path {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasDocuments returns true when the like or unlike of a more like this query names a document by
+// its index or ID, i.e. [{"_index":"users","_id":"2"},"text"]
+func hasDocuments(like interface{}) bool {
+	items, ok := like.([]interface{})
+	if !ok {
+		items = []interface{}{like}
+	}
+	for _, item := range items {
+		if item, ok := item.(map[string]interface{}); ok {
+			_, index := item["_index"]
+			_, id := item["_id"]
+			if index || id {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasIndexedShape returns true when a shape query gives the shape of a field by the document
+// holding it, i.e. {"location":{"indexed_shape":{"index":"shapes","id":"2"}}}
+func hasIndexedShape(shape map[string]interface{}) bool {
+	for _, value := range shape {
+		if field, ok := value.(map[string]interface{}); ok {
+			if _, found := field["indexed_shape"]; found {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// filterSearch returns the request with the query of its body filtered. The source and q parameters,
+// which are used instead of the body by Elasticsearch, are moved to the body
+func filterSearch(req *http.Request, filter *namespaceFilter, maxBodySize int64) (*http.Request, error) {
+	data, err := handlers.ReadBody(req, maxBodySize)
+	if err != nil {
+		return req, err
+	}
+	req = req.Clone(req.Context())
+	params := req.URL.Query()
+	rewriteQuery := false
+	if len(bytes.TrimSpace(data)) == 0 && params.Get("source") != "" {
+		data = []byte(params.Get("source"))
+		params.Del("source")
+		params.Del("source_content_type")
+		rewriteQuery = true
+	}
+	body := map[string]json.RawMessage{}
+	if len(bytes.TrimSpace(data)) > 0 {
+		if err := json.Unmarshal(data, &body); err != nil {
+			return req, handlers.NewError("400", "Unable to parse the search body")
+		}
+	}
+	if _, found := params["q"]; found {
+		query, err := queryString(params)
+		if err != nil {
+			return req, err
+		}
+		body["query"] = query
+		for _, param := range queryStringParams {
+			params.Del(param)
+		}
+		rewriteQuery = true
+	}
+	if data, err = filter.apply(body); err != nil {
+		return req, err
+	}
+	if rewriteQuery {
+		req.URL.RawQuery = params.Encode()
+		// the request is proxied to its RequestURI to keep encoded slashes of the path
+		req.RequestURI = req.URL.RequestURI()
+	}
+	handlers.SetBody(req, data, "application/json")
+	return req, nil
+}
+
+// queryString returns the query_string query given by the q parameter
+func queryString(params url.Values) (json.RawMessage, error) {
+	query := map[string]interface{}{"query": params.Get("q")}
+	for param, name := range map[string]string{"df": "default_field", "default_operator": "default_operator", "analyzer": "analyzer"} {
+		if value := params.Get(param); value != "" {
+			query[name] = value
+		}
+	}
+	for _, param := range []string{"analyze_wildcard", "lenient"} {
+		values, found := params[param]
+		if !found {
+			continue
+		}
+		// a parameter given without a value is true
+		enabled := true
+		if len(values) > 0 && values[0] != "" {
+			var err error
+			if enabled, err = strconv.ParseBool(values[0]); err != nil {
+				return nil, handlers.NewError("400", fmt.Sprintf("Invalid value %q of parameter %s", values[0], param))
+			}
+		}
+		query[param] = enabled
+	}
+	return json.Marshal(map[string]interface{}{"query_string": query})
+}
@@ -0,0 +1,129 @@
+package documents
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/openshift/elasticsearch-proxy/pkg/apis"
+	"github.com/openshift/elasticsearch-proxy/pkg/config"
+	"github.com/openshift/elasticsearch-proxy/pkg/elasticsearch"
+	"github.com/openshift/elasticsearch-proxy/pkg/handlers"
+)
+
+const (
+	megabyte = 1024 * 1024
+)
+
+type documentsHandler struct {
+	//lock guards field, adminRole and maxBodySize which are replaced on Reload
+	lock      sync.RWMutex
+	field     string
+	adminRole string
+	//maxBodySize is the size in bytes of the largest body filtered. Zero means no limit
+	maxBodySize int64
+}
+
+// NewHandlers is the initializer for this handler. No handler is returned when the
+// namespace field is not configured
+func NewHandlers(opts *config.Options) []handlers.RequestHandler {
+	if opts.AuthNamespaceField == "" {
+		return []handlers.RequestHandler{}
+	}
+	return []handlers.RequestHandler{newDocumentsHandler(opts)}
+}
+
+func newDocumentsHandler(opts *config.Options) *documentsHandler {
+	return &documentsHandler{
+		field:       opts.AuthNamespaceField,
+		adminRole:   opts.AuthAdminRole,
+		maxBodySize: int64(opts.AuthNamespaceFilterMaxBodySize) * megabyte,
+	}
+}
+
+func (h *documentsHandler) Name() string {
+	return "documents"
+}
+
+// Reload replaces the namespace field, admin role and body limit with those of the given options.
+// Removing the namespace field requires a restart
+func (h *documentsHandler) Reload(opts *config.Options) error {
+	if opts.AuthNamespaceField == "" {
+		log.Warn("Keeping the namespace field as auth-namespace-field can not be removed without a restart")
+		return nil
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.field = opts.AuthNamespaceField
+	h.adminRole = opts.AuthAdminRole
+	h.maxBodySize = int64(opts.AuthNamespaceFilterMaxBodySize) * megabyte
+	log.Infof("Reloaded the namespace field %s", opts.AuthNamespaceField)
+	return nil
+}
+
+func (h *documentsHandler) current() (string, string, int64) {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	return h.field, h.adminRole, h.maxBodySize
+}
+
+// Process filters the searches of users to the documents of their projects by wrapping the query
+// of the body in a bool query with a filter on the namespace field. Searches which can not be
+// filtered are rejected. Requests of users with the admin role and of certificates are left to the
+// request handlers deciding their roles
+func (h *documentsHandler) Process(req *http.Request) (*http.Request, error) {
+	logger := handlers.Logger(req.Context())
+	ctx := req.Context()
+	if method, _ := ctx.Value(handlers.AuthMethodKey).(string); method != handlers.AuthMethodToken {
+		return req, nil
+	}
+	field, adminRole, maxBodySize := h.current()
+	roles, _ := ctx.Value(handlers.RolesKey).([]string)
+	for _, role := range roles {
+		if adminRole != "" && role == adminRole {
+			logger.Trace("Allowing every document to the admin role")
+			return req, nil
+		}
+	}
+	esRequest := handlers.ESRequest(ctx)
+	// the searches of a multi search are each decided by their header
+	if esRequest == nil || (esRequest.Endpoint != "_msearch" && isKibana(esRequest.Indices)) {
+		return req, nil
+	}
+	projects, _ := ctx.Value(handlers.ProjectsKey).([]apis.Project)
+	filter := newNamespaceFilter(field, projects)
+
+	switch esRequest.Endpoint {
+	case "_search", "_count":
+		return filterSearch(req, filter, maxBodySize)
+	case "_async_search":
+		// async searches are submitted with POST and then retrieved or deleted by their ID
+		if req.Method != http.MethodPost {
+			return req, nil
+		}
+		return filterSearch(req, filter, maxBodySize)
+	case "_msearch":
+		return filterMultiSearch(req, filter, isKibana(esRequest.Indices), maxBodySize)
+	case "_search/template", "_msearch/template", "_rank_eval", "_knn_search", "_terms_enum":
+		// the documents searched by these APIs are not given by a query which can be filtered
+		logger.Debugf("Denied %s of documents which can not be filtered by namespace", esRequest.Endpoint)
+		return req, handlers.NewError("403", "Forbidden to "+esRequest.Endpoint+" when documents are filtered by namespace")
+	}
+	// scroll continuations keep the query of the filtered search which opened them
+	return req, nil
+}
+
+// isKibana returns true when the targets are only indices of Kibana, which do not have namespaces
+func isKibana(targets []string) bool {
+	if len(targets) == 0 {
+		return false
+	}
+	for _, target := range targets {
+		if !elasticsearch.IsKibanaIndex(strings.TrimSpace(target)) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,205 @@
+package documents
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/openshift/elasticsearch-proxy/pkg/config"
+	"github.com/openshift/elasticsearch-proxy/pkg/handlers"
+	"github.com/openshift/elasticsearch-proxy/test"
+)
+
+const (
+	filter = `{"terms":{"kubernetes.namespace_name":["foo","bar"]}}`
+)
+
+var _ = Describe("Process", func() {
+
+	var (
+		fixture *test.RequestFixture
+
+		filtered = func(method, path, body string) string {
+			req, err := fixture.Process(method, path, body)
+			Expect(err).To(BeNil())
+			data, err := test.Read(req.Body)
+			Expect(err).To(BeNil())
+			Expect(req.ContentLength).To(BeEquivalentTo(len(data)))
+			return data
+		}
+		wrapped = func(query string) string {
+			return `{"bool":{"filter":[` + filter + `],"must":[` + query + `]}}`
+		}
+	)
+
+	BeforeEach(func() {
+		fixture = test.NewRequestFixture(newDocumentsHandler(&config.Options{
+			AuthNamespaceField:             "kubernetes.namespace_name",
+			AuthNamespaceFilterMaxBodySize: 1,
+			AuthAdminRole:                  "admin_reader",
+		}))
+	})
+
+	It("should wrap the query of searches and counts", func() {
+		Expect(filtered("POST", "/app-write/_search", `{"query":{"match":{"message":"error"}},"size":5,"aggs":{"levels":{"terms":{"field":"level"}}}}`)).To(Equal(
+			`{"aggs":{"levels":{"terms":{"field":"level"}}},"query":` + wrapped(`{"match":{"message":"error"}}`) + `,"size":5}`))
+		Expect(filtered("GET", "/app-write/_count", `{"query":{"term":{"level":"info"}}}`)).To(Equal(
+			`{"query":` + wrapped(`{"term":{"level":"info"}}`) + `}`))
+	})
+
+	It("should filter searches without a body or query", func() {
+		req, err := fixture.Process("GET", "/app-write/_search", "")
+		Expect(err).To(BeNil())
+		Expect(req.Header.Get("Content-Type")).To(Equal("application/json"))
+		data, _ := test.Read(req.Body)
+		Expect(data).To(Equal(`{"query":` + wrapped(`{"match_all":{}}`) + `}`))
+		Expect(filtered("POST", "/app-write/_search", `{"size":0}`)).To(Equal(`{"query":` + wrapped(`{"match_all":{}}`) + `,"size":0}`))
+	})
+
+	It("should filter submitted async searches", func() {
+		Expect(filtered("POST", "/app-write/_async_search", `{"query":{"match_all":{}}}`)).To(Equal(`{"query":` + wrapped(`{"match_all":{}}`) + `}`))
+		Expect(filtered("GET", "/_async_search/FmRldE8zREVEUzA2ZVpUeGs2ejJFUFEaMkZ5QTVrSTZSaVN3WlNFVmtlWHJsdzoxMDc=", "")).To(BeEmpty())
+	})
+
+	It("should move the q and source parameters to the body", func() {
+		req, err := fixture.Process("GET", "/app-write/_search?q=level:error&df=message&lenient&size=1", "")
+		Expect(err).To(BeNil())
+		Expect(req.RequestURI).To(Equal("/app-write/_search?size=1"))
+		data, _ := test.Read(req.Body)
+		Expect(data).To(Equal(`{"query":` + wrapped(`{"query_string":{"default_field":"message","lenient":true,"query":"level:error"}}`) + `}`))
+
+		req, err = fixture.Process("GET", `/app-write/_search?source={"query":{"match_all":{}}}&source_content_type=application/json`, "")
+		Expect(err).To(BeNil())
+		Expect(req.RequestURI).To(Equal("/app-write/_search"))
+		data, _ = test.Read(req.Body)
+		Expect(data).To(Equal(`{"query":` + wrapped(`{"match_all":{}}`) + `}`))
+	})
+
+	It("should wrap the query of each search of multi searches", func() {
+		body := `{"index":"app-write"}
+{"query":{"match":{"message":"error"}}}
+
+{}
+{"indices":[".kibana"]}
+{"query":{"match_all":{}}}
+`
+		req, err := fixture.Process("POST", "/_msearch", body)
+		Expect(err).To(BeNil())
+		Expect(req.Header.Get("Content-Type")).To(Equal("application/x-ndjson"))
+		data, _ := test.Read(req.Body)
+		Expect(data).To(Equal(`{"index":"app-write"}
+{"query":` + wrapped(`{"match":{"message":"error"}}`) + `}
+
+{"query":` + wrapped(`{"match_all":{}}`) + `}
+{"indices":[".kibana"]}
+{"query":{"match_all":{}}}
+`))
+	})
+
+	It("should fail multi searches on search bodies which can not be filtered", func() {
+		req, err := fixture.Process("POST", "/_msearch", "{}\n{\"query\":{\"match_all\":{}}}\n{}\n"+strings.Repeat(" ", 1024*1024)+"{}\n")
+		Expect(err).To(BeNil())
+		data, err := test.Read(req.Body)
+		Expect(data).To(Equal("{}\n{\"query\":" + wrapped(`{"match_all":{}}`) + "}\n{}\n"))
+		var bodyErr *handlers.RequestBodyError
+		Expect(errors.As(err, &bodyErr)).To(BeTrue())
+		Expect(test.Failure(bodyErr.Err, http.StatusRequestEntityTooLarge)).To(Equal("Search body larger than 1048576 bytes can not be filtered on line 4"))
+
+		req, err = fixture.Process("POST", "/_msearch", "{}\nnot json\n")
+		Expect(err).To(BeNil())
+		_, err = test.Read(req.Body)
+		Expect(errors.As(err, &bodyErr)).To(BeTrue())
+		Expect(test.Failure(bodyErr.Err, http.StatusBadRequest)).To(Equal("Unable to parse the search body on line 2"))
+	})
+
+	It("should decide the searches of multi searches of Kibana by their header", func() {
+		body := `{}
+{"query":{"match_all":{}}}
+{"index":"app-write"}
+{"query":{"match_all":{}}}
+`
+		req, err := fixture.Process("POST", "/.kibana/_msearch", body)
+		Expect(err).To(BeNil())
+		data, _ := test.Read(req.Body)
+		Expect(data).To(Equal(`{}
+{"query":{"match_all":{}}}
+{"index":"app-write"}
+{"query":` + wrapped(`{"match_all":{}}`) + `}
+`))
+	})
+
+	It("should filter the search after an empty first line of multi searches", func() {
+		req, err := fixture.Process("POST", "/app-write/_msearch", "\n{\"index\":\"app-write\"}\n{\"query\":{\"match_all\":{}}}\n")
+		Expect(err).To(BeNil())
+		Expect(test.Read(req.Body)).To(Equal("{\"index\":\"app-write\"}\n{\"query\":" + wrapped(`{"match_all":{}}`) + "}\n"))
+	})
+
+	It("should fail multi searches on a header giving both index and indices", func() {
+		req, err := fixture.Process("POST", "/_msearch", "{\"index\":\".kibana\",\"indices\":\"app-write\"}\n{}\n")
+		Expect(err).To(BeNil())
+		_, err = test.Read(req.Body)
+		var bodyErr *handlers.RequestBodyError
+		Expect(errors.As(err, &bodyErr)).To(BeTrue())
+		Expect(test.Failure(bodyErr.Err, http.StatusBadRequest)).To(Equal("Unable to parse the index of the multi search header on line 1: both index and indices are given"))
+	})
+
+	It("should leave scroll continuations and searches of Kibana as they are", func() {
+		Expect(filtered("POST", "/_search/scroll", `{"scroll":"1m","scroll_id":"abc"}`)).To(Equal(`{"scroll":"1m","scroll_id":"abc"}`))
+		Expect(filtered("POST", "/.kibana/_search", `{"query":{"match_all":{}}}`)).To(Equal(`{"query":{"match_all":{}}}`))
+		Expect(filtered("POST", "/app-write/_doc", `{"message":"error"}`)).To(Equal(`{"message":"error"}`))
+	})
+
+	It("should deny searches which can not be filtered", func() {
+		_, err := fixture.Process("POST", "/app-write/_search/template", `{"id":"abc"}`)
+		Expect(test.Failure(err, http.StatusForbidden)).To(Equal("Forbidden to _search/template when documents are filtered by namespace"))
+		_, err = fixture.Process("POST", "/app-write/_search", `{"suggest":{"text":"eror","s":{"term":{"field":"message"}}}}`)
+		Expect(test.Failure(err, http.StatusForbidden)).To(Equal("Forbidden to search with suggest when documents are filtered by namespace"))
+		_, err = fixture.Process("POST", "/app-write/_search", `{"aggs":{"all":{"global":{},"aggs":{"levels":{"terms":{"field":"level"}}}}}}`)
+		Expect(test.Failure(err, http.StatusForbidden)).To(Equal("Forbidden to search with global aggregations when documents are filtered by namespace"))
+		_, err = fixture.Process("POST", "/app-write/_search", `{"aggs":{"levels":{"terms":{"field":"level"},"aggregations":{"all":{"global":{}}}}}}`)
+		Expect(test.Failure(err, http.StatusForbidden)).To(Equal("Forbidden to search with global aggregations when documents are filtered by namespace"))
+		_, err = fixture.Process("POST", "/app-write/_search", `{"query":{"bool":{"should":[{"terms":{"level":{"index":"infra-000001","id":"1","path":"level"}}}]}}}`)
+		Expect(test.Failure(err, http.StatusForbidden)).To(Equal("Forbidden to search with terms lookups when documents are filtered by namespace"))
+		_, err = fixture.Process("POST", "/app-write/_search", `{"query":{"more_like_this":{"fields":["message"],"like":["error",{"_index":"infra-000001","_id":"1"}]}}}`)
+		Expect(test.Failure(err, http.StatusForbidden)).To(Equal("Forbidden to search with more like this documents when documents are filtered by namespace"))
+		_, err = fixture.Process("POST", "/app-write/_search", `{"query":{"more_like_this":{"fields":["message"],"like":"error","unlike":{"_id":"1"}}}}`)
+		Expect(test.Failure(err, http.StatusForbidden)).To(Equal("Forbidden to search with more like this documents when documents are filtered by namespace"))
+		_, err = fixture.Process("POST", "/app-write/_search", `{"query":{"bool":{"filter":{"geo_shape":{"location":{"indexed_shape":{"index":"infra-000001","id":"1","path":"location"}}}}}}}`)
+		Expect(test.Failure(err, http.StatusForbidden)).To(Equal("Forbidden to search with indexed shapes when documents are filtered by namespace"))
+		_, err = fixture.Process("POST", "/app-write/_search", `{"query":{"percolate":{"field":"query","index":"infra-000001","id":"1"}}}`)
+		Expect(test.Failure(err, http.StatusForbidden)).To(Equal("Forbidden to search with percolated documents when documents are filtered by namespace"))
+		Expect(filtered("POST", "/app-write/_search", `{"query":{"more_like_this":{"fields":["message"],"like":"error"}}}`)).To(Equal(
+			`{"query":` + wrapped(`{"more_like_this":{"fields":["message"],"like":"error"}}`) + `}`))
+		req, err := fixture.Process("POST", "/_msearch", "{}\n{\"aggs\":{\"all\":{\"global\":{}}}}\n")
+		Expect(err).To(BeNil())
+		_, err = test.Read(req.Body)
+		var bodyErr *handlers.RequestBodyError
+		Expect(errors.As(err, &bodyErr)).To(BeTrue())
+		Expect(test.Failure(bodyErr.Err, http.StatusForbidden)).To(Equal("Forbidden to search with global aggregations when documents are filtered by namespace"))
+	})
+
+	It("should reject bodies which can not be filtered", func() {
+		_, err := fixture.Process("POST", "/app-write/_search", `[]`)
+		Expect(test.Failure(err, http.StatusBadRequest)).To(Equal("Unable to parse the search body"))
+		_, err = fixture.Process("POST", "/app-write/_search", `{"query":{"match_all":{}}}`+strings.Repeat(" ", 1024*1024))
+		Expect(test.Failure(err, http.StatusRequestEntityTooLarge)).To(Equal("Request body larger than 1048576 bytes can not be inspected"))
+	})
+
+	It("should not filter the searches of the admin role or certificates", func() {
+		fixture.Roles = []string{"admin_reader"}
+		Expect(filtered("POST", "/app-write/_search", `{"query":{"match_all":{}}}`)).To(Equal(`{"query":{"match_all":{}}}`))
+		fixture.Roles = []string{"project_user"}
+		fixture.AuthMethod = handlers.AuthMethodCertificate
+		Expect(filtered("POST", "/app-write/_search", `{"query":{"match_all":{}}}`)).To(Equal(`{"query":{"match_all":{}}}`))
+	})
+})
+
+var _ = Describe("NewHandlers", func() {
+	It("should not return a handler without a namespace field", func() {
+		Expect(NewHandlers(&config.Options{})).To(BeEmpty())
+		Expect(NewHandlers(&config.Options{AuthNamespaceField: "kubernetes.namespace_name"})).To(HaveLen(1))
+	})
+})
@@ -0,0 +1,159 @@
+package documents
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/openshift/elasticsearch-proxy/pkg/elasticsearch"
+	"github.com/openshift/elasticsearch-proxy/pkg/handlers"
+)
+
+// filterMultiSearch returns the request with the query of each search of its body filtered as it is
+// sent to Elasticsearch. The searches whose header names no index are for the targets of the path
+func filterMultiSearch(req *http.Request, filter *namespaceFilter, kibanaPath bool, maxBodySize int64) (*http.Request, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req, nil
+	}
+	req = req.Clone(req.Context())
+	req.Body = newMsearchFilter(req.Body, filter, kibanaPath, maxBodySize)
+	// the length of the body is not known until it is read
+	req.ContentLength = -1
+	req.Header.Del("Content-Length")
+	if req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/x-ndjson")
+	}
+	return req, nil
+}
+
+// msearchFilter wraps the query of each search of a multi search body as it is read. Lines alternate
+// between the header and the body of each search so the order of the searches is kept. Only the line
+// being read is held, which must not be larger than the limit. Searches of indices of Kibana are left
+// as they are
+type msearchFilter struct {
+	reader      *bufio.Reader
+	body        io.ReadCloser
+	filter      *namespaceFilter
+	maxLineSize int64
+	//kibanaPath is true when the targets of the path are only indices of Kibana
+	kibanaPath bool
+
+	line int
+	//header is true when the next line is the header of a search
+	header bool
+	//kibana is true when the last header is for indices of Kibana
+	kibana bool
+	//pending is the data not read yet
+	pending []byte
+	err     error
+}
+
+func newMsearchFilter(body io.ReadCloser, filter *namespaceFilter, kibanaPath bool, maxLineSize int64) *msearchFilter {
+	return &msearchFilter{
+		reader:      bufio.NewReader(body),
+		body:        body,
+		filter:      filter,
+		maxLineSize: maxLineSize,
+		kibanaPath:  kibanaPath,
+		header:      true,
+	}
+}
+
+func (f *msearchFilter) Read(p []byte) (int, error) {
+	for len(f.pending) == 0 {
+		if f.err != nil {
+			return 0, f.err
+		}
+		line, err := f.readLine()
+		f.err = err
+		if len(line) == 0 {
+			continue
+		}
+		f.line++
+		if elasticsearch.SkipsMultiSearchLine(f.line, line) {
+			continue
+		}
+		if f.header {
+			f.header = false
+			if f.kibana, err = isKibanaHeader(line, f.kibanaPath); err != nil {
+				f.err = &handlers.RequestBodyError{
+					Err: handlers.NewError("400", fmt.Sprintf("Unable to parse the index of the multi search header on line %d: %v", f.line, err)),
+				}
+				return 0, f.err
+			}
+			f.pending = line
+			continue
+		}
+		f.header = true
+		if f.kibana {
+			f.pending = line
+			continue
+		}
+		if f.pending, err = f.filterLine(line); err != nil {
+			f.err = &handlers.RequestBodyError{Err: err}
+			return 0, f.err
+		}
+	}
+	n := copy(p, f.pending)
+	f.pending = f.pending[n:]
+	return n, nil
+}
+
+func (f *msearchFilter) Close() error {
+	return f.body.Close()
+}
+
+// readLine returns the next line which fails when it is larger than the limit
+func (f *msearchFilter) readLine() ([]byte, error) {
+	line := []byte{}
+	for {
+		chunk, err := f.reader.ReadSlice('\n')
+		line = append(line, chunk...)
+		if f.maxLineSize > 0 && int64(len(line)) > f.maxLineSize {
+			return nil, &handlers.RequestBodyError{
+				Err: handlers.NewError("413", fmt.Sprintf("Search body larger than %d bytes can not be filtered on line %d", f.maxLineSize, f.line+1)),
+			}
+		}
+		if err != bufio.ErrBufferFull {
+			return line, err
+		}
+	}
+}
+
+func (f *msearchFilter) filterLine(line []byte) ([]byte, error) {
+	body := map[string]json.RawMessage{}
+	if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 {
+		if err := json.Unmarshal(trimmed, &body); err != nil {
+			return nil, handlers.NewError("400", fmt.Sprintf("Unable to parse the search body on line %d", f.line))
+		}
+	}
+	data, err := f.filter.apply(body)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasSuffix(line, []byte("\n")) {
+		data = append(data, '\n')
+	}
+	return data, nil
+}
+
+// isKibanaHeader returns true when the header of a search is only for indices of Kibana. Headers
+// naming no index are for the targets of the path. Headers which can not be parsed are filtered and
+// left for Elasticsearch to reject. It returns an error when the index can not be parsed
+func isKibanaHeader(line []byte, kibanaPath bool) (bool, error) {
+	header := map[string]json.RawMessage{}
+	if err := json.Unmarshal(line, &header); err != nil {
+		return false, nil
+	}
+	targets, err := elasticsearch.MultiSearchTargets(header)
+	if err != nil {
+		return false, err
+	}
+	if len(targets) == 0 {
+		return kibanaPath, nil
+	}
+	return isKibana(targets), nil
+}
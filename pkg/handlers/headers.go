@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+)
+
+// identityHeaders identify the user to Elasticsearch besides the X-Forwarded- headers
+var identityHeaders = []string{"Authorization", "X-Ocp-Ns"}
+
+// IsIdentityHeader returns true for the headers identifying the user to Elasticsearch, which are
+// set by the authorization handler
+func IsIdentityHeader(name string) bool {
+	name = http.CanonicalHeaderKey(name)
+	for _, identity := range identityHeaders {
+		if name == identity {
+			return true
+		}
+	}
+	return strings.HasPrefix(name, "X-Forwarded-")
+}
@@ -0,0 +1,229 @@
+package indices
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/openshift/elasticsearch-proxy/pkg/apis"
+	"github.com/openshift/elasticsearch-proxy/pkg/config"
+	"github.com/openshift/elasticsearch-proxy/pkg/elasticsearch"
+	"github.com/openshift/elasticsearch-proxy/pkg/handlers"
+)
+
+const (
+	megabyte = 1024 * 1024
+)
+
+var (
+	// shardListings are the _cat APIs listing the shards, or their documents, of every index
+	// when given no targets
+	shardListings = map[string]bool{
+		"_cat/shards":   true,
+		"_cat/segments": true,
+		"_cat/count":    true,
+		"_cat/recovery": true,
+	}
+)
+
+type indicesHandler struct {
+	//lock guards naming, adminRole, rewrite and maxBodySize which are replaced on Reload
+	lock      sync.RWMutex
+	naming    *elasticsearch.IndexNaming
+	adminRole string
+	//rewrite replaces targets broader than the projects by those of the projects
+	rewrite bool
+	//maxBodySize is the size in bytes of the largest body read for its targets. Zero means no limit
+	maxBodySize int64
+}
+
+// NewHandlers is the initializer for this handler. No handler is returned when index
+// patterns are not configured
+func NewHandlers(opts *config.Options) []handlers.RequestHandler {
+	if len(opts.AuthIndexPatterns) == 0 {
+		return []handlers.RequestHandler{}
+	}
+	handler, err := newIndicesHandler(opts)
+	if err != nil {
+		log.Fatalf("Error constructing the indices handler %v", err)
+	}
+	return []handlers.RequestHandler{handler}
+}
+
+func newIndicesHandler(opts *config.Options) (*indicesHandler, error) {
+	naming, err := elasticsearch.NewIndexNaming(opts.AuthIndexPatterns)
+	if err != nil {
+		return nil, err
+	}
+	return &indicesHandler{
+		naming:      naming,
+		adminRole:   opts.AuthAdminRole,
+		rewrite:     opts.AuthIndexRewrite,
+		maxBodySize: int64(opts.AuthNamespaceFilterMaxBodySize) * megabyte,
+	}, nil
+}
+
+func (h *indicesHandler) Name() string {
+	return "indices"
+}
+
+// Reload replaces the index patterns, admin role, rewriting and body limit with those of the given options. Removing
+// every index pattern requires a restart
+func (h *indicesHandler) Reload(opts *config.Options) error {
+	if len(opts.AuthIndexPatterns) == 0 {
+		log.Warn("Keeping the index patterns as auth-index-pattern can not be removed without a restart")
+		return nil
+	}
+	naming, err := elasticsearch.NewIndexNaming(opts.AuthIndexPatterns)
+	if err != nil {
+		return err
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.naming = naming
+	h.adminRole = opts.AuthAdminRole
+	h.rewrite = opts.AuthIndexRewrite
+	h.maxBodySize = int64(opts.AuthNamespaceFilterMaxBodySize) * megabyte
+	log.Infof("Reloaded %d index patterns", len(opts.AuthIndexPatterns))
+	return nil
+}
+
+func (h *indicesHandler) current() (*elasticsearch.IndexNaming, string, bool, int64) {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	return h.naming, h.adminRole, h.rewrite, h.maxBodySize
+}
+
+// Process rejects requests of users for indices which do not belong to their projects. The targets
+// of searches for every index or patterns broader than the projects are rewritten to those of the
+// projects when configured. The searches of multi searches are authorized, and rewritten, one by one,
+// and the indices of other projects are removed from the responses listing indices. Requests which
+// are not known, and so can not be authorized, are rejected.
+// Requests of users with the admin role and of certificates are left to the request handlers deciding
+// their roles
+func (h *indicesHandler) Process(req *http.Request) (*http.Request, error) {
+	logger := handlers.Logger(req.Context())
+	ctx := req.Context()
+	if method, _ := ctx.Value(handlers.AuthMethodKey).(string); method != handlers.AuthMethodToken {
+		return req, nil
+	}
+	naming, adminRole, rewrite, maxBodySize := h.current()
+	roles, _ := ctx.Value(handlers.RolesKey).([]string)
+	for _, role := range roles {
+		if adminRole != "" && role == adminRole {
+			logger.Trace("Allowing every index to the admin role")
+			return req, nil
+		}
+	}
+	esRequest := handlers.ESRequest(ctx)
+	if esRequest == nil {
+		return req, nil
+	}
+	switch esRequest.Action {
+	case elasticsearch.ActionReindex:
+		// the indices of a reindex are given in the body
+		logger.Debug("Denied reindex without the admin role")
+		return req, handlers.NewError("403", "Forbidden to reindex without the admin role")
+	case elasticsearch.ActionUnknown:
+		logger.Debugf("Denied the unknown request %s %s", req.Method, req.URL.Path)
+		return req, handlers.NewError("403", fmt.Sprintf("Forbidden to %s %s without the admin role", req.Method, req.URL.Path))
+	}
+	projects, _ := ctx.Value(handlers.ProjectsKey).([]apis.Project)
+	patterns := naming.Patterns(projects)
+	if rewrite && isRewritable(req.Method, esRequest) {
+		req, esRequest = h.rewriteRequest(req, esRequest, patterns)
+	}
+	targets := esRequest.Indices
+	if hasBodyTargets(esRequest) {
+		var err error
+		if req, targets, err = multiGetTargets(req, esRequest, maxBodySize); err != nil {
+			return req, err
+		}
+	}
+	// targets which only exclude indices are for every other index
+	if searchesAll(targets) {
+		if requiresTargets(req.Method, esRequest) {
+			logger.Debugf("Denied %s %s for every index", esRequest.Action, req.URL.Path)
+			return req, handlers.NewError("403", "Forbidden to "+string(esRequest.Action)+" every index")
+		}
+	} else if denied := Denied(patterns, authorizedTargets(req.Method, esRequest, targets)); len(denied) > 0 {
+		logger.Debugf("Denied %s of indices %v outside of the projects of the user", esRequest.Action, denied)
+		return req, handlers.NewError("403", fmt.Sprintf("Forbidden index %s", strings.Join(denied, ",")))
+	}
+	if isMultiSearch(esRequest) && req.Body != nil && req.Body != http.NoBody {
+		req = inspectMultiSearch(req, esRequest, patterns, rewrite)
+	}
+	if isListing(req.Method, esRequest) {
+		username, _ := ctx.Value(handlers.UsernameKey).(string)
+		req = filterListing(req, esRequest, patterns, username)
+	}
+	return req, nil
+}
+
+// rewriteRequest returns the request with its targets rewritten to those of the projects. The request
+// is returned as it is when no target of the projects remains to be denied
+func (h *indicesHandler) rewriteRequest(req *http.Request, esRequest *elasticsearch.Request, patterns []string) (*http.Request, *elasticsearch.Request) {
+	targets, ok := Rewrite(patterns, esRequest.Indices)
+	if !ok || equal(targets, esRequest.Indices) {
+		return req, esRequest
+	}
+	handlers.Logger(req.Context()).Debugf("Rewriting the targets %v to %v", esRequest.Indices, targets)
+	req = rewriteTargets(req, esRequest, targets)
+	return req, handlers.ESRequest(req.Context())
+}
+
+// isMultiSearch returns true for the multi search APIs, which are recognized by their endpoint as
+// those for the indices of Kibana only are classified as kibana requests
+func isMultiSearch(esRequest *elasticsearch.Request) bool {
+	return esRequest.Endpoint == "_msearch" || esRequest.Endpoint == "_msearch/template"
+}
+
+// inspectMultiSearch returns the request with the searches of its body authorized as it is sent to
+// Elasticsearch. Denied searches are answered with an error in their place in the response
+func inspectMultiSearch(req *http.Request, esRequest *elasticsearch.Request, patterns []string, rewrite bool) *http.Request {
+	inspector := newMsearchInspector(req.Body, patterns, esRequest.Indices, rewrite, handlers.Logger(req.Context()))
+	return handlers.WithInspectedBody(req, inspector, inspector.response.ModifyResponse)
+}
+
+// Denied returns the targets which are not permitted by any of the patterns. Exclusions
+// (i.e. -app-foo-*) and the indices of Kibana are always permitted
+func Denied(patterns []string, targets []string) []string {
+	denied := []string{}
+	for _, target := range targets {
+		if strings.HasPrefix(target, "-") || elasticsearch.IsKibanaIndex(target) {
+			continue
+		}
+		if !elasticsearch.Permits(patterns, target) {
+			denied = append(denied, target)
+		}
+	}
+	return denied
+}
+
+// requiresTargets returns true for the requests which would be for every index when given
+// no targets. Listings of indices, which are filtered, and the bulk and multi search requests,
+// whose targets are authorized as their body is sent, are not
+func requiresTargets(method string, esRequest *elasticsearch.Request) bool {
+	switch esRequest.Action {
+	case elasticsearch.ActionCount, elasticsearch.ActionFieldCaps, elasticsearch.ActionDeleteByQuery,
+		elasticsearch.ActionUpdateByQuery, elasticsearch.ActionIndexAdmin, elasticsearch.ActionCreateIndex,
+		elasticsearch.ActionDeleteIndex, elasticsearch.ActionMultiGet:
+		return true
+	case elasticsearch.ActionIndexMetadata:
+		// i.e. _stats for every index
+		return !isListing(method, esRequest)
+	case elasticsearch.ActionCat:
+		// i.e. _cat/shards lists the shards of every index
+		return shardListings[esRequest.Endpoint]
+	case elasticsearch.ActionSearch:
+		// point in time searches are closed with DELETE given their ID
+		return method != http.MethodDelete
+	case elasticsearch.ActionAsyncSearch:
+		// async searches are submitted with POST and then retrieved or deleted by their ID
+		return method == http.MethodPost
+	}
+	return false
+}
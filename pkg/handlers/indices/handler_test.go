@@ -0,0 +1,102 @@
+package indices
+
+import (
+	"net/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/openshift/elasticsearch-proxy/pkg/config"
+	"github.com/openshift/elasticsearch-proxy/pkg/handlers"
+	"github.com/openshift/elasticsearch-proxy/test"
+)
+
+var _ = Describe("Process", func() {
+
+	var (
+		handler *indicesHandler
+		fixture *test.RequestFixture
+	)
+
+	BeforeEach(func() {
+		var err error
+		handler, err = newIndicesHandler(&config.Options{
+			AuthIndexPatterns: []string{"app-{namespace}-*", "project.{namespace}.{uid}.*"},
+			AuthAdminRole:     "admin_reader",
+		})
+		Expect(err).To(BeNil())
+		fixture = test.NewRequestFixture(handler)
+	})
+
+	It("should allow indices of the projects of the user", func() {
+		Expect(fixture.Check("GET", "/app-foo-000001/_search", "")).To(Succeed())
+		Expect(fixture.Check("GET", "/app-foo-*,app-bar-*/_search", "")).To(Succeed())
+		Expect(fixture.Check("GET", "/project.bar.1f2e.2024.01.02/_count", "")).To(Succeed())
+		Expect(fixture.Check("GET", "/%3Capp-foo-%7Bnow%2Fd%7D%3E/_search", "")).To(Succeed())
+		Expect(fixture.Check("PUT", "/app-foo-000001/_doc/1", "")).To(Succeed())
+	})
+
+	It("should deny indices of other projects", func() {
+		Expect(test.Failure(fixture.Check("GET", "/app-foo-*,app-other-*/_search", ""), http.StatusForbidden)).To(Equal("Forbidden index app-other-*"))
+		Expect(test.Failure(fixture.Check("GET", "/project.foo.1f2e.*/_search", ""), http.StatusForbidden)).To(Equal("Forbidden index project.foo.1f2e.*"))
+		Expect(test.Failure(fixture.Check("GET", "/infra-000001/_doc/1", ""), http.StatusForbidden)).To(Equal("Forbidden index infra-000001"))
+	})
+
+	It("should deny patterns broader than the projects of the user", func() {
+		Expect(test.Failure(fixture.Check("GET", "/app-*/_search", ""), http.StatusForbidden)).To(Equal("Forbidden index app-*"))
+	})
+
+	It("should deny requests for every index", func() {
+		Expect(test.Failure(fixture.Check("GET", "/_search", ""), http.StatusForbidden)).To(Equal("Forbidden to search every index"))
+		Expect(test.Failure(fixture.Check("GET", "/_all/_count", ""), http.StatusForbidden)).To(Equal("Forbidden to count every index"))
+		Expect(test.Failure(fixture.Check("POST", "/_reindex", ""), http.StatusForbidden)).To(Equal("Forbidden to reindex without the admin role"))
+		Expect(test.Failure(fixture.Check("GET", "/-app-bar-000001/_search", ""), http.StatusForbidden)).To(Equal("Forbidden to search every index"))
+		Expect(test.Failure(fixture.Check("GET", "/_stats", ""), http.StatusForbidden)).To(Equal("Forbidden to index_metadata every index"))
+		Expect(test.Failure(fixture.Check("GET", "/_cat/shards", ""), http.StatusForbidden)).To(Equal("Forbidden to cat every index"))
+	})
+
+	It("should deny requests which are not known", func() {
+		Expect(test.Failure(fixture.Check("POST", "/_sql", ""), http.StatusForbidden)).To(Equal("Forbidden to POST /_sql without the admin role"))
+		Expect(test.Failure(fixture.Check("GET", "/app-foo-000001/_unknown", ""), http.StatusForbidden)).To(Equal("Forbidden to GET /app-foo-000001/_unknown without the admin role"))
+	})
+
+	It("should authorize the indices of the documents of multi gets", func() {
+		Expect(fixture.Check("POST", "/_mget", `{"docs":[{"_index":"app-foo-000001","_id":"1"}]}`)).To(Succeed())
+		Expect(fixture.Check("POST", "/app-foo-000001/_mget", `{"ids":["1","2"]}`)).To(Succeed())
+		Expect(test.Failure(fixture.Check("POST", "/_mget", `{"docs":[{"_index":"app-bar-1","_id":"1"},{"_index":"app-other-1","_id":"1"}]}`), http.StatusForbidden)).To(Equal("Forbidden index app-other-1"))
+		Expect(test.Failure(fixture.Check("POST", "/app-foo-000001/_mget", `{"docs":[{"_id":"1"},{"_index":"infra-000001","_id":"1"}]}`), http.StatusForbidden)).To(Equal("Forbidden index infra-000001"))
+		Expect(test.Failure(fixture.Check("POST", "/.kibana/_mget", `{"docs":[{"_id":"1"},{"_index":"app-other-1","_id":"1"}]}`), http.StatusForbidden)).To(Equal("Forbidden index app-other-1"))
+		Expect(test.Failure(fixture.Check("POST", "/_mtermvectors", `{"docs":[{"_index":"infra-000001","_id":"1"}]}`), http.StatusForbidden)).To(Equal("Forbidden index infra-000001"))
+		Expect(test.Failure(fixture.Check("POST", "/_mget", `{"ids":["1"]}`), http.StatusForbidden)).To(Equal("Forbidden to mget every index"))
+	})
+
+	It("should allow requests which do not target indices", func() {
+		Expect(fixture.Check("GET", "/_cluster/health", "")).To(Succeed())
+		Expect(fixture.Check("GET", "/_cat/indices", "")).To(Succeed())
+		Expect(fixture.Check("POST", "/_search/scroll", "")).To(Succeed())
+		Expect(fixture.Check("GET", "/_async_search/FmRldE8zREVEUzA2ZVpUeGs2ejJFUFEaMkZ5QTVrSTZSaVN3WlNFVmtlWHJsdzoxMDc=", "")).To(Succeed())
+		Expect(fixture.Check("POST", "/_bulk", "")).To(Succeed())
+	})
+
+	It("should allow exclusions and the indices of Kibana", func() {
+		Expect(fixture.Check("GET", "/app-foo-*,-app-foo-000001/_search", "")).To(Succeed())
+		Expect(fixture.Check("GET", "/.kibana/_doc/config:7.10.2", "")).To(Succeed())
+	})
+
+	It("should allow every index to the admin role", func() {
+		fixture.Roles = []string{"admin_reader"}
+		Expect(fixture.Check("GET", "/_search", "")).To(Succeed())
+		Expect(fixture.Check("GET", "/infra-*/_search", "")).To(Succeed())
+	})
+
+	It("should leave requests authenticated by certificate to their roles", func() {
+		fixture.AuthMethod = handlers.AuthMethodCertificate
+		Expect(fixture.Check("POST", "/infra-write/_bulk", "")).To(Succeed())
+	})
+
+	It("should replace the index patterns on reload", func() {
+		Expect(handler.Reload(&config.Options{AuthIndexPatterns: []string{"logs-{namespace}"}})).To(Succeed())
+		Expect(fixture.Check("GET", "/logs-foo/_search", "")).To(Succeed())
+		Expect(fixture.Check("GET", "/app-foo-000001/_search", "")).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,13 @@
+package indices
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestIndices(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Indices Suite")
+}
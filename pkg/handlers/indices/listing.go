@@ -0,0 +1,367 @@
+package indices
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/openshift/elasticsearch-proxy/pkg/elasticsearch"
+	"github.com/openshift/elasticsearch-proxy/pkg/handlers"
+)
+
+const (
+	verboseParam = "v"
+	columnsParam = "h"
+	prettyParam  = "pretty"
+)
+
+var (
+	// listingEndpoints are the endpoints whose responses list indices
+	listingEndpoints = map[string]bool{
+		"_cat/indices":   true,
+		"_cat/aliases":   true,
+		"_aliases":       true,
+		"_alias":         true,
+		"_mapping":       true,
+		"_mappings":      true,
+		"_settings":      true,
+		"_resolve/index": true,
+		"_field_caps":    true,
+	}
+
+	// indexColumns are the names of the column of _cat APIs giving the index
+	indexColumns = []string{"index", "i", "idx"}
+)
+
+// isListing returns true for the requests whose responses list indices
+func isListing(method string, esRequest *elasticsearch.Request) bool {
+	if method != http.MethodGet && method != http.MethodPost {
+		return false
+	}
+	switch esRequest.Action {
+	case elasticsearch.ActionIndexMetadata, elasticsearch.ActionCat, elasticsearch.ActionFieldCaps:
+		return listingEndpoints[esRequest.Endpoint]
+	}
+	return false
+}
+
+// authorizedTargets returns those of the targets of the request which must be permitted. Listings of
+// patterns are filtered from their response instead, except for field capabilities which merge
+// the fields of every index
+func authorizedTargets(method string, esRequest *elasticsearch.Request, targets []string) []string {
+	if !isListing(method, esRequest) || esRequest.Action == elasticsearch.ActionFieldCaps {
+		return targets
+	}
+	authorized := []string{}
+	for _, target := range targets {
+		if !strings.Contains(target, "*") {
+			authorized = append(authorized, target)
+		}
+	}
+	return authorized
+}
+
+// listing removes the indices outside of the projects from the response of a request listing indices
+type listing struct {
+	patterns []string
+	//username is the user whose own index of Kibana is listed besides the shared indices of Kibana
+	username string
+	endpoint string
+	pretty   bool
+	//dropHeader removes the header of a _cat response which was only requested to find the index column
+	dropHeader bool
+	//dropIndex removes the index column of a _cat response which was only requested to filter rows
+	dropIndex bool
+}
+
+// filterListing returns the request with its response filtered to the indices of the projects and
+// the indices of Kibana but those of other users. The header and index column of _cat APIs are
+// requested to find the index of each row
+func filterListing(req *http.Request, esRequest *elasticsearch.Request, patterns []string, username string) *http.Request {
+	req = req.Clone(req.Context())
+	// the response is read to filter its indices so it must not be compressed
+	req.Header.Del("Accept-Encoding")
+	params := req.URL.Query()
+	l := &listing{patterns: patterns, username: username, endpoint: esRequest.Endpoint}
+	if value, found := params[prettyParam]; found {
+		l.pretty = len(value) == 0 || value[0] != "false"
+	}
+	if esRequest.Action == elasticsearch.ActionCat {
+		if value, found := params[verboseParam]; !found || (len(value) > 0 && value[0] == "false") {
+			params.Set(verboseParam, "true")
+			l.dropHeader = true
+		}
+		if columns := params.Get(columnsParam); columns != "" && !hasIndexColumn(columns) {
+			params.Set(columnsParam, columns+",index")
+			l.dropIndex = true
+		}
+		req.URL.RawQuery = params.Encode()
+		// the request is proxied to its RequestURI to keep encoded slashes of the path
+		req.RequestURI = req.URL.RequestURI()
+	}
+	return handlers.WithResponseModifier(req, l.modifyResponse)
+}
+
+func hasIndexColumn(columns string) bool {
+	for _, column := range strings.Split(columns, ",") {
+		if isIndexColumn(strings.TrimSpace(column)) {
+			return true
+		}
+	}
+	return false
+}
+
+func isIndexColumn(name string) bool {
+	for _, column := range indexColumns {
+		if name == column {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *listing) permits(index string) bool {
+	return elasticsearch.PermitsKibanaIndex(l.username, index) || elasticsearch.Permits(l.patterns, index)
+}
+
+func (l *listing) filterNames(names []string) []string {
+	permitted := []string{}
+	for _, name := range names {
+		if l.permits(name) {
+			permitted = append(permitted, name)
+		}
+	}
+	return permitted
+}
+
+// modifyResponse filters a successful response given as JSON or, for _cat APIs, as text. Responses
+// which can not be filtered fail the request
+func (l *listing) modifyResponse(resp *http.Response) error {
+	if resp.StatusCode != http.StatusOK {
+		return nil
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	contentType := resp.Header.Get("Content-Type")
+	switch {
+	case strings.HasPrefix(contentType, "application/json"):
+		data, err = l.filterJSON(data)
+	case strings.HasPrefix(contentType, "text/plain") && strings.HasPrefix(l.endpoint, "_cat/"):
+		data = l.filterText(data)
+	default:
+		err = fmt.Errorf("unable to filter the indices of %s given as %s", l.endpoint, contentType)
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(data))
+	resp.ContentLength = int64(len(data))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(data)))
+	return nil
+}
+
+func (l *listing) filterJSON(data []byte) ([]byte, error) {
+	var filtered interface{}
+	var err error
+	switch l.endpoint {
+	case "_cat/indices", "_cat/aliases":
+		filtered, err = l.filterRows(data)
+	case "_resolve/index":
+		filtered, err = l.filterResolved(data)
+	case "_field_caps":
+		filtered, err = l.filterFieldCaps(data)
+	default:
+		filtered, err = l.filterObject(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to filter the indices of %s: %v", l.endpoint, err)
+	}
+	if l.pretty {
+		return json.MarshalIndent(filtered, "", "  ")
+	}
+	return json.Marshal(filtered)
+}
+
+// filterObject filters the responses keyed by index, i.e. {"app-foo-000001":{"mappings":{}}}
+func (l *listing) filterObject(data []byte) (interface{}, error) {
+	indices := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &indices); err != nil {
+		return nil, err
+	}
+	for index := range indices {
+		if !l.permits(index) {
+			delete(indices, index)
+		}
+	}
+	return indices, nil
+}
+
+// filterRows filters the rows of _cat APIs given as JSON
+func (l *listing) filterRows(data []byte) (interface{}, error) {
+	rows := []map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return nil, err
+	}
+	permitted := []map[string]json.RawMessage{}
+	for _, row := range rows {
+		index := ""
+		for _, column := range indexColumns {
+			if value, found := row[column]; found {
+				_ = json.Unmarshal(value, &index)
+				break
+			}
+		}
+		if !l.permits(index) {
+			continue
+		}
+		if l.dropIndex {
+			delete(row, "index")
+		}
+		permitted = append(permitted, row)
+	}
+	return permitted, nil
+}
+
+// filterText filters the rows of _cat APIs given as text, whose columns are aligned with their header
+func (l *listing) filterText(data []byte) []byte {
+	lines := strings.Split(string(data), "\n")
+	offset := columnOffset(lines[0], l.dropIndex)
+	filtered := []string{}
+	for i, line := range lines {
+		if line == "" {
+			continue
+		}
+		if i > 0 && !l.permits(columnValue(line, offset)) {
+			continue
+		}
+		if l.dropIndex && offset >= 0 && offset <= len(line) {
+			line = strings.TrimRight(line[:offset], " ")
+		}
+		if i == 0 && l.dropHeader {
+			continue
+		}
+		filtered = append(filtered, line)
+	}
+	if len(filtered) == 0 {
+		return []byte{}
+	}
+	return []byte(strings.Join(filtered, "\n") + "\n")
+}
+
+// columnOffset returns the offset of the first, or last, index column of the header or -1 when
+// there is none
+func columnOffset(header string, last bool) int {
+	offset := -1
+	for start := 0; start < len(header); {
+		if header[start] == ' ' {
+			start++
+			continue
+		}
+		end := strings.IndexByte(header[start:], ' ')
+		if end < 0 {
+			end = len(header) - start
+		}
+		if isIndexColumn(header[start : start+end]) {
+			offset = start
+			if !last {
+				return offset
+			}
+		}
+		start += end
+	}
+	return offset
+}
+
+func columnValue(line string, offset int) string {
+	if offset < 0 || offset >= len(line) {
+		return ""
+	}
+	value := line[offset:]
+	if end := strings.IndexByte(value, ' '); end >= 0 {
+		value = value[:end]
+	}
+	return value
+}
+
+// filterResolved filters the indices, aliases and data streams resolved by _resolve/index. Aliases
+// are kept with their permitted indices and data streams with their backing indices
+func (l *listing) filterResolved(data []byte) (interface{}, error) {
+	resolved := map[string][]map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &resolved); err != nil {
+		return nil, err
+	}
+	for kind, entries := range resolved {
+		permitted := []map[string]json.RawMessage{}
+		for _, entry := range entries {
+			if kind == "aliases" {
+				indices, err := l.filterIndices(entry["indices"])
+				if err != nil {
+					return nil, err
+				}
+				if len(indices) == 0 {
+					continue
+				}
+				entry["indices"], _ = json.Marshal(indices)
+			} else {
+				name := ""
+				if err := json.Unmarshal(entry["name"], &name); err != nil || !l.permits(name) {
+					continue
+				}
+			}
+			permitted = append(permitted, entry)
+		}
+		resolved[kind] = permitted
+	}
+	return resolved, nil
+}
+
+// filterFieldCaps filters the indices of field capabilities and of their fields
+func (l *listing) filterFieldCaps(data []byte) (interface{}, error) {
+	caps := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &caps); err != nil {
+		return nil, err
+	}
+	if raw, found := caps["indices"]; found {
+		indices, err := l.filterIndices(raw)
+		if err != nil {
+			return nil, err
+		}
+		caps["indices"], _ = json.Marshal(indices)
+	}
+	fields := map[string]map[string]map[string]json.RawMessage{}
+	if raw, found := caps["fields"]; found {
+		if err := json.Unmarshal(raw, &fields); err != nil {
+			return nil, err
+		}
+		for _, types := range fields {
+			for _, capabilities := range types {
+				for _, key := range []string{"indices", "non_searchable_indices", "non_aggregatable_indices"} {
+					if raw, found := capabilities[key]; found {
+						indices, err := l.filterIndices(raw)
+						if err != nil {
+							return nil, err
+						}
+						capabilities[key], _ = json.Marshal(indices)
+					}
+				}
+			}
+		}
+		caps["fields"], _ = json.Marshal(fields)
+	}
+	return caps, nil
+}
+
+func (l *listing) filterIndices(raw json.RawMessage) ([]string, error) {
+	var indices []string
+	if err := json.Unmarshal(raw, &indices); err != nil {
+		return nil, err
+	}
+	return l.filterNames(indices), nil
+}
@@ -0,0 +1,128 @@
+package indices
+
+import (
+	"net/http"
+	"strconv"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/openshift/elasticsearch-proxy/pkg/config"
+	"github.com/openshift/elasticsearch-proxy/pkg/elasticsearch"
+	"github.com/openshift/elasticsearch-proxy/test"
+)
+
+var _ = Describe("Process of index listings", func() {
+
+	var (
+		fixture *test.RequestFixture
+
+		list = func(path, contentType, body string) (string, *http.Request) {
+			req, err := fixture.Process("GET", path, "")
+			Expect(err).To(BeNil())
+			resp, err := test.Respond(req, http.StatusOK, contentType, body)
+			Expect(err).To(BeNil())
+			data, err := test.Read(resp.Body)
+			Expect(err).To(BeNil())
+			Expect(resp.ContentLength).To(BeEquivalentTo(len(data)))
+			Expect(resp.Header.Get("Content-Length")).To(Equal(strconv.Itoa(len(data))))
+			return data, req
+		}
+	)
+
+	BeforeEach(func() {
+		handler, err := newIndicesHandler(&config.Options{
+			AuthIndexPatterns: []string{"app-{namespace}-*"},
+			AuthAdminRole:     "admin_reader",
+		})
+		Expect(err).To(BeNil())
+		fixture = test.NewRequestFixture(handler)
+	})
+
+	It("should filter the rows of _cat APIs given as text", func() {
+		body := `health status index            uuid pri
+green  open   app-foo-000001   abc    1
+yellow open   app-other-000001 def    1
+       close  app-bar-000001   ghi    1
+green  open   .kibana_1        jkl    1
+`
+		listed, req := list("/_cat/indices", "text/plain; charset=UTF-8", body)
+		Expect(req.RequestURI).To(Equal("/_cat/indices?v=true"))
+		Expect(req.Header.Get("Accept-Encoding")).To(BeEmpty())
+		Expect(listed).To(Equal(`green  open   app-foo-000001   abc    1
+       close  app-bar-000001   ghi    1
+green  open   .kibana_1        jkl    1
+`))
+
+		listed, _ = list("/_cat/indices?v", "text/plain; charset=UTF-8", body)
+		Expect(listed).To(HavePrefix("health status index            uuid pri\ngreen  open   app-foo-000001"))
+	})
+
+	It("should request the index column of _cat APIs to filter their rows", func() {
+		listed, req := list("/_cat/aliases?h=alias", "text/plain; charset=UTF-8", `alias           index
+app-foo-write   app-foo-000002
+app-other-write app-other-000002
+`)
+		Expect(req.URL.Query().Get("h")).To(Equal("alias,index"))
+		Expect(listed).To(Equal("app-foo-write\n"))
+
+		listed, _ = list("/_cat/indices?format=json&h=i,docs.count", "application/json", `[{"i":"app-foo-000001","docs.count":"1"},{"i":"app-other-000001","docs.count":"2"}]`)
+		Expect(listed).To(Equal(`[{"docs.count":"1","i":"app-foo-000001"}]`))
+
+		listed, _ = list("/_cat/indices?format=json&h=health", "application/json", `[{"health":"green","index":"app-other-000001"},{"health":"green","index":"app-bar-000001"}]`)
+		Expect(listed).To(Equal(`[{"health":"green"}]`))
+	})
+
+	It("should only list the own index of Kibana of the user", func() {
+		body := `{"` + elasticsearch.KibanaUserIndex("alice") + `":{},"` + elasticsearch.KibanaUserIndex("bob") + `":{},".kibana_1":{},".kibana_task_manager":{}}`
+		listed, _ := list("/_mapping", "application/json", body)
+		Expect(listed).To(Equal(`{"` + elasticsearch.KibanaUserIndex("alice") + `":{},".kibana_1":{},".kibana_task_manager":{}}`))
+	})
+
+	It("should filter the responses keyed by index", func() {
+		listed, _ := list("/_aliases", "application/json", `{"app-foo-000001":{"aliases":{"app-foo-write":{}}},"app-other-000001":{"aliases":{}}}`)
+		Expect(listed).To(Equal(`{"app-foo-000001":{"aliases":{"app-foo-write":{}}}}`))
+		listed, _ = list("/app-*/_mapping?pretty", "application/json", `{"app-other-000001":{"mappings":{}},"app-bar-000001":{"mappings":{}}}`)
+		Expect(listed).To(Equal("{\n  \"app-bar-000001\": {\n    \"mappings\": {}\n  }\n}"))
+	})
+
+	It("should filter resolved indices, aliases and data streams", func() {
+		listed, _ := list("/_resolve/index/*", "application/json", `{"indices":[{"name":"app-foo-000001","aliases":["app-foo-write"]},{"name":"app-other-000001"}],`+
+			`"aliases":[{"name":"app-write","indices":["app-foo-000001","app-other-000001"]},{"name":"app-other-write","indices":["app-other-000001"]}],`+
+			`"data_streams":[{"name":"app-foo-logs","backing_indices":[".ds-app-foo-logs-000001"]},{"name":"app-other-logs","backing_indices":[]}]}`)
+		Expect(listed).To(Equal(`{"aliases":[{"indices":["app-foo-000001"],"name":"app-write"}],` +
+			`"data_streams":[{"backing_indices":[".ds-app-foo-logs-000001"],"name":"app-foo-logs"}],` +
+			`"indices":[{"aliases":["app-foo-write"],"name":"app-foo-000001"}]}`))
+	})
+
+	It("should filter the indices of field capabilities", func() {
+		listed, _ := list("/app-foo-*/_field_caps?fields=level", "application/json",
+			`{"indices":["app-foo-000001","app-other-000001"],"fields":{"level":{"keyword":{"type":"keyword","indices":["app-foo-000001","app-other-000001"]}}}}`)
+		Expect(listed).To(Equal(`{"fields":{"level":{"keyword":{"indices":["app-foo-000001"],"type":"keyword"}}},"indices":["app-foo-000001"]}`))
+	})
+
+	It("should allow listings of patterns which are filtered", func() {
+		_, err := fixture.Process("GET", "/_cat/indices/app-*", "")
+		Expect(err).To(BeNil())
+		_, err = fixture.Process("GET", "/_resolve/index/*", "")
+		Expect(err).To(BeNil())
+		_, err = fixture.Process("GET", "/_cat/indices/app-other-000001", "")
+		Expect(err).To(HaveOccurred())
+		_, err = fixture.Process("GET", "/app-*/_field_caps?fields=*", "")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should fail responses which can not be filtered", func() {
+		req, err := fixture.Process("GET", "/_mapping", "")
+		Expect(err).To(BeNil())
+		_, err = test.Respond(req, http.StatusOK, "application/yaml", "app-other-000001: {}\n")
+		Expect(err).To(MatchError("unable to filter the indices of _mapping given as application/yaml"))
+	})
+
+	It("should not filter the listings of the admin role", func() {
+		fixture.Roles = []string{"admin_reader"}
+		listed, req := list("/_cat/indices", "text/plain", "app-other-000001\n")
+		Expect(req.RequestURI).To(Equal("/_cat/indices"))
+		Expect(listed).To(Equal("app-other-000001\n"))
+	})
+})
@@ -0,0 +1,55 @@
+package indices
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"github.com/openshift/elasticsearch-proxy/pkg/elasticsearch"
+	"github.com/openshift/elasticsearch-proxy/pkg/handlers"
+)
+
+// multiGetBody is the body of _mget and _mtermvectors. Documents are given with their index
+// or by their ID only for the index of the path
+type multiGetBody struct {
+	Docs []struct {
+		Index string `json:"_index"`
+	} `json:"docs"`
+}
+
+// hasBodyTargets returns true for the requests whose documents name their index in the body. They
+// are recognized by their endpoint as those for the indices of Kibana only are classified as kibana
+// requests
+func hasBodyTargets(esRequest *elasticsearch.Request) bool {
+	return esRequest.Endpoint == "_mget" || esRequest.Endpoint == "_mtermvectors"
+}
+
+// multiGetTargets returns the request with its body read and the indices of its documents.
+// Documents without an index are read from the targets of the path
+func multiGetTargets(req *http.Request, esRequest *elasticsearch.Request, maxBodySize int64) (*http.Request, []string, error) {
+	data, err := handlers.ReadBody(req, maxBodySize)
+	if err != nil {
+		return req, nil, err
+	}
+	req = req.Clone(req.Context())
+	handlers.SetBody(req, data, "application/json")
+	body := multiGetBody{}
+	if len(bytes.TrimSpace(data)) > 0 {
+		if err := json.Unmarshal(data, &body); err != nil {
+			return req, nil, handlers.NewError("400", "Unable to parse the documents of the "+esRequest.Endpoint+" body")
+		}
+	}
+	targets := []string{}
+	pathTargets := len(body.Docs) == 0
+	for _, doc := range body.Docs {
+		if doc.Index == "" {
+			pathTargets = true
+			continue
+		}
+		targets = append(targets, doc.Index)
+	}
+	if pathTargets {
+		targets = append(targets, esRequest.Indices...)
+	}
+	return req, targets, nil
+}
@@ -0,0 +1,184 @@
+package indices
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/openshift/elasticsearch-proxy/pkg/elasticsearch"
+	"github.com/openshift/elasticsearch-proxy/pkg/handlers"
+)
+
+// msearchInspector authorizes the targets of the header lines of a multi search body as it is read.
+// Lines alternate between the header and the body of each search. Searches for indices outside of
+// the projects are removed and answered with an error in their place in the response. The targets
+// of the other headers are rewritten when configured
+type msearchInspector struct {
+	body     io.ReadCloser
+	reader   *bufio.Reader
+	patterns []string
+	//pathTargets apply to the searches whose header has no targets
+	pathTargets []string
+	rewrite     bool
+	logger      *log.Entry
+
+	line int
+	//header is true when the next line is the header of a search
+	header bool
+	//skip is true when the body of the last search is removed with it
+	skip bool
+	//response answers the searches removed from the request
+	response *handlers.MergedResponse
+	//pending is the data not read yet
+	pending []byte
+	err     error
+}
+
+func newMsearchInspector(body io.ReadCloser, patterns, pathTargets []string, rewrite bool, logger *log.Entry) *msearchInspector {
+	return &msearchInspector{
+		body:        body,
+		reader:      bufio.NewReader(body),
+		patterns:    patterns,
+		pathTargets: pathTargets,
+		rewrite:     rewrite,
+		logger:      logger,
+		header:      true,
+		response:    handlers.NewMergedResponse("multi search", "responses", nil),
+	}
+}
+
+func (r *msearchInspector) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		line, err := r.reader.ReadBytes('\n')
+		r.err = err
+		if len(line) == 0 {
+			continue
+		}
+		r.line++
+		if elasticsearch.SkipsMultiSearchLine(r.line, line) {
+			continue
+		}
+		if !r.header {
+			r.header = true
+			if r.skip {
+				r.skip = false
+				continue
+			}
+			r.pending = line
+			continue
+		}
+		r.header = false
+		line, err = r.inspectHeader(line)
+		if err != nil {
+			r.err = &handlers.RequestBodyError{Err: err}
+			return 0, r.err
+		}
+		r.pending = line
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+func (r *msearchInspector) Close() error {
+	return r.body.Close()
+}
+
+// inspectHeader returns the header line with its targets rewritten when configured, or nothing when
+// the search is denied. Targets given for every index or broader than the projects are rewritten to
+// those of the projects. Headers without targets search the targets of the path
+func (r *msearchInspector) inspectHeader(line []byte) ([]byte, error) {
+	trimmed := bytes.TrimSpace(line)
+	header := map[string]json.RawMessage{}
+	if len(trimmed) > 0 {
+		if err := json.Unmarshal(trimmed, &header); err != nil {
+			return nil, handlers.NewError("400", fmt.Sprintf("Unable to parse the multi search header on line %d", r.line))
+		}
+	}
+	targets, err := elasticsearch.MultiSearchTargets(header)
+	if err != nil {
+		return nil, handlers.NewError("400", fmt.Sprintf("Unable to parse the index of the multi search header on line %d: %v", r.line, err))
+	}
+
+	if len(targets) == 0 && len(r.pathTargets) > 0 {
+		// the targets of the path were authorized and rewritten with the request
+		targets = r.pathTargets
+	} else if r.rewrite {
+		if rewritten, permitted := Rewrite(r.patterns, targets); permitted && !equal(rewritten, targets) {
+			delete(header, "indices")
+			header["index"], _ = json.Marshal(strings.Join(rewritten, ","))
+			if _, found := header["ignore_unavailable"]; !found {
+				header["ignore_unavailable"] = json.RawMessage("true")
+			}
+			data, err := json.Marshal(header)
+			if err != nil {
+				return nil, err
+			}
+			line, targets = append(data, '\n'), rewritten
+		}
+	}
+
+	reason := ""
+	if searchesAll(targets) {
+		reason = "Forbidden to search every index"
+	} else if denied := Denied(r.patterns, targets); len(denied) > 0 {
+		reason = "Forbidden index " + strings.Join(denied, ",")
+	}
+	if reason == "" {
+		r.response.Forward()
+		return line, nil
+	}
+	r.logger.Debugf("Denied the multi search of %v on line %d: %s", targets, r.line, reason)
+	r.response.Deny(deniedResult(reason))
+	r.skip = true
+	return nil, nil
+}
+
+// searchesAll returns true when the targets are for every index, which includes targets which
+// only exclude indices
+func searchesAll(targets []string) bool {
+	if (&elasticsearch.Request{Indices: targets}).TargetsAll() {
+		return true
+	}
+	for _, target := range targets {
+		if !strings.HasPrefix(target, "-") {
+			return false
+		}
+	}
+	return true
+}
+
+// deniedResult returns the response answering a search removed from the request
+func deniedResult(reason string) json.RawMessage {
+	cause := handlers.SecurityException(reason)
+	data, _ := json.Marshal(map[string]interface{}{
+		"error": map[string]interface{}{
+			"root_cause": []handlers.ErrorCause{cause},
+			"type":       cause.Type,
+			"reason":     cause.Reason,
+		},
+		"status": http.StatusForbidden,
+	})
+	return data
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
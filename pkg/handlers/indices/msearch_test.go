@@ -0,0 +1,132 @@
+package indices
+
+import (
+	"net/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/openshift/elasticsearch-proxy/pkg/config"
+	"github.com/openshift/elasticsearch-proxy/test"
+)
+
+var _ = Describe("Process of multi searches", func() {
+
+	var (
+		fixture *test.RequestFixture
+		rewrite bool
+
+		process = func(path, body string) *http.Request {
+			req, err := fixture.Process("POST", path, body)
+			Expect(err).To(BeNil())
+			return req
+		}
+		merged = func(req *http.Request, status int, body string) string {
+			resp, err := test.Respond(req, status, "application/json", body)
+			Expect(err).To(BeNil())
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			data, err := test.Read(resp.Body)
+			Expect(err).To(BeNil())
+			Expect(resp.ContentLength).To(BeEquivalentTo(len(data)))
+			return data
+		}
+		denied = func(reason string) string {
+			return `{"error":{"reason":"` + reason + `","root_cause":[{"type":"security_exception","reason":"` + reason + `"}],"type":"security_exception"},"status":403}`
+		}
+	)
+
+	BeforeEach(func() {
+		rewrite = false
+	})
+
+	JustBeforeEach(func() {
+		handler, err := newIndicesHandler(&config.Options{
+			AuthIndexPatterns: []string{"app-{namespace}-*"},
+			AuthIndexRewrite:  rewrite,
+		})
+		Expect(err).To(BeNil())
+		fixture = test.NewRequestFixture(handler)
+	})
+
+	It("should remove the searches of forbidden indices and answer them with errors in their place", func() {
+		req := process("/_msearch?filter_path=responses.hits", `{"index":"app-other-*"}
+{"query":{"match_all":{}}}
+{"index":"app-foo-*"}
+{"query":{"match":{"message":"error"}}}
+{}
+{"size":0}
+{"index":[".kibana","app-bar-000001"]}
+{"size":1}
+{"index":"_all"}
+{"size":2}
+`)
+		Expect(req.RequestURI).To(Equal("/_msearch"))
+		Expect(req.Header.Get("Accept-Encoding")).To(BeEmpty())
+		Expect(test.Read(req.Body)).To(Equal(`{"index":"app-foo-*"}
+{"query":{"match":{"message":"error"}}}
+{"index":[".kibana","app-bar-000001"]}
+{"size":1}
+`))
+		Expect(merged(req, http.StatusOK, `{"took":2,"responses":[{"status":200,"hits":{}},{"status":200,"hits":{"total":1}}]}`)).To(Equal(
+			`{"responses":[` + denied("Forbidden index app-other-*") + `,{"status":200,"hits":{}},` + denied("Forbidden to search every index") +
+				`,{"status":200,"hits":{"total":1}},` + denied("Forbidden to search every index") + `],"took":2}`))
+	})
+
+	It("should search the indices of the path for headers without targets", func() {
+		req := process("/app-foo-*/_msearch", "{}\n{}\n{\"index\":\"app-other-*\"}\n{}\n")
+		Expect(test.Read(req.Body)).To(Equal("{}\n{}\n"))
+	})
+
+	It("should authorize the searches of multi searches for the indices of Kibana", func() {
+		req := process("/.kibana/_msearch", "{}\n{}\n{\"index\":\"app-other-*\"}\n{}\n")
+		Expect(test.Read(req.Body)).To(Equal("{}\n{}\n"))
+		req = process("/.kibana/_msearch/template", "{\"index\":\"app-other-*\"}\n{\"id\":\"t\"}\n")
+		Expect(test.Read(req.Body)).To(BeEmpty())
+	})
+
+	It("should skip an empty first line as Elasticsearch does", func() {
+		req := process("/app-foo-*/_msearch", "\n{\"index\":\"app-other-*\"}\n{}\n{}\n{}\n")
+		Expect(test.Read(req.Body)).To(Equal("{}\n{}\n"))
+	})
+
+	It("should answer every search when all are denied", func() {
+		req := process("/_msearch", "{\"index\":\"infra-*\"}\n{}\n")
+		Expect(test.Read(req.Body)).To(BeEmpty())
+		Expect(merged(req, http.StatusBadRequest, `{"error":"no requests added","status":400}`)).To(Equal(
+			`{"responses":[` + denied("Forbidden index infra-*") + `],"took":0}`))
+	})
+
+	It("should leave responses as they are without denied searches", func() {
+		req := process("/_msearch", "{\"index\":\"app-foo-*\"}\n{}\n")
+		Expect(test.Read(req.Body)).To(Equal("{\"index\":\"app-foo-*\"}\n{}\n"))
+		Expect(merged(req, http.StatusOK, `{"took":1,"responses":[{"status":200}]}`)).To(Equal(`{"took":1,"responses":[{"status":200}]}`))
+	})
+
+	It("should fail the request on a malformed header", func() {
+		_, err := test.Read(process("/_msearch", "{\"index\":\"app-foo-*\"}\n{}\nnot json\n{}\n").Body)
+		Expect(test.Failure(err, http.StatusBadRequest)).To(Equal("Unable to parse the multi search header on line 3"))
+	})
+
+	It("should authorize the targets given by indices", func() {
+		req := process("/_msearch", "{\"indices\":[\"app-foo-*\"]}\n{}\n{\"indices\":\"app-other-*\"}\n{}\n")
+		Expect(test.Read(req.Body)).To(Equal("{\"indices\":[\"app-foo-*\"]}\n{}\n"))
+	})
+
+	It("should fail the request on a header giving both index and indices", func() {
+		_, err := test.Read(process("/app-foo-*/_msearch", "{\"index\":\"app-foo-*\",\"indices\":\"app-other-*\"}\n{}\n").Body)
+		Expect(test.Failure(err, http.StatusBadRequest)).To(Equal("Unable to parse the index of the multi search header on line 1: both index and indices are given"))
+	})
+
+	Context("when rewriting targets", func() {
+		BeforeEach(func() {
+			rewrite = true
+		})
+
+		It("should rewrite headers before authorizing them", func() {
+			req := process("/_msearch", "{\"index\":\"app-*\"}\n{}\n{\"index\":\"infra-*\"}\n{}\n")
+			Expect(test.Read(req.Body)).To(Equal("{\"ignore_unavailable\":true,\"index\":\"app-foo-*,app-bar-*\"}\n{}\n"))
+			req = process("/_msearch", "{\"indices\":\"app-*\"}\n{}\n")
+			Expect(test.Read(req.Body)).To(Equal("{\"ignore_unavailable\":true,\"index\":\"app-foo-*,app-bar-*\"}\n{}\n"))
+		})
+	})
+})
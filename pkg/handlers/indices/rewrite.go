@@ -0,0 +1,77 @@
+package indices
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/openshift/elasticsearch-proxy/pkg/elasticsearch"
+	"github.com/openshift/elasticsearch-proxy/pkg/handlers"
+)
+
+const (
+	ignoreUnavailableParam = "ignore_unavailable"
+)
+
+// Rewrite returns the targets with those for every index or patterns broader than the projects
+// (i.e. _all or app-*) replaced by the patterns of the projects they match, or dropped when they
+// match none. Other targets are kept to be authorized. It returns false when no target remains
+func Rewrite(patterns []string, targets []string) ([]string, bool) {
+	rewritten := []string{}
+	exclusions := []string{}
+	seen := map[string]bool{}
+	add := func(targets ...string) {
+		for _, target := range targets {
+			if !seen[target] {
+				seen[target] = true
+				rewritten = append(rewritten, target)
+			}
+		}
+	}
+	if (&elasticsearch.Request{Indices: targets}).TargetsAll() {
+		add(patterns...)
+	}
+	for _, target := range targets {
+		switch {
+		case target == "_all" || target == "*":
+		case strings.HasPrefix(target, "-"):
+			exclusions = append(exclusions, target)
+		case strings.Contains(target, "*") && !elasticsearch.IsKibanaIndex(target) && !elasticsearch.Permits(patterns, target):
+			add(elasticsearch.PatternsWithin(target, patterns)...)
+		default:
+			add(target)
+		}
+	}
+	if len(rewritten) == 0 {
+		return nil, false
+	}
+	// exclusions only apply to the targets before them
+	return append(rewritten, exclusions...), true
+}
+
+// isRewritable returns true for the requests whose targets are rewritten to those of the projects
+func isRewritable(method string, esRequest *elasticsearch.Request) bool {
+	switch esRequest.Endpoint {
+	case "_search", "_search/template", "_count", "_field_caps", "_msearch", "_msearch/template":
+		return true
+	case "_async_search":
+		// async searches are submitted with POST and then retrieved or deleted by their ID
+		return method == http.MethodPost
+	}
+	return false
+}
+
+// rewriteTargets returns a copy of the request for the targets which replace those given in the
+// path or are added to the path when none are given. Unavailable indices are ignored as they would
+// be when matched by the original targets. The multi search APIs do not accept the parameter which
+// is given in the header of each search instead
+func rewriteTargets(req *http.Request, esRequest *elasticsearch.Request, targets []string) *http.Request {
+	req = handlers.WithTargets(req, targets)
+	if !isMultiSearch(esRequest) && req.URL.Query().Get(ignoreUnavailableParam) == "" {
+		if req.URL.RawQuery != "" {
+			req.URL.RawQuery += "&"
+		}
+		req.URL.RawQuery += ignoreUnavailableParam + "=true"
+		req.RequestURI = req.URL.RequestURI()
+	}
+	return req
+}
@@ -0,0 +1,172 @@
+package indices
+
+import (
+	"io/ioutil"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/openshift/elasticsearch-proxy/pkg/apis"
+	"github.com/openshift/elasticsearch-proxy/pkg/config"
+	"github.com/openshift/elasticsearch-proxy/pkg/elasticsearch"
+	"github.com/openshift/elasticsearch-proxy/pkg/handlers"
+	"github.com/openshift/elasticsearch-proxy/test"
+)
+
+var _ = Describe("Rewrite", func() {
+
+	patterns := []string{"app-foo-*", "app-bar-*", "project.foo.8d5b.*"}
+
+	It("should rewrite every index to the patterns of the projects", func() {
+		for _, targets := range [][]string{{}, {"_all"}, {"*"}} {
+			rewritten, ok := Rewrite(patterns, targets)
+			Expect(ok).To(BeTrue())
+			Expect(rewritten).To(Equal(patterns))
+		}
+	})
+
+	It("should narrow patterns broader than the projects", func() {
+		rewritten, ok := Rewrite(patterns, []string{"app-*"})
+		Expect(ok).To(BeTrue())
+		Expect(rewritten).To(Equal([]string{"app-foo-*", "app-bar-*"}))
+	})
+
+	It("should keep permitted targets, literal targets and exclusions", func() {
+		rewritten, ok := Rewrite(patterns, []string{"-app-foo-000001", "app-foo-2024*", "app-other-000001", ".kibana"})
+		Expect(ok).To(BeTrue())
+		Expect(rewritten).To(Equal([]string{"app-foo-2024*", "app-other-000001", ".kibana", "-app-foo-000001"}))
+	})
+
+	It("should drop patterns matching no project", func() {
+		rewritten, ok := Rewrite(patterns, []string{"app-*", "infra-*"})
+		Expect(ok).To(BeTrue())
+		Expect(rewritten).To(Equal([]string{"app-foo-*", "app-bar-*"}))
+		_, ok = Rewrite(patterns, []string{"infra-*"})
+		Expect(ok).To(BeFalse())
+		_, ok = Rewrite([]string{}, []string{"_all"})
+		Expect(ok).To(BeFalse())
+	})
+
+	It("should leave no pattern of other projects", func() {
+		for _, targets := range [][]string{
+			{"*"}, {"_all"}, {"app-*"}, {"*-foo-*"}, {"app-*", "infra-*", "audit-*"}, {"project.*"},
+			{"project.foo.*"}, {"*", "-app-bar-*"}, {"app-f*", "app-b*"}, {"a*", "p*"},
+		} {
+			rewritten, ok := Rewrite(patterns, targets)
+			if !ok {
+				continue
+			}
+			for _, target := range rewritten {
+				if strings.HasPrefix(target, "-") {
+					continue
+				}
+				Expect(elasticsearch.Permits(patterns, target)).To(BeTrue(), "%v rewritten to %v", targets, rewritten)
+			}
+		}
+	})
+})
+
+var _ = Describe("Process with rewriting", func() {
+
+	var (
+		fixture *test.RequestFixture
+
+		process = func(method, path, body string) (string, string, error) {
+			req, err := fixture.Process(method, path, body)
+			if err != nil {
+				return "", "", err
+			}
+			data, err := test.Read(req.Body)
+			Expect(err).To(BeNil())
+			return req.RequestURI, data, nil
+		}
+	)
+
+	BeforeEach(func() {
+		handler, err := newIndicesHandler(&config.Options{
+			AuthIndexPatterns: []string{"app-{namespace}-*"},
+			AuthIndexRewrite:  true,
+		})
+		Expect(err).To(BeNil())
+		fixture = test.NewRequestFixture(handler)
+	})
+
+	It("should add the patterns of the projects to searches without targets", func() {
+		uri, _, err := process("GET", "/_search?size=1", "")
+		Expect(err).To(BeNil())
+		Expect(uri).To(Equal("/app-foo-*,app-bar-*/_search?size=1&ignore_unavailable=true"))
+	})
+
+	It("should rewrite the targets of searches, counts and field capabilities", func() {
+		uri, _, err := process("GET", "/_all/_search", "")
+		Expect(err).To(BeNil())
+		Expect(uri).To(Equal("/app-foo-*,app-bar-*/_search?ignore_unavailable=true"))
+
+		uri, _, err = process("GET", "/app-*/_count?ignore_unavailable=false", "")
+		Expect(err).To(BeNil())
+		Expect(uri).To(Equal("/app-foo-*,app-bar-*/_count?ignore_unavailable=false"))
+
+		uri, _, err = process("GET", "/*/_field_caps?fields=*", "")
+		Expect(err).To(BeNil())
+		Expect(uri).To(Equal("/app-foo-*,app-bar-*/_field_caps?fields=*&ignore_unavailable=true"))
+	})
+
+	It("should update the classification of the request", func() {
+		fixture.Projects = []apis.Project{{Name: "foo"}}
+		req, err := fixture.Process("GET", "/app-*/_search", "")
+		Expect(err).To(BeNil())
+		Expect(handlers.ESRequest(req.Context()).Indices).To(Equal([]string{"app-foo-*"}))
+		Expect(req.URL.Path).To(Equal("/app-foo-*/_search"))
+	})
+
+	It("should leave permitted targets as they are", func() {
+		uri, _, err := process("GET", "/app-foo-*/_search", "")
+		Expect(err).To(BeNil())
+		Expect(uri).To(Equal("/app-foo-*/_search"))
+	})
+
+	It("should deny searches of patterns matching no project", func() {
+		_, _, err := process("GET", "/infra-*/_search", "")
+		Expect(handlers.NewStructuredError(err).Message).To(Equal("Forbidden index infra-*"))
+	})
+
+	It("should deny foreign indices given with patterns", func() {
+		_, _, err := process("GET", "/app-*,app-other-000001/_search", "")
+		Expect(handlers.NewStructuredError(err).Message).To(Equal("Forbidden index app-other-000001"))
+	})
+
+	It("should not rewrite other requests", func() {
+		_, _, err := process("DELETE", "/app-*", "")
+		Expect(handlers.NewStructuredError(err).Message).To(Equal("Forbidden index app-*"))
+	})
+
+	It("should rewrite the headers of multi searches", func() {
+		body := `{"index":"app-*"}
+{"query":{"match_all":{}}}
+{"index":["app-foo-000001"],"preference":"abc"}
+{"query":{"match_all":{}},"index":"app-*"}
+
+{"size":0}
+`
+		uri, rewritten, err := process("POST", "/_msearch", body)
+		Expect(err).To(BeNil())
+		Expect(uri).To(Equal("/app-foo-*,app-bar-*/_msearch"))
+		Expect(rewritten).To(Equal(`{"ignore_unavailable":true,"index":"app-foo-*,app-bar-*"}
+{"query":{"match_all":{}}}
+{"index":["app-foo-000001"],"preference":"abc"}
+{"query":{"match_all":{}},"index":"app-*"}
+
+{"size":0}
+`))
+	})
+
+	It("should rewrite the headers of multi searches without targets in the path", func() {
+		inspector := newMsearchInspector(ioutil.NopCloser(strings.NewReader("{}\n{}\n{\"index\":\"_all\"}\n{}")), []string{"app-foo-*"}, []string{}, true, log.NewEntry(log.StandardLogger()))
+		Expect(test.Read(inspector)).To(Equal(`{"ignore_unavailable":true,"index":"app-foo-*"}
+{}
+{"ignore_unavailable":true,"index":"app-foo-*"}
+{}`))
+	})
+})
@@ -6,6 +6,9 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/openshift/elasticsearch-proxy/pkg/elasticsearch"
+	"github.com/openshift/elasticsearch-proxy/pkg/handlers"
 )
 
 type Handler interface {
@@ -17,6 +20,7 @@ type instrumentationHandler struct {
 	requestSize     *prometheus.SummaryVec
 	requestsTotal   *prometheus.CounterVec
 	responseSize    *prometheus.SummaryVec
+	actionsTotal    *prometheus.CounterVec
 }
 
 func (ins instrumentationHandler) WithHandler(name string, h http.Handler) http.HandlerFunc {
@@ -28,13 +32,25 @@ func (ins instrumentationHandler) WithHandler(name string, h http.Handler) http.
 				ins.requestsTotal.MustCurryWith(prometheus.Labels{"handler": name}),
 				promhttp.InstrumentHandlerResponseSize(
 					ins.responseSize.MustCurryWith(prometheus.Labels{"handler": name}),
-					h,
+					ins.withAction(name, h),
 				),
 			),
 		),
 	)
 }
 
+// withAction counts the requests by the action of their Elasticsearch classification
+func (ins instrumentationHandler) withAction(name string, h http.Handler) http.HandlerFunc {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		action := elasticsearch.ActionUnknown
+		if esRequest := handlers.ESRequest(req.Context()); esRequest != nil {
+			action = esRequest.Action
+		}
+		counter := ins.actionsTotal.MustCurryWith(prometheus.Labels{"handler": name, "action": string(action)})
+		promhttp.InstrumentHandlerCounter(counter, h).ServeHTTP(rw, req)
+	}
+}
+
 // NewHandler provides default instrucmentation handler
 func NewHandler(reg prometheus.Registerer) Handler {
 	return &instrumentationHandler{
@@ -69,5 +85,12 @@ func NewHandler(reg prometheus.Registerer) Handler {
 			},
 			[]string{"code", "handler", "method"},
 		),
+
+		actionsTotal: promauto.With(reg).NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "elasticsearch_requests_total",
+				Help: "Tracks the number of HTTP requests by Elasticsearch action.",
+			}, []string{"code", "handler", "action"},
+		),
 	}
 }
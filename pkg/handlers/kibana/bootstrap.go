@@ -0,0 +1,160 @@
+package kibana
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bluele/gcache"
+
+	"github.com/openshift/elasticsearch-proxy/pkg/handlers"
+)
+
+const (
+	cacheSize = 1000
+)
+
+// bootstrapper creates the index of Kibana of a user on first use with the mappings of the shared
+// index, which Kibana manages, so saved objects are indexed as they are in the shared index. Its
+// requests are made on behalf of the user with the headers identifying the user to Elasticsearch
+type bootstrapper struct {
+	url    *url.URL
+	client *http.Client
+	//existing are the indices known to exist, which are checked again once expired
+	existing gcache.Cache
+}
+
+func newBootstrapper(upstream *url.URL, client *http.Client, expiry time.Duration) *bootstrapper {
+	builder := gcache.New(cacheSize).LRU()
+	if expiry > 0 {
+		builder = builder.Expiration(expiry)
+	}
+	return &bootstrapper{
+		url:      upstream,
+		client:   client,
+		existing: builder.Build(),
+	}
+}
+
+// ensure creates the index unless it exists
+func (b *bootstrapper) ensure(req *http.Request, index string) error {
+	if b.existing.Has(index) {
+		return nil
+	}
+	logger := handlers.Logger(req.Context())
+	if err := b.create(req, index); err != nil {
+		logger.Errorf("Unable to bootstrap the Kibana index %s: %v", index, err)
+		return handlers.NewError("503", "Unable to create the Kibana index of the user")
+	}
+	_ = b.existing.Set(index, true)
+	return nil
+}
+
+func (b *bootstrapper) create(req *http.Request, index string) error {
+	resp, err := b.do(req, http.MethodHead, index, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+	default:
+		return fmt.Errorf("checking the index responded %s", resp.Status)
+	}
+
+	mappings, err := b.sharedMappings(req)
+	if err != nil {
+		return err
+	}
+	body := map[string]json.RawMessage{}
+	if mappings != nil {
+		body["mappings"] = mappings
+	}
+	data, _ := json.Marshal(body)
+	if resp, err = b.do(req, http.MethodPut, index, data); err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, _ = ioutil.ReadAll(resp.Body)
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		handlers.Logger(req.Context()).Infof("Created the Kibana index %s", index)
+		return nil
+	case resp.StatusCode == http.StatusBadRequest && bytes.Contains(data, []byte("resource_already_exists_exception")):
+		// the index was created by a concurrent request of the user
+		return nil
+	}
+	return fmt.Errorf("creating the index responded %s: %s", resp.Status, data)
+}
+
+// sharedMappings returns the mappings of the shared index, or nil when Kibana has not created it
+func (b *bootstrapper) sharedMappings(req *http.Request) (json.RawMessage, error) {
+	resp, err := b.do(req, http.MethodGet, sharedIndex+"/_mapping", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("reading the mappings of %s responded %s", sharedIndex, resp.Status)
+	}
+	indices := map[string]struct {
+		Mappings json.RawMessage `json:"mappings"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&indices); err != nil {
+		return nil, fmt.Errorf("unable to parse the mappings of %s: %v", sharedIndex, err)
+	}
+	// the shared index is an alias of the versioned indices Kibana migrates to, the latest
+	// of which has the current mappings
+	names := []string{}
+	for name := range indices {
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+	sort.Slice(names, func(i, j int) bool {
+		// .kibana_9 is older than .kibana_10
+		if len(names[i]) != len(names[j]) {
+			return len(names[i]) < len(names[j])
+		}
+		return names[i] < names[j]
+	})
+	return indices[names[len(names)-1]].Mappings, nil
+}
+
+func (b *bootstrapper) do(req *http.Request, method, path string, body []byte) (*http.Response, error) {
+	target := *b.url
+	target.Path = strings.TrimSuffix(target.Path, "/") + "/" + path
+	target.RawPath = ""
+	target.RawQuery = ""
+	var reader io.Reader = http.NoBody
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	outgoing, err := http.NewRequestWithContext(req.Context(), method, target.String(), reader)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range req.Header {
+		if handlers.IsIdentityHeader(name) {
+			outgoing.Header[name] = values
+		}
+	}
+	if body != nil {
+		outgoing.Header.Set("Content-Type", "application/json")
+	}
+	return b.client.Do(outgoing)
+}
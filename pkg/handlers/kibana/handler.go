@@ -0,0 +1,160 @@
+package kibana
+
+import (
+	"crypto/tls"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/openshift/elasticsearch-proxy/pkg/config"
+	"github.com/openshift/elasticsearch-proxy/pkg/elasticsearch"
+	"github.com/openshift/elasticsearch-proxy/pkg/handlers"
+	"github.com/openshift/elasticsearch-proxy/pkg/util"
+)
+
+const (
+	bootstrapTimeout = time.Duration(30) * time.Second
+	megabyte         = 1024 * 1024
+)
+
+type kibanaHandler struct {
+	//lock guards sharedRoles, adminRole and maxBodySize which are replaced on Reload
+	lock        sync.RWMutex
+	sharedRoles []string
+	adminRole   string
+	//maxBodySize is the size in bytes of the largest multi get body rewritten. Zero means no limit
+	maxBodySize int64
+	bootstrap   *bootstrapper
+}
+
+// NewHandlers is the initializer for this handler. No handler is returned unless users are given
+// their own index of Kibana
+func NewHandlers(opts *config.Options) []handlers.RequestHandler {
+	if opts.AuthKibanaIndexMode != config.KibanaIndexUser {
+		return []handlers.RequestHandler{}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if len(opts.UpstreamCAs) > 0 {
+		pool, err := util.GetCertPool(opts.UpstreamCAs, false)
+		if err != nil {
+			log.Fatalf("Error loading upstream CAs %v", err)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+	return []handlers.RequestHandler{
+		newKibanaHandler(opts, &http.Client{Transport: transport, Timeout: bootstrapTimeout}),
+	}
+}
+
+func newKibanaHandler(opts *config.Options, client *http.Client) *kibanaHandler {
+	return &kibanaHandler{
+		sharedRoles: opts.AuthKibanaSharedRoles,
+		adminRole:   opts.AuthAdminRole,
+		maxBodySize: int64(opts.AuthNamespaceFilterMaxBodySize) * megabyte,
+		bootstrap:   newBootstrapper(opts.ElasticsearchURL, client, opts.CacheExpiry),
+	}
+}
+
+func (h *kibanaHandler) Name() string {
+	return "kibana"
+}
+
+// Reload replaces the roles keeping the shared index and the body limit with those of the given options. Changing
+// the index mode requires a restart
+func (h *kibanaHandler) Reload(opts *config.Options) error {
+	if opts.AuthKibanaIndexMode != config.KibanaIndexUser {
+		log.Warn("Keeping the Kibana index of each user as auth-kibana-index-mode can not be changed without a restart")
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.sharedRoles = opts.AuthKibanaSharedRoles
+	h.adminRole = opts.AuthAdminRole
+	h.maxBodySize = int64(opts.AuthNamespaceFilterMaxBodySize) * megabyte
+	log.Infof("Reloaded %d roles keeping the shared Kibana index", len(opts.AuthKibanaSharedRoles))
+	return nil
+}
+
+// isShared returns true when one of the roles keeps the shared index
+func (h *kibanaHandler) isShared(roles []string) bool {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	for _, role := range roles {
+		if h.adminRole != "" && role == h.adminRole {
+			return true
+		}
+		for _, shared := range h.sharedRoles {
+			if role == shared {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Process rewrites the requests of users for the shared index of Kibana to their own index, in the
+// path and in the bodies of bulk, multi search and multi get requests. The index of the user is
+// created before it is first used. The indices of other users are forbidden. Requests of the admin
+// role, of the roles keeping the shared index and of certificates are left as they are
+func (h *kibanaHandler) Process(req *http.Request) (*http.Request, error) {
+	logger := handlers.Logger(req.Context())
+	ctx := req.Context()
+	if method, _ := ctx.Value(handlers.AuthMethodKey).(string); method != handlers.AuthMethodToken {
+		return req, nil
+	}
+	roles, _ := ctx.Value(handlers.RolesKey).([]string)
+	username, _ := ctx.Value(handlers.UsernameKey).(string)
+	esRequest := handlers.ESRequest(ctx)
+	if username == "" || esRequest == nil || h.isShared(roles) {
+		logger.Trace("Keeping the shared Kibana index")
+		return req, nil
+	}
+	index := elasticsearch.KibanaUserIndex(username)
+
+	if target := forbidden(esRequest.Indices, index); target != "" {
+		logger.Debugf("Denied the Kibana index %s of another user", target)
+		return req, handlers.NewError("403", "Forbidden index "+target)
+	}
+	if targets, changed := userTargets(esRequest.Indices, index); changed {
+		logger.Debugf("Rewriting the targets %v to %v", esRequest.Indices, targets)
+		req = handlers.WithTargets(req, targets)
+		esRequest = handlers.ESRequest(req.Context())
+	}
+	switch {
+	case esRequest.Action == elasticsearch.ActionCreateIndex, esRequest.Action == elasticsearch.ActionDeleteIndex:
+		// the index is created or deleted by the request itself
+	case esRequest.TargetSegment() != 0:
+		// the index is only named by listings, i.e. _cat/indices/.kibana
+	default:
+		for _, target := range esRequest.Indices {
+			if target == index {
+				if err := h.bootstrap.ensure(req, index); err != nil {
+					return req, err
+				}
+				break
+			}
+		}
+	}
+
+	ensure := func() error {
+		return h.bootstrap.ensure(req, index)
+	}
+	if req.Body == nil || req.Body == http.NoBody {
+		return req, nil
+	}
+	h.lock.RLock()
+	maxBodySize := h.maxBodySize
+	h.lock.RUnlock()
+	switch esRequest.Endpoint {
+	case "_bulk", "_msearch":
+		req = req.Clone(req.Context())
+		req.Body = newBodyRewriter(req.Body, index, esRequest.Endpoint == "_msearch", ensure)
+		// the length of the body changes with the name of the index
+		req.ContentLength = -1
+		req.Header.Del("Content-Length")
+	case "_mget":
+		return rewriteMultiGet(req, index, maxBodySize, ensure)
+	}
+	return req, nil
+}
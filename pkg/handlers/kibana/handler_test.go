@@ -0,0 +1,280 @@
+package kibana
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/openshift/elasticsearch-proxy/pkg/config"
+	"github.com/openshift/elasticsearch-proxy/pkg/handlers"
+	"github.com/openshift/elasticsearch-proxy/test"
+)
+
+const (
+	aliceIndex = ".kibana.522b276a356bdf39013dfabea2cd43e141ecc9e8"
+)
+
+var _ = Describe("Process", func() {
+
+	var (
+		handler       *kibanaHandler
+		server        *httptest.Server
+		upstream      []string
+		indexStatus   int
+		mappingStatus int
+		createStatus  int
+		created       string
+		headers       []http.Header
+		fixture       *test.RequestFixture
+	)
+
+	BeforeEach(func() {
+		upstream = []string{}
+		indexStatus, mappingStatus, createStatus = http.StatusNotFound, http.StatusOK, http.StatusOK
+		created = ""
+		headers = []http.Header{}
+		server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			upstream = append(upstream, req.Method+" "+req.URL.Path+" "+req.Header.Get("X-Forwarded-User"))
+			headers = append(headers, req.Header)
+			switch {
+			case req.Method == http.MethodHead:
+				rw.WriteHeader(indexStatus)
+			case req.URL.Path == "/.kibana/_mapping":
+				rw.WriteHeader(mappingStatus)
+				_, _ = rw.Write([]byte(`{".kibana_9":{"mappings":{"dynamic":"false"}},".kibana_10":{"mappings":{"dynamic":"strict"}}}`))
+			case req.Method == http.MethodPut:
+				data, _ := ioutil.ReadAll(req.Body)
+				created = string(data)
+				rw.WriteHeader(createStatus)
+				if createStatus == http.StatusBadRequest {
+					_, _ = rw.Write([]byte(`{"error":{"type":"resource_already_exists_exception"},"status":400}`))
+				}
+			}
+		}))
+		serverURL, _ := url.Parse(server.URL)
+		handler = newKibanaHandler(&config.Options{
+			ElasticsearchURL:      serverURL,
+			AuthAdminRole:         "admin_reader",
+			AuthKibanaIndexMode:   config.KibanaIndexUser,
+			AuthKibanaSharedRoles: []string{"infra_reader"},
+			CacheExpiry:           time.Minute,
+		}, server.Client())
+		fixture = test.NewRequestFixture(handler)
+		fixture.Header.Set("X-Forwarded-User", fixture.Username)
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should rewrite the shared index to that of the user and create it on first use", func() {
+		req, err := fixture.Process("GET", "/.kibana/_doc/config:7.10.2?refresh=true", "")
+		Expect(err).To(BeNil())
+		Expect(req.RequestURI).To(Equal("/" + aliceIndex + "/_doc/config:7.10.2?refresh=true"))
+		Expect(handlers.ESRequest(req.Context()).Indices).To(Equal([]string{aliceIndex}))
+		Expect(upstream).To(Equal([]string{
+			"HEAD /" + aliceIndex + " alice",
+			"GET /.kibana/_mapping alice",
+			"PUT /" + aliceIndex + " alice",
+		}))
+		Expect(created).To(Equal(`{"mappings":{"dynamic":"strict"}}`))
+
+		_, err = fixture.Process("POST", "/.kibana_2/_search", `{"query":{"match_all":{}}}`)
+		Expect(err).To(BeNil())
+		Expect(upstream).To(HaveLen(3))
+	})
+
+	It("should create the index with the headers identifying the user to Elasticsearch", func() {
+		fixture.Header.Set("X-Forwarded-Roles", "project_user")
+		fixture.Header.Set("X-OCP-NS", "foo,bar")
+		fixture.Header.Set("X-Opaque-Id", "abc")
+		_, err := fixture.Process("GET", "/.kibana/_search", "")
+		Expect(err).To(BeNil())
+		Expect(headers).To(HaveLen(3))
+		for _, header := range headers {
+			Expect(header.Get("X-Forwarded-User")).To(Equal("alice"))
+			Expect(header.Get("X-Forwarded-Roles")).To(Equal("project_user"))
+			Expect(header.Get("X-OCP-NS")).To(Equal("foo,bar"))
+			Expect(header.Get("X-Opaque-Id")).To(BeEmpty())
+		}
+	})
+
+	It("should create the index of the user without mappings before Kibana created the shared index", func() {
+		mappingStatus = http.StatusNotFound
+		_, err := fixture.Process("GET", "/.kibana", "")
+		Expect(err).To(BeNil())
+		Expect(created).To(Equal(`{}`))
+	})
+
+	It("should not create an index which exists or is created by the request", func() {
+		indexStatus = http.StatusOK
+		_, err := fixture.Process("GET", "/.kibana_7.10.2_001/_search", "")
+		Expect(err).To(BeNil())
+		Expect(upstream).To(Equal([]string{"HEAD /" + aliceIndex + " alice"}))
+
+		upstream = []string{}
+		handler.bootstrap.existing.Purge()
+		req, err := fixture.Process("PUT", "/.kibana", `{"mappings":{}}`)
+		Expect(err).To(BeNil())
+		Expect(req.URL.Path).To(Equal("/" + aliceIndex))
+		Expect(upstream).To(BeEmpty())
+	})
+
+	It("should tolerate an index created by a concurrent request", func() {
+		createStatus = http.StatusBadRequest
+		_, err := fixture.Process("GET", "/.kibana/_doc/1", "")
+		Expect(err).To(BeNil())
+	})
+
+	It("should fail the request when the index of the user can not be created", func() {
+		createStatus = http.StatusForbidden
+		_, err := fixture.Process("GET", "/.kibana/_doc/1", "")
+		Expect(test.Failure(err, http.StatusServiceUnavailable)).To(Equal("Unable to create the Kibana index of the user"))
+	})
+
+	It("should keep other indices of Kibana shared", func() {
+		req, err := fixture.Process("POST", "/.kibana_task_manager/_search", "")
+		Expect(err).To(BeNil())
+		Expect(req.URL.Path).To(Equal("/.kibana_task_manager/_search"))
+		Expect(upstream).To(BeEmpty())
+	})
+
+	It("should deny the indices of other users and exclude them from patterns", func() {
+		_, err := fixture.Process("GET", "/.kibana.d033e22ae348aeb5660fc2140aec35850c4da997/_search", "")
+		Expect(test.Failure(err, http.StatusForbidden)).To(Equal("Forbidden index .kibana.d033e22ae348aeb5660fc2140aec35850c4da997"))
+
+		req, err := fixture.Process("GET", "/.kibana*,app-*/_search", "")
+		Expect(err).To(BeNil())
+		Expect(req.URL.Path).To(Equal("/.kibana*,app-*,-.kibana.*/_search"))
+		Expect(handlers.ESRequest(req.Context()).Indices).To(Equal([]string{".kibana*", "app-*", "-.kibana.*"}))
+		req, err = fixture.Process("GET", "/app-*/_search", "")
+		Expect(err).To(BeNil())
+		Expect(req.URL.Path).To(Equal("/app-*/_search"))
+	})
+
+	It("should deny date math naming the indices of other users", func() {
+		_, err := fixture.Process("GET", "/%3C.kibana.d033e22ae348aeb5660fc2140aec35850c4da997%3E/_search", "")
+		Expect(test.Failure(err, http.StatusForbidden)).To(Equal("Forbidden index <.kibana.d033e22ae348aeb5660fc2140aec35850c4da997>"))
+		_, err = fixture.Process("GET", "/%3C.kibana.%7Bnow%2Fd%7D%3E/_search", "")
+		Expect(test.Failure(err, http.StatusForbidden)).To(Equal("Forbidden index <.kibana.{now/d}>"))
+		_, err = fixture.Process("GET", "/%3C"+aliceIndex+"%3E/_search", "")
+		Expect(err).To(BeNil())
+	})
+
+	It("should rewrite the targets of listings without creating the index", func() {
+		req, err := fixture.Process("GET", "/_cat/indices/.kibana?format=json", "")
+		Expect(err).To(BeNil())
+		Expect(req.RequestURI).To(Equal("/_cat/indices/" + aliceIndex + "?format=json"))
+		req, err = fixture.Process("GET", "/_resolve/index/.kibana", "")
+		Expect(err).To(BeNil())
+		Expect(req.URL.Path).To(Equal("/_resolve/index/" + aliceIndex))
+		req, err = fixture.Process("GET", "/_data_stream/.kibana*", "")
+		Expect(err).To(BeNil())
+		Expect(req.URL.Path).To(Equal("/_data_stream/.kibana*,-.kibana.*"))
+		Expect(upstream).To(BeEmpty())
+	})
+
+	It("should rewrite the actions of bulk requests", func() {
+		req, err := fixture.Process("POST", "/_bulk", `{"index":{"_index":".kibana","_id":"config:7.10.2"}}
+{"config":{"_index":".kibana"}}
+{"delete":{"_index":".kibana_1","_id":"2"}}
+
+{"update":{"_index":"app-foo-000001","_id":"3"}}
+{"doc":{}}
+`)
+		Expect(err).To(BeNil())
+		Expect(req.ContentLength).To(BeEquivalentTo(-1))
+		Expect(upstream).To(BeEmpty())
+		Expect(test.Read(req.Body)).To(Equal(`{"index":{"_id":"config:7.10.2","_index":"` + aliceIndex + `"}}
+{"config":{"_index":".kibana"}}
+{"delete":{"_id":"2","_index":"` + aliceIndex + `"}}
+
+{"update":{"_index":"app-foo-000001","_id":"3"}}
+{"doc":{}}
+`))
+		Expect(upstream).To(HaveLen(3))
+
+		req, err = fixture.Process("POST", "/_bulk", "{\"index\":{\"_index\":\"app-foo-000001\"}}\n{}\n{\"index\":{\"_index\":\".kibana.d033e22ae348aeb5660fc2140aec35850c4da997\"}}\n{}\n")
+		Expect(err).To(BeNil())
+		data, err := test.Read(req.Body)
+		Expect(data).To(Equal("{\"index\":{\"_index\":\"app-foo-000001\"}}\n{}\n"))
+		Expect(test.Failure(err, http.StatusForbidden)).To(Equal("Forbidden index .kibana.d033e22ae348aeb5660fc2140aec35850c4da997 in bulk index on line 3"))
+	})
+
+	It("should rewrite the headers of multi searches", func() {
+		req, err := fixture.Process("POST", "/_msearch", `{"index":".kibana"}
+{"query":{"term":{"index":".kibana"}}}
+{}
+{}
+{"index":[".kibana*"]}
+{}
+`)
+		Expect(err).To(BeNil())
+		Expect(test.Read(req.Body)).To(Equal(`{"index":"` + aliceIndex + `"}
+{"query":{"term":{"index":".kibana"}}}
+{}
+{}
+{"index":".kibana*,-.kibana.*"}
+{}
+`))
+
+		req, err = fixture.Process("POST", "/_msearch", "\n{\"index\":\".kibana\"}\n{}\n")
+		Expect(err).To(BeNil())
+		Expect(test.Read(req.Body)).To(Equal("{\"index\":\"" + aliceIndex + "\"}\n{}\n"))
+
+		req, err = fixture.Process("POST", "/_msearch", "{\"indices\":[\".kibana\"]}\n{}\n")
+		Expect(err).To(BeNil())
+		Expect(test.Read(req.Body)).To(Equal("{\"index\":\"" + aliceIndex + "\"}\n{}\n"))
+
+		req, err = fixture.Process("POST", "/_msearch", "{\"index\":\"app-foo-*\",\"indices\":\".kibana.d033e22ae348aeb5660fc2140aec35850c4da997\"}\n{}\n")
+		Expect(err).To(BeNil())
+		_, err = test.Read(req.Body)
+		Expect(test.Failure(err, http.StatusBadRequest)).To(Equal("Unable to parse the index of the multi search header on line 1: both index and indices are given"))
+	})
+
+	It("should rewrite the documents of multi gets", func() {
+		req, err := fixture.Process("POST", "/_mget", `{"docs":[{"_index":".kibana","_id":"1"},{"_index":"app-foo-000001","_id":"2"}]}`)
+		Expect(err).To(BeNil())
+		data, _ := test.Read(req.Body)
+		Expect(data).To(Equal(`{"docs":[{"_id":"1","_index":"` + aliceIndex + `"},{"_id":"2","_index":"app-foo-000001"}]}`))
+		Expect(req.ContentLength).To(BeEquivalentTo(len(data)))
+
+		req, err = fixture.Process("POST", "/.kibana/_mget", `{"ids":["1"]}`)
+		Expect(err).To(BeNil())
+		Expect(req.URL.Path).To(Equal("/" + aliceIndex + "/_mget"))
+		Expect(test.Read(req.Body)).To(Equal(`{"ids":["1"]}`))
+	})
+
+	It("should not rewrite multi gets larger than the limit", func() {
+		handler.maxBodySize = 16
+		_, err := fixture.Process("POST", "/_mget", `{"docs":[{"_index":".kibana","_id":"1"}]}`)
+		Expect(test.Failure(err, http.StatusRequestEntityTooLarge)).To(Equal("Request body larger than 16 bytes can not be inspected"))
+	})
+
+	It("should keep the shared index for the admin role, shared roles and certificates", func() {
+		for _, role := range []string{"admin_reader", "infra_reader"} {
+			fixture.Roles = []string{role}
+			req, err := fixture.Process("GET", "/.kibana/_search", "")
+			Expect(err).To(BeNil())
+			Expect(req.URL.Path).To(Equal("/.kibana/_search"))
+		}
+		fixture.Roles = []string{}
+		fixture.AuthMethod = handlers.AuthMethodCertificate
+		req, err := fixture.Process("GET", "/.kibana/_search", "")
+		Expect(err).To(BeNil())
+		Expect(req.URL.Path).To(Equal("/.kibana/_search"))
+		Expect(upstream).To(BeEmpty())
+	})
+})
+
+var _ = Describe("NewHandlers", func() {
+	It("should only return a handler when users have their own index", func() {
+		Expect(NewHandlers(&config.Options{AuthKibanaIndexMode: config.KibanaIndexShared})).To(BeEmpty())
+		Expect(NewHandlers(&config.Options{AuthKibanaIndexMode: config.KibanaIndexUser, ElasticsearchURL: &url.URL{Scheme: "http", Host: "localhost:9200"}})).To(HaveLen(1))
+	})
+})
@@ -0,0 +1,13 @@
+package kibana
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestKibana(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Kibana Suite")
+}
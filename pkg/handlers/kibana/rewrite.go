@@ -0,0 +1,251 @@
+package kibana
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/openshift/elasticsearch-proxy/pkg/elasticsearch"
+	"github.com/openshift/elasticsearch-proxy/pkg/handlers"
+)
+
+const (
+	sharedIndex     = ".kibana"
+	userIndexPrefix = elasticsearch.KibanaUserIndexPrefix
+	//userIndicesExclusion excludes the index of every user from the targets before it
+	userIndicesExclusion = "-" + userIndexPrefix + "*"
+)
+
+// bulkActions are the bulk actions and whether they are followed by a source line
+var bulkActions = map[string]bool{
+	"index":  true,
+	"create": true,
+	"update": true,
+	"delete": false,
+}
+
+// isShared returns true for the shared index of Kibana and its versioned names, i.e. .kibana_1
+// or .kibana_7.10.0_001
+func isShared(name string) bool {
+	if name == sharedIndex {
+		return true
+	}
+	version := strings.TrimPrefix(name, sharedIndex+"_")
+	return version != name && version != "" && version[0] >= '0' && version[0] <= '9'
+}
+
+// forbidden returns the first target naming the index of another user, if any. Date math targets
+// are denied by the indices they resolve to, which are never those of users when resolved to a pattern
+func forbidden(targets []string, index string) string {
+	for _, target := range targets {
+		name := elasticsearch.ResolveDateMath(target)
+		if strings.HasPrefix(name, userIndexPrefix) && name != index && (name != target || !strings.Contains(name, "*")) {
+			return target
+		}
+	}
+	return ""
+}
+
+// userTargets returns the targets with the shared index of Kibana replaced by the index of the
+// user. Patterns which may match the indices of users are followed by an exclusion of them, which
+// also applies to the index of the user as Kibana only knows it as the shared index. It returns
+// true when the targets changed
+func userTargets(targets []string, index string) ([]string, bool) {
+	rewritten := make([]string, 0, len(targets)+1)
+	changed, exclude := false, false
+	for _, target := range targets {
+		switch {
+		case isShared(target):
+			target, changed = index, true
+		case strings.HasPrefix(target, "-"):
+		case strings.Contains(target, "*"):
+			prefix := target[:strings.Index(target, "*")]
+			if strings.HasPrefix(userIndexPrefix, prefix) || strings.HasPrefix(prefix, userIndexPrefix) {
+				exclude = true
+			}
+		}
+		rewritten = append(rewritten, target)
+	}
+	if exclude {
+		// exclusions only apply to the targets before them
+		rewritten, changed = append(rewritten, userIndicesExclusion), true
+	}
+	return rewritten, changed
+}
+
+// bodyRewriter replaces the shared index of Kibana by the index of the user in the actions of a
+// bulk body, or the headers of a multi search body, as it is read. Only the line being read is
+// held. The index of the user is created before the first line naming it is sent to Elasticsearch.
+// Lines which can not be parsed are left for Elasticsearch to reject
+type bodyRewriter struct {
+	body        io.ReadCloser
+	reader      *bufio.Reader
+	index       string
+	multiSearch bool
+	ensure      func() error
+	ensured     bool
+
+	line int
+	//data is true when the next line is the source of a bulk action or the body of a search
+	data bool
+	//pending is the data not read yet
+	pending []byte
+	err     error
+}
+
+func newBodyRewriter(body io.ReadCloser, index string, multiSearch bool, ensure func() error) *bodyRewriter {
+	return &bodyRewriter{
+		body:        body,
+		reader:      bufio.NewReader(body),
+		index:       index,
+		multiSearch: multiSearch,
+		ensure:      ensure,
+	}
+}
+
+func (r *bodyRewriter) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		line, err := r.reader.ReadBytes('\n')
+		r.err = err
+		if len(line) == 0 {
+			continue
+		}
+		r.line++
+		if r.data {
+			r.data = false
+			r.pending = line
+			continue
+		}
+		if r.multiSearch {
+			if elasticsearch.SkipsMultiSearchLine(r.line, line) {
+				continue
+			}
+			r.data = true
+			line, err = r.rewriteHeader(line)
+		} else if len(bytes.TrimSpace(line)) > 0 {
+			// empty lines are skipped by Elasticsearch where an action is expected
+			line, err = r.rewriteAction(line)
+		}
+		if err != nil {
+			r.err = &handlers.RequestBodyError{Err: err}
+			return 0, r.err
+		}
+		r.pending = line
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+func (r *bodyRewriter) Close() error {
+	return r.body.Close()
+}
+
+// rewriteAction returns the bulk action with the index of the user in place of the shared index
+func (r *bodyRewriter) rewriteAction(line []byte) ([]byte, error) {
+	action := map[string]map[string]json.RawMessage{}
+	if err := json.Unmarshal(line, &action); err != nil || len(action) != 1 {
+		return line, nil
+	}
+	for name, metadata := range action {
+		r.data = bulkActions[name]
+		index := ""
+		if raw, found := metadata["_index"]; !found || json.Unmarshal(raw, &index) != nil {
+			return line, nil
+		}
+		if target := forbidden([]string{index}, r.index); target != "" {
+			return nil, handlers.NewError("403", fmt.Sprintf("Forbidden index %s in bulk %s on line %d", target, name, r.line))
+		}
+		if !isShared(index) {
+			return line, nil
+		}
+		metadata["_index"], _ = json.Marshal(r.index)
+	}
+	return r.rewritten(action)
+}
+
+// rewriteHeader returns the header of a search with the index of the user in place of the shared index
+func (r *bodyRewriter) rewriteHeader(line []byte) ([]byte, error) {
+	header := map[string]json.RawMessage{}
+	if err := json.Unmarshal(line, &header); err != nil {
+		return line, nil
+	}
+	targets, err := elasticsearch.MultiSearchTargets(header)
+	if err != nil {
+		return nil, handlers.NewError("400", fmt.Sprintf("Unable to parse the index of the multi search header on line %d: %v", r.line, err))
+	}
+	if target := forbidden(targets, r.index); target != "" {
+		return nil, handlers.NewError("403", fmt.Sprintf("Forbidden index %s in multi search on line %d", target, r.line))
+	}
+	targets, changed := userTargets(targets, r.index)
+	if !changed {
+		return line, nil
+	}
+	delete(header, "indices")
+	header["index"], _ = json.Marshal(strings.Join(targets, ","))
+	return r.rewritten(header)
+}
+
+func (r *bodyRewriter) rewritten(value interface{}) ([]byte, error) {
+	if !r.ensured {
+		if err := r.ensure(); err != nil {
+			return nil, err
+		}
+		r.ensured = true
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// rewriteMultiGet returns the request with the index of the user in place of the shared index in
+// the documents of its body, which must not be larger than the limit unless zero
+func rewriteMultiGet(req *http.Request, index string, maxBodySize int64, ensure func() error) (*http.Request, error) {
+	data, err := handlers.ReadBody(req, maxBodySize)
+	if err != nil {
+		return req, err
+	}
+	req = req.Clone(req.Context())
+	handlers.SetBody(req, data, "application/json")
+	body := map[string]json.RawMessage{}
+	docs := []map[string]json.RawMessage{}
+	if json.Unmarshal(data, &body) != nil || json.Unmarshal(body["docs"], &docs) != nil {
+		// the documents are given by their ID in the path or are left for Elasticsearch to reject
+		return req, nil
+	}
+	changed := false
+	for _, doc := range docs {
+		name := ""
+		if raw, found := doc["_index"]; !found || json.Unmarshal(raw, &name) != nil {
+			continue
+		}
+		if target := forbidden([]string{name}, index); target != "" {
+			return req, handlers.NewError("403", "Forbidden index "+target)
+		}
+		if isShared(name) {
+			doc["_index"], _ = json.Marshal(index)
+			changed = true
+		}
+	}
+	if !changed {
+		return req, nil
+	}
+	if err := ensure(); err != nil {
+		return req, err
+	}
+	body["docs"], _ = json.Marshal(docs)
+	if data, err = json.Marshal(body); err != nil {
+		return req, err
+	}
+	handlers.SetBody(req, data, "application/json")
+	return req, nil
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	LoggerKey    ContextKey = "logger"
+	RequestIDKey ContextKey = "requestID"
+
+	//RequestIDHeader is the response header giving the ID of the request
+	RequestIDHeader = "X-Request-Id"
+	//OpaqueIDHeader identifies a request to Elasticsearch in its tasks and slow logs
+	OpaqueIDHeader = "X-Opaque-Id"
+
+	maxRequestIDLength = 128
+)
+
+// Logger returns the logger of the request stored in the context or the standard
+// logger when there is none
+func Logger(ctx context.Context) *log.Entry {
+	if logger, ok := ctx.Value(LoggerKey).(*log.Entry); ok {
+		return logger
+	}
+	return log.NewEntry(log.StandardLogger())
+}
+
+// WithLogFields returns the request with a logger that adds the given fields to the
+// fields of the current logger of the request
+func WithLogFields(req *http.Request, fields log.Fields) *http.Request {
+	logger := Logger(req.Context()).WithFields(fields)
+	return req.WithContext(context.WithValue(req.Context(), LoggerKey, logger))
+}
+
+// WithRequestID returns the request with the request ID stored in the context
+// and added to the fields of its logger
+func WithRequestID(req *http.Request, id string) *http.Request {
+	req = req.WithContext(context.WithValue(req.Context(), RequestIDKey, id))
+	return WithLogFields(req, log.Fields{"request_id": id})
+}
+
+// ValidRequestID returns true if the ID given by a client can be used as a request ID. It
+// must be short and only use characters which are safe in headers and logs
+func ValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.ContainsRune("-_.:/@", c):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// NewRequestID returns a random identifier for a request
+func NewRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		log.Errorf("Unable to generate a request ID: %v", err)
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
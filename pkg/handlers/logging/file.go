@@ -0,0 +1,214 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	backupTimeFormat = "20060102T150405.000"
+)
+
+// RotatingFile is an io.Writer to a file which is rotated when it reaches a size or age.
+// Rotated files are renamed with the time of their rotation and removed once there are
+// more than a number of them or they are too old. Writes are safe for concurrent use
+type RotatingFile struct {
+	path string
+	//maxSize is the size in bytes after which the file is rotated. Zero disables it
+	maxSize int64
+	//rotateInterval is the age after which the file is rotated. Zero disables it
+	rotateInterval time.Duration
+	//maxBackups is the number of rotated files retained. Zero retains every file
+	maxBackups int
+	//maxAge is the age after which rotated files are removed. Zero retains every file
+	maxAge time.Duration
+
+	lock     sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+	now      func() time.Time
+}
+
+// NewRotatingFile opens the file for appending, creating it if needed
+func NewRotatingFile(path string, maxSize int64, rotateInterval time.Duration, maxBackups int, maxAge time.Duration) (*RotatingFile, error) {
+	f := &RotatingFile{
+		path:           path,
+		maxSize:        maxSize,
+		rotateInterval: rotateInterval,
+		maxBackups:     maxBackups,
+		maxAge:         maxAge,
+		now:            time.Now,
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	f.openedAt = f.now()
+	return nil
+}
+
+// Write appends p to the file after rotating it if writing p would exceed the maximum size
+// or the file is older than the rotation interval
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+	if f.shouldRotate(len(p)) {
+		if err := f.rotate(); err != nil {
+			log.Errorf("Unable to rotate %s: %v", f.path, err)
+		}
+		if f.file == nil {
+			return 0, fmt.Errorf("unable to open %s after rotating it", f.path)
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *RotatingFile) shouldRotate(length int) bool {
+	if f.size == 0 {
+		return false
+	}
+	if f.maxSize > 0 && f.size+int64(length) > f.maxSize {
+		return true
+	}
+	return f.rotateInterval > 0 && f.now().Sub(f.openedAt) >= f.rotateInterval
+}
+
+// rotate renames the file with the time of rotation, opens a new file and removes
+// the rotated files which are not retained
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+	backup := fmt.Sprintf("%s.%s", f.path, f.now().UTC().Format(backupTimeFormat))
+	// never replace a file rotated at the same time
+	for i := 1; fileExists(backup); i++ {
+		backup = fmt.Sprintf("%s.%s-%d", f.path, f.now().UTC().Format(backupTimeFormat), i)
+	}
+	if err := os.Rename(f.path, backup); err != nil {
+		// keep writing to the file which could not be rotated
+		if openErr := f.open(); openErr != nil {
+			return openErr
+		}
+		return err
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	f.removeBackups()
+	return nil
+}
+
+func (f *RotatingFile) removeBackups() {
+	backups := f.backups()
+	for i, backup := range backups {
+		remove := f.maxBackups > 0 && i < len(backups)-f.maxBackups
+		if f.maxAge > 0 && f.now().Sub(backup.rotated) > f.maxAge {
+			remove = true
+		}
+		if remove {
+			if err := os.Remove(backup.path); err != nil {
+				log.Errorf("Unable to remove the rotated file %s: %v", backup.path, err)
+			}
+		}
+	}
+}
+
+type backupFile struct {
+	path    string
+	rotated time.Time
+	//counter distinguishes files rotated at the same time
+	counter int
+}
+
+// backups lists the rotated files, oldest first
+func (f *RotatingFile) backups() []backupFile {
+	matches, err := filepath.Glob(f.path + ".*")
+	if err != nil {
+		log.Errorf("Unable to list the rotated files of %s: %v", f.path, err)
+		return nil
+	}
+	backups := []backupFile{}
+	for _, match := range matches {
+		parts := strings.SplitN(strings.TrimPrefix(match, f.path+"."), "-", 2)
+		rotated, err := time.Parse(backupTimeFormat, parts[0])
+		if err != nil {
+			continue
+		}
+		backup := backupFile{path: match, rotated: rotated}
+		if len(parts) == 2 {
+			if backup.counter, err = strconv.Atoi(parts[1]); err != nil {
+				continue
+			}
+		}
+		backups = append(backups, backup)
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		if backups[i].rotated.Equal(backups[j].rotated) {
+			return backups[i].counter < backups[j].counter
+		}
+		return backups[i].rotated.Before(backups[j].rotated)
+	})
+	return backups
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// Reopen closes the file and opens the file at the path again, which is expected to be
+// called once an external tool moved the file to rotate it
+func (f *RotatingFile) Reopen() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.file != nil {
+		if err := f.file.Close(); err != nil {
+			log.Errorf("Unable to close %s: %v", f.path, err)
+		}
+		f.file = nil
+	}
+	return f.open()
+}
+
+// Close closes the file
+func (f *RotatingFile) Close() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
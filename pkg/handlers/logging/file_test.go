@@ -0,0 +1,141 @@
+package logging
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bmizerany/assert"
+)
+
+// fakeClock returns a time which is advanced by the tests
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func newTestFile(t *testing.T, maxSize int64, rotateInterval time.Duration, maxBackups int, maxAge time.Duration) (*RotatingFile, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	f, err := NewRotatingFile(filepath.Join(t.TempDir(), "access.log"), maxSize, rotateInterval, maxBackups, maxAge)
+	assert.Equal(t, nil, err)
+	f.now = clock.Now
+	f.openedAt = clock.now
+	return f, clock
+}
+
+func backups(f *RotatingFile) []string {
+	paths := []string{}
+	for _, backup := range f.backups() {
+		paths = append(paths, backup.path)
+	}
+	return paths
+}
+
+func read(t *testing.T, path string) string {
+	b, err := os.ReadFile(path)
+	assert.Equal(t, nil, err)
+	return string(b)
+}
+
+func TestRotateOnSize(t *testing.T) {
+	f, clock := newTestFile(t, 11, 0, 0, 0)
+	defer f.Close()
+	f.Write([]byte("12345\n"))
+	f.Write([]byte("6789\n"))
+	clock.now = clock.now.Add(time.Second)
+	f.Write([]byte("abc\n"))
+
+	assert.Equal(t, 1, len(backups(f)))
+	assert.Equal(t, "12345\n6789\n", read(t, backups(f)[0]))
+	assert.Equal(t, "abc\n", read(t, f.path))
+}
+
+func TestRotateOnInterval(t *testing.T) {
+	f, clock := newTestFile(t, 0, time.Hour, 0, 0)
+	defer f.Close()
+	f.Write([]byte("first\n"))
+	clock.now = clock.now.Add(59 * time.Minute)
+	f.Write([]byte("second\n"))
+	assert.Equal(t, 0, len(backups(f)))
+
+	clock.now = clock.now.Add(time.Minute)
+	f.Write([]byte("third\n"))
+	assert.Equal(t, 1, len(backups(f)))
+	assert.Equal(t, "third\n", read(t, f.path))
+}
+
+func TestRetainMaxBackups(t *testing.T) {
+	f, clock := newTestFile(t, 1, 0, 2, 0)
+	defer f.Close()
+	for _, line := range []string{"a\n", "b\n", "c\n", "d\n", "e\n"} {
+		clock.now = clock.now.Add(time.Second)
+		f.Write([]byte(line))
+	}
+	rotated := backups(f)
+	assert.Equal(t, 2, len(rotated))
+	assert.Equal(t, "c\n", read(t, rotated[0]))
+	assert.Equal(t, "d\n", read(t, rotated[1]))
+}
+
+func TestRemoveBackupsOlderThanMaxAge(t *testing.T) {
+	f, clock := newTestFile(t, 1, 0, 0, time.Hour)
+	defer f.Close()
+	f.Write([]byte("a\n"))
+	clock.now = clock.now.Add(time.Second)
+	f.Write([]byte("b\n"))
+	assert.Equal(t, 1, len(backups(f)))
+
+	clock.now = clock.now.Add(2 * time.Hour)
+	f.Write([]byte("c\n"))
+	assert.Equal(t, 1, len(backups(f)))
+	assert.Equal(t, "b\n", read(t, backups(f)[0]))
+}
+
+func TestReopen(t *testing.T) {
+	f, _ := newTestFile(t, 0, 0, 0, 0)
+	defer f.Close()
+	f.Write([]byte("before\n"))
+	moved := f.path + ".moved"
+	assert.Equal(t, nil, os.Rename(f.path, moved))
+	f.Write([]byte("still moved\n"))
+
+	assert.Equal(t, nil, f.Reopen())
+	f.Write([]byte("after\n"))
+	assert.Equal(t, "before\nstill moved\n", read(t, moved))
+	assert.Equal(t, "after\n", read(t, f.path))
+}
+
+func TestConcurrentWrites(t *testing.T) {
+	f, _ := newTestFile(t, 1024, 0, 0, 0)
+	defer f.Close()
+	line := strings.Repeat("x", 99) + "\n"
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				f.Write([]byte(line))
+			}
+		}()
+	}
+	wg.Wait()
+
+	lines := 0
+	for _, path := range append(backups(f), f.path) {
+		for _, written := range strings.SplitAfter(read(t, path), "\n") {
+			if written == "" {
+				continue
+			}
+			assert.Equal(t, line, written)
+			lines++
+		}
+	}
+	assert.Equal(t, 500, lines)
+}
@@ -0,0 +1,84 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/template"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	FormatCLF  = "clf"
+	FormatJSON = "json"
+)
+
+// Entry describes a served request in the access log. Durations are in seconds
+type Entry struct {
+	Time            time.Time `json:"time"`
+	Client          string    `json:"client"`
+	User            string    `json:"user"`
+	Host            string    `json:"host"`
+	Method          string    `json:"method"`
+	Upstream        string    `json:"upstream"`
+	URI             string    `json:"uri"`
+	Proto           string    `json:"proto"`
+	UserAgent       string    `json:"user_agent"`
+	Status          int       `json:"status"`
+	Size            int       `json:"size"`
+	Duration        float64   `json:"duration"`
+	UpstreamLatency float64   `json:"upstream_latency"`
+	RequestID       string    `json:"request_id"`
+	Roles           []string  `json:"roles"`
+	ProjectCount    int       `json:"project_count"`
+	AuthMethod      string    `json:"auth_method"`
+	Action          string    `json:"action"`
+	Indices         []string  `json:"indices"`
+
+	//clfUsername is the user given in the CLF line which is only known from the request URL
+	clfUsername string
+}
+
+// Formatter returns the access log line of an entry
+type Formatter func(entry *Entry) []byte
+
+// NewFormatter returns the formatter of the given format which is clf, json or a
+// text/template executed with an Entry (i.e. '{{.User}} {{.Method}} {{.URI}} {{.Status}}')
+func NewFormatter(format string) (Formatter, error) {
+	switch format {
+	case "", FormatCLF:
+		return buildLogLine, nil
+	case FormatJSON:
+		return formatJSON, nil
+	}
+	tmpl, err := template.New("request-logging-format").Parse(format)
+	if err != nil {
+		return nil, err
+	}
+	// fail on fields that are not part of an entry now rather than on every request
+	if err := tmpl.Execute(io.Discard, &Entry{}); err != nil {
+		return nil, err
+	}
+	return func(entry *Entry) []byte {
+		out := &bytes.Buffer{}
+		if err := tmpl.Execute(out, entry); err != nil {
+			log.Errorf("Unable to format the access log entry: %v", err)
+		}
+		if out.Len() == 0 || out.Bytes()[out.Len()-1] != '\n' {
+			out.WriteByte('\n')
+		}
+		return out.Bytes()
+	}, nil
+}
+
+func formatJSON(entry *Entry) []byte {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		log.Errorf("Unable to marshal the access log entry: %v", err)
+		return []byte(fmt.Sprintf("{\"uri\":%q}\n", entry.URI))
+	}
+	return append(b, '\n')
+}
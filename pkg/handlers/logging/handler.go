@@ -1,5 +1,5 @@
 // largely adapted from https://github.com/gorilla/handlers/blob/master/handlers.go
-// to add logging of request duration as last value (and drop referrer)
+// to add logging of request duration and request ID as last values (and drop referrer)
 
 package logging
 
@@ -10,16 +10,19 @@ import (
 	"net/http"
 	"net/url"
 	"time"
+
+	"github.com/openshift/elasticsearch-proxy/pkg/handlers"
 )
 
 // responseLogger is wrapper of http.ResponseWriter that keeps track of its HTTP status
 // code and body size
 type responseLogger struct {
-	w        http.ResponseWriter
-	status   int
-	size     int
-	upstream string
-	authInfo string
+	w         http.ResponseWriter
+	status    int
+	size      int
+	upstream  string
+	authInfo  string
+	requestID string
 }
 
 func (l *responseLogger) Header() http.Header {
@@ -37,6 +40,9 @@ func (l *responseLogger) ExtractGAPMetadata() {
 		l.authInfo = authInfo
 		l.w.Header().Del("GAP-Auth")
 	}
+	if requestID := l.w.Header().Get(handlers.RequestIDHeader); requestID != "" {
+		l.requestID = requestID
+	}
 }
 
 func (l *responseLogger) Write(b []byte) (int, error) {
@@ -69,64 +75,109 @@ type loggingHandler struct {
 	writer  io.Writer
 	handler http.Handler
 	enabled bool
+	format  Formatter
 }
 
-func NewHandler(out io.Writer, h http.Handler, v bool) http.Handler {
-	return loggingHandler{out, h, v}
+// NewHandler returns a handler writing an entry in the given format to out for each request
+// served by h when v is true
+func NewHandler(out io.Writer, h http.Handler, v bool, format Formatter) http.Handler {
+	return loggingHandler{out, h, v, format}
 }
 
 func (h loggingHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	t := time.Now()
 	url := *req.URL
+	req, info := handlers.WithRequestInfo(req)
 	logger := &responseLogger{w: w}
 	h.handler.ServeHTTP(logger, req)
 	if !h.enabled {
 		return
 	}
-	logLine := buildLogLine(logger.authInfo, logger.upstream, req, url, t, logger.Status(), logger.Size())
-	h.writer.Write(logLine)
+	h.writer.Write(h.format(newEntry(logger, info, req, url, t)))
 }
 
-// Log entry for req similar to Apache Common Log Format.
-// ts is the timestamp with which the entry should be logged.
-// status, size are used to provide the response HTTP status and size.
-func buildLogLine(username, upstream string, req *http.Request, url url.URL, ts time.Time, status int, size int) []byte {
-	if username == "" {
-		username = "-"
-	}
-	if upstream == "" {
-		upstream = "-"
-	}
-	if url.User != nil && username == "-" {
-		if name := url.User.Username(); name != "" {
-			username = name
-		}
+// newEntry describes the request served at ts using what was learned about it while it was served
+func newEntry(logger *responseLogger, info *handlers.RequestInfo, req *http.Request, url url.URL, ts time.Time) *Entry {
+	username := logger.authInfo
+	if url.User != nil && username == "" {
+		username = url.User.Username()
 	}
 
 	client := req.Header.Get("X-Real-IP")
 	if client == "" {
 		client = req.RemoteAddr
 	}
-
 	if c, _, err := net.SplitHostPort(client); err == nil {
 		client = c
 	}
 
-	duration := float64(time.Now().Sub(ts)) / float64(time.Second)
+	entry := &Entry{
+		Time:            ts,
+		Client:          client,
+		User:            info.User,
+		Host:            req.Host,
+		Method:          req.Method,
+		Upstream:        logger.upstream,
+		URI:             url.RequestURI(),
+		Proto:           req.Proto,
+		UserAgent:       req.UserAgent(),
+		Status:          logger.Status(),
+		Size:            logger.Size(),
+		Duration:        float64(time.Now().Sub(ts)) / float64(time.Second),
+		UpstreamLatency: float64(info.UpstreamLatency) / float64(time.Second),
+		RequestID:       info.RequestID,
+		Roles:           info.Roles,
+		ProjectCount:    info.ProjectCount,
+		AuthMethod:      info.AuthMethod,
+		Action:          info.Action,
+		Indices:         info.Indices,
+		clfUsername:     username,
+	}
+	if entry.User == "" {
+		entry.User = username
+	}
+	if entry.RequestID == "" {
+		entry.RequestID = logger.requestID
+	}
+	if entry.Roles == nil {
+		entry.Roles = []string{}
+	}
+	if entry.Indices == nil {
+		entry.Indices = []string{}
+	}
+	return entry
+}
+
+// Log entry for req similar to Apache Common Log Format.
+// The entry gives the timestamp, the response HTTP status and size.
+func buildLogLine(entry *Entry) []byte {
+	username := entry.clfUsername
+	if username == "" {
+		username = "-"
+	}
+	requestID := entry.RequestID
+	if requestID == "" {
+		requestID = "-"
+	}
+	upstream := entry.Upstream
+	if upstream == "" {
+		upstream = "-"
+	}
 
-	logLine := fmt.Sprintf("%s - %s [%s] %s %s %s %q %s %q %d %d %0.3f\n",
-		client,
+	logLine := fmt.Sprintf("%s - %s [%s] %s %s %s %q %s %q %d %d %0.3f %s\n",
+		entry.Client,
 		username,
-		ts.Format("02/Jan/2006:15:04:05 -0700"),
-		req.Host,
-		req.Method,
+		entry.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		entry.Host,
+		entry.Method,
 		upstream,
-		url.RequestURI(),
-		req.Proto,
-		req.UserAgent(),
-		status,
-		size,
-		duration,
+		entry.URI,
+		entry.Proto,
+		entry.UserAgent,
+		entry.Status,
+		entry.Size,
+		entry.Duration,
+		requestID,
 	)
 	return []byte(logLine)
 }
@@ -0,0 +1,74 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/bmizerany/assert"
+
+	"github.com/openshift/elasticsearch-proxy/pkg/apis"
+	"github.com/openshift/elasticsearch-proxy/pkg/handlers"
+)
+
+// serve logs a request served by a handler which authenticates jdoe like the proxy
+func serve(t *testing.T, format string) string {
+	formatter, err := NewFormatter(format)
+	assert.Equal(t, nil, err)
+	out := &bytes.Buffer{}
+	proxy := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		ctx := context.WithValue(req.Context(), handlers.RequestIDKey, "abc123")
+		ctx = context.WithValue(ctx, handlers.UsernameKey, "jdoe")
+		ctx = context.WithValue(ctx, handlers.AuthMethodKey, handlers.AuthMethodToken)
+		ctx = context.WithValue(ctx, handlers.RolesKey, []string{"project_user"})
+		ctx = context.WithValue(ctx, handlers.ProjectsKey, []apis.Project{{Name: "foo"}, {Name: "bar"}})
+		ctx = handlers.WithESRequest(req.WithContext(ctx)).Context()
+		info := handlers.RequestInfoFrom(ctx)
+		info.Update(ctx)
+		info.UpstreamLatency = 250 * time.Millisecond
+		rw.WriteHeader(http.StatusCreated)
+		_, _ = rw.Write([]byte("hello"))
+	})
+	req := httptest.NewRequest("GET", "/foo/_search?size=1", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	NewHandler(out, proxy, true, formatter).ServeHTTP(httptest.NewRecorder(), req)
+	return out.String()
+}
+
+func TestCLFFormat(t *testing.T) {
+	line := serve(t, FormatCLF)
+	pattern := `^10\.0\.0\.1 - - \[.+\] example\.com GET - "/foo/_search\?size=1" HTTP/1\.1 "" 201 5 \d+\.\d{3} abc123\n$`
+	assert.Equal(t, true, regexp.MustCompile(pattern).MatchString(line), line)
+}
+
+func TestJSONFormat(t *testing.T) {
+	entry := map[string]interface{}{}
+	assert.Equal(t, nil, json.Unmarshal([]byte(serve(t, FormatJSON)), &entry))
+	assert.Equal(t, "jdoe", entry["user"])
+	assert.Equal(t, "abc123", entry["request_id"])
+	assert.Equal(t, "token", entry["auth_method"])
+	assert.Equal(t, []interface{}{"project_user"}, entry["roles"])
+	assert.Equal(t, float64(2), entry["project_count"])
+	assert.Equal(t, "search", entry["action"])
+	assert.Equal(t, []interface{}{"foo"}, entry["indices"])
+	assert.Equal(t, 0.25, entry["upstream_latency"])
+	assert.Equal(t, float64(201), entry["status"])
+	assert.Equal(t, "/foo/_search?size=1", entry["uri"])
+}
+
+func TestTemplateFormat(t *testing.T) {
+	assert.Equal(t, "jdoe GET /foo/_search?size=1 201 [project_user]\n", serve(t, "{{.User}} {{.Method}} {{.URI}} {{.Status}} {{.Roles}}"))
+	assert.Equal(t, "jdoe search [foo]\n", serve(t, "{{.User}} {{.Action}} {{.Indices}}"))
+}
+
+func TestInvalidTemplateFormat(t *testing.T) {
+	_, err := NewFormatter("{{.Unknown}}")
+	assert.NotEqual(t, nil, err)
+	_, err = NewFormatter("{{.User")
+	assert.NotEqual(t, nil, err)
+}
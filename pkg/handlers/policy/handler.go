@@ -0,0 +1,168 @@
+package policy
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/openshift/elasticsearch-proxy/pkg/config"
+	"github.com/openshift/elasticsearch-proxy/pkg/elasticsearch"
+	"github.com/openshift/elasticsearch-proxy/pkg/handlers"
+)
+
+const (
+	//defaultRule labels the denials of requests matching no rule
+	defaultRule = "default"
+)
+
+type policyHandler struct {
+	//lock guards policy which is replaced on Reload
+	lock   sync.RWMutex
+	policy *config.AccessPolicy
+
+	deniedTotal *prometheus.CounterVec
+}
+
+// NewHandlers is the initializer for this handler. No handler is returned when an
+// access policy is not configured
+func NewHandlers(opts *config.Options) []handlers.RequestHandler {
+	if opts.AuthPolicy == nil {
+		return []handlers.RequestHandler{}
+	}
+	return []handlers.RequestHandler{newPolicyHandler(opts.AuthPolicy, prometheus.DefaultRegisterer)}
+}
+
+func newPolicyHandler(policy *config.AccessPolicy, reg prometheus.Registerer) *policyHandler {
+	return &policyHandler{
+		policy: policy,
+		deniedTotal: promauto.With(reg).NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "access_policy_denied_requests_total",
+				Help: "Tracks the number of requests denied by the access policy by rule.",
+			}, []string{"rule"},
+		),
+	}
+}
+
+func (h *policyHandler) Name() string {
+	return "policy"
+}
+
+// Reload replaces the access policy with the one of the given options. Removing the
+// access policy file requires a restart
+func (h *policyHandler) Reload(opts *config.Options) error {
+	if opts.AuthPolicy == nil {
+		log.Warn("Keeping the access policy as auth-policy-file can not be removed without a restart")
+		return nil
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.policy = opts.AuthPolicy
+	log.Infof("Reloaded the access policy with %d rules", len(opts.AuthPolicy.Rules))
+	return nil
+}
+
+func (h *policyHandler) currentPolicy() *config.AccessPolicy {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	return h.policy
+}
+
+// Process allows or denies the request by the first rule of the policy matching the
+// roles of the user and the method and path of the request
+func (h *policyHandler) Process(req *http.Request) (*http.Request, error) {
+	logger := handlers.Logger(req.Context())
+	policy := h.currentPolicy()
+	roles, _ := req.Context().Value(handlers.RolesKey).([]string)
+	action := ""
+	if esRequest := handlers.ESRequest(req.Context()); esRequest != nil {
+		action = string(esRequest.Action)
+	}
+	segments := elasticsearch.SplitPath(req.URL.EscapedPath())
+
+	rule, effect := defaultRule, policy.Default
+	for _, candidate := range policy.Rules {
+		if matches(&candidate, roles, req.Method, action, segments) {
+			rule, effect = candidate.Name, candidate.Effect
+			break
+		}
+	}
+	if effect == config.PolicyEffectAllow {
+		logger.Tracef("Access policy rule %q allowed %s %s", rule, req.Method, req.URL.Path)
+		return req, nil
+	}
+	logger.Debugf("Access policy rule %q denied %s %s", rule, req.Method, req.URL.Path)
+	h.deniedTotal.WithLabelValues(rule).Inc()
+	return req, handlers.NewError("403", fmt.Sprintf("Forbidden by the access policy rule %s", rule))
+}
+
+// matches returns true when every condition the rule defines holds for the request
+func matches(rule *config.AccessRule, roles []string, method, action string, segments []string) bool {
+	if len(rule.Roles) > 0 && !containsAny(rule.Roles, roles) {
+		return false
+	}
+	if len(rule.Methods) > 0 && !containsFold(rule.Methods, method) {
+		return false
+	}
+	if len(rule.Actions) > 0 && !containsFold(rule.Actions, action) {
+		return false
+	}
+	if len(rule.Paths) == 0 {
+		return true
+	}
+	for _, pattern := range rule.Paths {
+		if matchSegments(elasticsearch.SplitPath(pattern), segments) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAny(values, candidates []string) bool {
+	for _, candidate := range candidates {
+		for _, value := range values {
+			if value == candidate {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func containsFold(values []string, candidate string) bool {
+	for _, value := range values {
+		if value == "*" || strings.EqualFold(value, candidate) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchSegments matches the segments of a path against those of a pattern where **
+// matches any number of segments and other segments are matched by path.Match
+func matchSegments(pattern, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchSegments(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	if matched, _ := path.Match(pattern[0], segments[0]); !matched {
+		return false
+	}
+	return matchSegments(pattern[1:], segments[1:])
+}
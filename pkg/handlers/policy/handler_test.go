@@ -0,0 +1,99 @@
+package policy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/openshift/elasticsearch-proxy/pkg/config"
+	"github.com/openshift/elasticsearch-proxy/pkg/handlers"
+)
+
+var _ = Describe("Process", func() {
+
+	var (
+		handler *policyHandler
+
+		process = func(method, path string, roles ...string) error {
+			req := httptest.NewRequest(method, path, nil)
+			req = req.WithContext(context.WithValue(req.Context(), handlers.RolesKey, roles))
+			_, err := handler.Process(handlers.WithESRequest(req))
+			return err
+		}
+	)
+
+	BeforeEach(func() {
+		handler = newPolicyHandler(&config.AccessPolicy{
+			Default: config.PolicyEffectAllow,
+			Rules: []config.AccessRule{
+				{Name: "admin", Effect: config.PolicyEffectAllow, Roles: []string{"admin_reader"}},
+				{Name: "cluster-settings", Effect: config.PolicyEffectDeny, Methods: []string{"PUT"}, Paths: []string{"/_cluster/settings"}},
+				{Name: "snapshots", Effect: config.PolicyEffectDeny, Paths: []string{"/_snapshot/**"}},
+				{Name: "hot-threads", Effect: config.PolicyEffectDeny, Paths: []string{"/_nodes/hot_threads", "/_nodes/*/hot_threads"}},
+				{Name: "security", Effect: config.PolicyEffectDeny, Actions: []string{"cluster_admin"}},
+			},
+		}, prometheus.NewRegistry())
+	})
+
+	It("should allow requests matching no rule by default", func() {
+		Expect(process("GET", "/app-foo/_search", "project_user")).To(Succeed())
+		Expect(process("GET", "/_cluster/settings", "project_user")).To(Succeed())
+	})
+
+	It("should deny requests matching the method and path of a deny rule", func() {
+		err := process("PUT", "/_cluster/settings", "project_user")
+		Expect(err).To(HaveOccurred())
+		structured := handlers.NewStructuredError(err)
+		Expect(structured.Code).To(Equal(http.StatusForbidden))
+		Expect(structured.Message).To(Equal("Forbidden by the access policy rule cluster-settings"))
+	})
+
+	It("should match any number of segments with **", func() {
+		Expect(process("GET", "/_snapshot", "project_user")).To(HaveOccurred())
+		Expect(process("PUT", "/_snapshot/backup/snapshot_1", "project_user")).To(HaveOccurred())
+	})
+
+	It("should match a single segment with *", func() {
+		Expect(process("GET", "/_nodes/hot_threads", "project_user")).To(HaveOccurred())
+		Expect(process("GET", "/_nodes/node-1/hot_threads", "project_user")).To(HaveOccurred())
+		Expect(process("GET", "/_nodes/node-1/stats", "project_user")).To(Succeed())
+	})
+
+	It("should normalize empty segments of the path", func() {
+		Expect(process("PUT", "//_cluster//settings/", "project_user")).To(HaveOccurred())
+	})
+
+	It("should match the classified action", func() {
+		Expect(process("GET", "/_plugins/_security/api/roles", "project_user")).To(HaveOccurred())
+	})
+
+	It("should decide by the first matching rule", func() {
+		Expect(process("PUT", "/_cluster/settings", "admin_reader")).To(Succeed())
+		Expect(process("DELETE", "/_snapshot/backup", "project_user", "admin_reader")).To(Succeed())
+	})
+
+	It("should deny requests matching no rule when the default is deny", func() {
+		handler.policy.Default = config.PolicyEffectDeny
+		err := process("GET", "/app-foo/_search", "project_user")
+		Expect(handlers.NewStructuredError(err).Message).To(Equal("Forbidden by the access policy rule default"))
+	})
+
+	It("should count the denials by rule", func() {
+		_ = process("PUT", "/_cluster/settings", "project_user")
+		_ = process("PUT", "/_cluster/settings", "project_user")
+		_ = process("GET", "/_snapshot", "project_user")
+		_ = process("GET", "/app-foo/_search", "project_user")
+		Expect(testutil.ToFloat64(handler.deniedTotal.WithLabelValues("cluster-settings"))).To(Equal(float64(2)))
+		Expect(testutil.ToFloat64(handler.deniedTotal.WithLabelValues("snapshots"))).To(Equal(float64(1)))
+	})
+
+	It("should replace the policy on reload", func() {
+		Expect(handler.Reload(&config.Options{AuthPolicy: &config.AccessPolicy{Default: config.PolicyEffectDeny}})).To(Succeed())
+		Expect(process("GET", "/app-foo/_search", "admin_reader")).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/openshift/elasticsearch-proxy/pkg/apis"
+	"github.com/openshift/elasticsearch-proxy/pkg/elasticsearch"
+)
+
+const (
+	RequestInfoKey ContextKey = "requestInfo"
+	AuthMethodKey  ContextKey = "authMethod"
+	ESRequestKey   ContextKey = "esRequest"
+
+	AuthMethodToken       = "token"
+	AuthMethodCertificate = "certificate"
+)
+
+// RequestInfo collects what is learned about a request while it is served so it can be
+// given in the access log by the handler wrapping the proxy. It is only used by the
+// goroutine serving the request
+type RequestInfo struct {
+	RequestID    string
+	User         string
+	AuthMethod   string
+	Roles        []string
+	ProjectCount int
+	//Action and Indices are the classification of the Elasticsearch request
+	Action  string
+	Indices []string
+	//UpstreamLatency is the duration until the response headers were received from upstream
+	UpstreamLatency time.Duration
+}
+
+// WithRequestInfo returns the request with an empty RequestInfo stored in its context
+func WithRequestInfo(req *http.Request) (*http.Request, *RequestInfo) {
+	info := &RequestInfo{}
+	return req.WithContext(context.WithValue(req.Context(), RequestInfoKey, info)), info
+}
+
+// RequestInfoFrom returns the RequestInfo of the context or nil if there is none
+func RequestInfoFrom(ctx context.Context) *RequestInfo {
+	info, _ := ctx.Value(RequestInfoKey).(*RequestInfo)
+	return info
+}
+
+// Update copies the identity of the request stored in the context by the request handlers
+func (i *RequestInfo) Update(ctx context.Context) {
+	if i == nil {
+		return
+	}
+	if id, ok := ctx.Value(RequestIDKey).(string); ok {
+		i.RequestID = id
+	}
+	if username, ok := ctx.Value(UsernameKey).(string); ok && username != "" {
+		i.User = username
+	} else if subject, ok := ctx.Value(SubjectKey).(string); ok {
+		i.User = subject
+	}
+	if method, ok := ctx.Value(AuthMethodKey).(string); ok {
+		i.AuthMethod = method
+	}
+	if roles, ok := ctx.Value(RolesKey).([]string); ok {
+		i.Roles = roles
+	}
+	if projects, ok := ctx.Value(ProjectsKey).([]apis.Project); ok {
+		i.ProjectCount = len(projects)
+	}
+	if esRequest := ESRequest(ctx); esRequest != nil {
+		i.Action = string(esRequest.Action)
+		i.Indices = esRequest.Indices
+	}
+}
+
+// WithESRequest returns the request with its Elasticsearch classification stored in its context
+func WithESRequest(req *http.Request) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), ESRequestKey, elasticsearch.Classify(req)))
+}
+
+// ESRequest returns the classification of the Elasticsearch request stored in the context
+// or nil if there is none
+func ESRequest(ctx context.Context) *elasticsearch.Request {
+	esRequest, _ := ctx.Value(ESRequestKey).(*elasticsearch.Request)
+	return esRequest
+}
+
+// WithTargets returns a copy of the request for the targets which replace those given in its path,
+// or are added to its path when none are given, in the segment the API takes them from. The
+// classification of the request is updated
+func WithTargets(req *http.Request, targets []string) *http.Request {
+	esRequest := ESRequest(req.Context())
+	escaped := make([]string, len(targets))
+	for i, target := range targets {
+		// wildcards are valid in a path and kept readable as they are given by clients
+		escaped[i] = strings.ReplaceAll(url.PathEscape(target), "%2A", "*")
+	}
+	segments := []string{}
+	for _, segment := range strings.Split(req.URL.EscapedPath(), "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	position := esRequest.TargetSegment()
+	if len(esRequest.Indices) > 0 {
+		segments[position] = strings.Join(escaped, ",")
+	} else {
+		segments = append(segments[:position], append([]string{strings.Join(escaped, ",")}, segments[position:]...)...)
+	}
+
+	rewritten := *esRequest
+	rewritten.Indices = targets
+	req = req.Clone(context.WithValue(req.Context(), ESRequestKey, &rewritten))
+	req.URL.RawPath = "/" + strings.Join(segments, "/")
+	if path, err := url.PathUnescape(req.URL.RawPath); err == nil {
+		req.URL.Path = path
+	}
+	// the request is proxied to its RequestURI to keep encoded slashes of the path
+	req.RequestURI = req.URL.RequestURI()
+	return req
+}
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+)
+
+const (
+	ResponseModifiersKey ContextKey = "responseModifiers"
+
+	filterPathParam = "filter_path"
+)
+
+// ResponseModifier changes the response of Elasticsearch to a request before it is given
+// to the client
+type ResponseModifier func(resp *http.Response) error
+
+// WithResponseModifier returns the request with the modifier added to those applied to
+// its response
+func WithResponseModifier(req *http.Request, modifier ResponseModifier) *http.Request {
+	current, _ := req.Context().Value(ResponseModifiersKey).([]ResponseModifier)
+	modifiers := make([]ResponseModifier, 0, len(current)+1)
+	modifiers = append(append(modifiers, current...), modifier)
+	return req.WithContext(context.WithValue(req.Context(), ResponseModifiersKey, modifiers))
+}
+
+// ModifyResponse applies the modifiers stored in the context of the request of the response
+// in the order they were added
+func ModifyResponse(resp *http.Response) error {
+	if resp.Request == nil {
+		return nil
+	}
+	modifiers, _ := resp.Request.Context().Value(ResponseModifiersKey).([]ResponseModifier)
+	for _, modifier := range modifiers {
+		if err := modifier(resp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RequestBodyError is returned while the body of a request is sent to Elasticsearch when a
+// request handler rejects the request given its body. The request is not completed and the
+// error is given to the client instead of the response of Elasticsearch
+type RequestBodyError struct {
+	Err error
+}
+
+func (e *RequestBodyError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RequestBodyError) Unwrap() error {
+	return e.Err
+}
+
+// WithInspectedBody returns a copy of the request with the body, which removes denied parts of the
+// body of the request as it is read, and the modifier answering them in the response. The length of
+// the body is not known until it is read and the response is read so it must not be compressed and
+// have the response to every part
+func WithInspectedBody(req *http.Request, body io.ReadCloser, modifier ResponseModifier) *http.Request {
+	req = req.Clone(req.Context())
+	req.Body = body
+	req.ContentLength = -1
+	req.Header.Del("Content-Length")
+	req.Header.Del("Accept-Encoding")
+	if query := req.URL.Query(); query.Get(filterPathParam) != "" {
+		query.Del(filterPathParam)
+		req.URL.RawQuery = query.Encode()
+		// the request is proxied to its RequestURI to keep encoded slashes of the path
+		req.RequestURI = req.URL.RequestURI()
+	}
+	return WithResponseModifier(req, modifier)
+}
+
+// ErrorCause is the type and reason of an error as given by Elasticsearch
+type ErrorCause struct {
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+}
+
+// SecurityException returns the cause of the errors of Elasticsearch denying a request
+func SecurityException(reason string) ErrorCause {
+	return ErrorCause{Type: "security_exception", Reason: reason}
+}
+
+// deniedPart is a part removed from a request which is answered with its result
+type deniedPart struct {
+	//position is that of the part in the request
+	position int
+	result   json.RawMessage
+}
+
+// MergedResponse answers the parts of a request, i.e. the actions of a bulk request or the searches
+// of a multi search, which are removed from its body as it is sent to Elasticsearch. Their results
+// are added to the responses of the other parts in the order of the request so they align with the
+// parts of the request
+type MergedResponse struct {
+	//name of the request in errors, i.e. bulk
+	name string
+	//key of the responses to the parts in the body of the response, i.e. items
+	key string
+	//fields are set in the body of the response when parts are denied, i.e. errors
+	fields map[string]json.RawMessage
+
+	//parts is the number of parts read, forwarded those sent to Elasticsearch
+	parts     int
+	forwarded int
+	denied    []deniedPart
+}
+
+func NewMergedResponse(name, key string, fields map[string]json.RawMessage) *MergedResponse {
+	return &MergedResponse{name: name, key: key, fields: fields}
+}
+
+// Forward counts the next part as sent to Elasticsearch
+func (m *MergedResponse) Forward() {
+	m.parts++
+	m.forwarded++
+}
+
+// Deny counts the next part as removed from the request and answered with the result
+func (m *MergedResponse) Deny(result json.RawMessage) {
+	m.denied = append(m.denied, deniedPart{position: m.parts, result: result})
+	m.parts++
+}
+
+// ModifyResponse adds the results of the denied parts to the responses of Elasticsearch. Elasticsearch
+// is given no part when every part is denied so its response is replaced
+func (m *MergedResponse) ModifyResponse(resp *http.Response) error {
+	if len(m.denied) == 0 {
+		return nil
+	}
+	body := map[string]json.RawMessage{}
+	responses := []json.RawMessage{}
+	if m.forwarded == 0 {
+		resp.Body.Close()
+		body["took"] = json.RawMessage("0")
+		resp.StatusCode = http.StatusOK
+		resp.Status = fmt.Sprintf("%d %s", http.StatusOK, http.StatusText(http.StatusOK))
+		resp.Header.Del("Content-Encoding")
+		resp.Header.Set("Content-Type", "application/json")
+	} else {
+		if resp.StatusCode != http.StatusOK {
+			return nil
+		}
+		data, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(data, &body); err != nil {
+			return fmt.Errorf("unable to parse the %s response: %v", m.name, err)
+		}
+		if err := json.Unmarshal(body[m.key], &responses); err != nil || len(responses) != m.forwarded {
+			return fmt.Errorf("the %s response has %d %s instead of %d", m.name, len(responses), m.key, m.forwarded)
+		}
+	}
+	merged := make([]json.RawMessage, 0, m.parts)
+	for _, part := range m.denied {
+		for len(merged) < part.position {
+			merged = append(merged, responses[0])
+			responses = responses[1:]
+		}
+		merged = append(merged, part.result)
+	}
+	merged = append(merged, responses...)
+
+	for name, value := range m.fields {
+		body[name] = value
+	}
+	body[m.key], _ = json.Marshal(merged)
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(data))
+	resp.ContentLength = int64(len(data))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(data)))
+	return nil
+}
@@ -25,9 +25,10 @@ type Options struct {
 }
 
 type StructuredError struct {
-	Code    int    `json:"code,omitempty"`
-	Message string `json:"message,omitempty"`
-	Error   error  `json:"error,omitempty"`
+	Code      int    `json:"code,omitempty"`
+	Message   string `json:"message,omitempty"`
+	Error     error  `json:"error,omitempty"`
+	RequestID string `json:"requestId,omitempty"`
 }
 
 // NewError returns an error with a code and message that can be returned
@@ -54,9 +55,9 @@ func NewStructuredError(err error) StructuredError {
 		}
 	}
 	return StructuredError{
-		code,
-		message,
-		err,
+		Code:    code,
+		Message: message,
+		Error:   err,
 	}
 }
 
@@ -68,3 +69,32 @@ type RequestHandler interface {
 	//Name of the request handler
 	Name() string
 }
+
+// ReloadableHandler is a RequestHandler whose configuration can be replaced
+// while the proxy is running
+type ReloadableHandler interface {
+	RequestHandler
+	//Reload applies the given options to the handler
+	Reload(opts *config.Options) error
+}
+
+// CachedIdentity describes an identity cached by a request handler. It
+// never includes the credentials of the identity
+type CachedIdentity struct {
+	Username     string   `json:"username"`
+	Roles        []string `json:"roles"`
+	ProjectCount int      `json:"projectCount"`
+	Age          string   `json:"age"`
+}
+
+// IdentityCache is a RequestHandler which caches identities that can be
+// inspected and evicted by an administrator
+type IdentityCache interface {
+	RequestHandler
+	//CachedIdentities returns the identities currently cached
+	CachedIdentities() []CachedIdentity
+	//EvictUser removes the cached identities of a user and returns the number removed
+	EvictUser(username string) int
+	//FlushCache removes every cached identity and returns the number removed
+	FlushCache() int
+}
@@ -0,0 +1,197 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/bluele/gcache"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/openshift/elasticsearch-proxy/pkg/apis"
+	"github.com/openshift/elasticsearch-proxy/pkg/config"
+	"github.com/openshift/elasticsearch-proxy/pkg/handlers"
+	"github.com/openshift/elasticsearch-proxy/pkg/util"
+)
+
+const (
+	cacheSize = 1000
+)
+
+// Review is the description of a request POSTed to the webhook
+type Review struct {
+	Method   string   `json:"method"`
+	Path     string   `json:"path"`
+	Query    string   `json:"query,omitempty"`
+	Indices  []string `json:"indices,omitempty"`
+	Identity Identity `json:"identity"`
+}
+
+// Identity of the user making the request as determined by the authorization handler
+type Identity struct {
+	Username string   `json:"username,omitempty"`
+	Subject  string   `json:"subject,omitempty"`
+	Roles    []string `json:"roles,omitempty"`
+	Projects []string `json:"projects,omitempty"`
+}
+
+// Decision is the response of the webhook to a Review
+type Decision struct {
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason,omitempty"`
+	//Headers are added to an allowed request before it is proxied
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+type webhookHandler struct {
+	url      string
+	client   *http.Client
+	failOpen bool
+	cache    gcache.Cache
+}
+
+// NewHandlers is the initializer for this handler. No handler is returned when
+// a webhook URL is not configured
+func NewHandlers(opts *config.Options) []handlers.RequestHandler {
+	if opts.AuthWebhookURL == "" {
+		return []handlers.RequestHandler{}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if len(opts.AuthWebhookCAs) > 0 {
+		pool, err := util.GetCertPool(opts.AuthWebhookCAs, false)
+		if err != nil {
+			log.Fatalf("Error loading auth webhook CAs %v", err)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+	return []handlers.RequestHandler{
+		newWebhookHandler(opts, &http.Client{Transport: transport, Timeout: opts.AuthWebhookTimeout}),
+	}
+}
+
+func newWebhookHandler(opts *config.Options, client *http.Client) *webhookHandler {
+	handler := &webhookHandler{
+		url:      opts.AuthWebhookURL,
+		client:   client,
+		failOpen: opts.AuthWebhookFailOpen,
+	}
+	if opts.AuthWebhookCacheExpiry > 0 {
+		handler.cache = gcache.New(cacheSize).
+			LRU().
+			Expiration(opts.AuthWebhookCacheExpiry).
+			Build()
+	}
+	return handler
+}
+
+func (h *webhookHandler) Name() string {
+	return "webhook"
+}
+
+// Process asks the webhook for a decision on the request. Denied requests are rejected and
+// allowed requests receive the headers of the decision. Requests are rejected, or allowed when
+// failing open, if a decision can not be made
+func (h *webhookHandler) Process(req *http.Request) (*http.Request, error) {
+	logger := handlers.Logger(req.Context())
+	logger.Tracef("Processing request in handler %q", h.Name())
+
+	review := newReview(req)
+	decision, err := h.decide(review)
+	if err != nil {
+		if h.failOpen {
+			logger.Warnf("Allowing request as the auth webhook failed to decide: %v", err)
+			return req, nil
+		}
+		logger.Errorf("Rejecting request as the auth webhook failed to decide: %v", err)
+		return req, handlers.NewError("503", "Unable to authorize the request")
+	}
+	if !decision.Allowed {
+		logger.Debugf("Auth webhook denied %s %s for %q: %s", review.Method, review.Path, review.Identity.Username, decision.Reason)
+		reason := decision.Reason
+		if reason == "" {
+			reason = "Forbidden"
+		}
+		return req, handlers.NewError("403", reason)
+	}
+	for name, value := range decision.Headers {
+		if handlers.IsIdentityHeader(name) {
+			logger.Warnf("Ignoring the header %s of the auth webhook decision which identifies the user", name)
+			continue
+		}
+		req.Header.Set(name, value)
+	}
+	return req, nil
+}
+
+func (h *webhookHandler) decide(review *Review) (*Decision, error) {
+	body, err := json.Marshal(review)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(body)
+	key := hex.EncodeToString(sum[:])
+	if h.cache != nil {
+		if cached, err := h.cache.Get(key); err == nil {
+			return cached.(*Decision), nil
+		}
+	}
+
+	resp, err := h.client.Post(h.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	decision := &Decision{}
+	if err := json.Unmarshal(data, decision); err != nil {
+		return nil, fmt.Errorf("unable to parse decision: %v", err)
+	}
+
+	if h.cache != nil {
+		_ = h.cache.Set(key, decision)
+	}
+	return decision, nil
+}
+
+// newReview describes the request using the identity stored in the context by the authorization handler
+func newReview(req *http.Request) *Review {
+	ctx := req.Context()
+	identity := Identity{}
+	if username, ok := ctx.Value(handlers.UsernameKey).(string); ok {
+		identity.Username = username
+	}
+	if subject, ok := ctx.Value(handlers.SubjectKey).(string); ok {
+		identity.Subject = subject
+	}
+	if roles, ok := ctx.Value(handlers.RolesKey).([]string); ok {
+		identity.Roles = roles
+	}
+	if projects, ok := ctx.Value(handlers.ProjectsKey).([]apis.Project); ok {
+		for _, project := range projects {
+			identity.Projects = append(identity.Projects, project.Name)
+		}
+	}
+	var indices []string
+	if esRequest := handlers.ESRequest(ctx); esRequest != nil {
+		indices = esRequest.Indices
+	}
+	return &Review{
+		Method:   req.Method,
+		Path:     req.URL.Path,
+		Query:    req.URL.RawQuery,
+		Indices:  indices,
+		Identity: identity,
+	}
+}
@@ -0,0 +1,201 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/openshift/elasticsearch-proxy/pkg/apis"
+	"github.com/openshift/elasticsearch-proxy/pkg/config"
+	"github.com/openshift/elasticsearch-proxy/pkg/handlers"
+)
+
+var _ = Describe("Process", func() {
+
+	var (
+		err      error
+		req      *http.Request
+		server   *httptest.Server
+		handler  *webhookHandler
+		opts     *config.Options
+		lock     sync.Mutex
+		reviews  []Review
+		decision *Decision
+		status   int
+		delay    time.Duration
+
+		newHandler = func() {
+			opts.AuthWebhookURL = server.URL
+			handler = newWebhookHandler(opts, &http.Client{Timeout: opts.AuthWebhookTimeout})
+		}
+		receivedReviews = func() []Review {
+			lock.Lock()
+			defer lock.Unlock()
+			return append([]Review{}, reviews...)
+		}
+	)
+
+	BeforeEach(func() {
+		reviews = nil
+		status = http.StatusOK
+		delay = 0
+		decision = &Decision{Allowed: true}
+		server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			review := Review{}
+			Expect(json.NewDecoder(r.Body).Decode(&review)).To(Succeed())
+			lock.Lock()
+			reviews = append(reviews, review)
+			lock.Unlock()
+			time.Sleep(delay)
+			rw.WriteHeader(status)
+			_ = json.NewEncoder(rw).Encode(decision)
+		}))
+		opts = &config.Options{
+			AuthWebhookTimeout:     time.Second,
+			AuthWebhookCacheExpiry: time.Minute,
+		}
+
+		req, _ = http.NewRequest("GET", "https://someplace/app-foo-*,infra-*/_search?size=1", nil)
+		ctx := context.WithValue(req.Context(), handlers.UsernameKey, "jdoe")
+		ctx = context.WithValue(ctx, handlers.RolesKey, []string{"project_user"})
+		ctx = context.WithValue(ctx, handlers.ProjectsKey, []apis.Project{{Name: "foo"}, {Name: "bar"}})
+		req = handlers.WithESRequest(req.WithContext(ctx))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should POST a description of the request", func() {
+		newHandler()
+		_, err = handler.Process(req)
+		Expect(err).To(BeNil())
+		Expect(receivedReviews()).To(Equal([]Review{
+			{
+				Method:  "GET",
+				Path:    "/app-foo-*,infra-*/_search",
+				Query:   "size=1",
+				Indices: []string{"app-foo-*", "infra-*"},
+				Identity: Identity{
+					Username: "jdoe",
+					Roles:    []string{"project_user"},
+					Projects: []string{"foo", "bar"},
+				},
+			},
+		}))
+	})
+
+	Context("when the webhook allows the request", func() {
+		It("should add the headers of the decision", func() {
+			decision.Headers = map[string]string{"X-Tenant": "foo"}
+			newHandler()
+			req, err = handler.Process(req)
+			Expect(err).To(BeNil())
+			Expect(req.Header.Get("X-Tenant")).To(Equal("foo"))
+		})
+		It("should not override the headers identifying the user", func() {
+			req.Header.Set("X-Forwarded-User", "jdoe")
+			decision.Headers = map[string]string{"x-forwarded-user": "admin", "X-Forwarded-Roles": "admin_reader", "X-OCP-NS": "\"other\"", "Authorization": "Bearer abc"}
+			newHandler()
+			req, err = handler.Process(req)
+			Expect(err).To(BeNil())
+			Expect(req.Header.Get("X-Forwarded-User")).To(Equal("jdoe"))
+			Expect(req.Header.Get("X-Forwarded-Roles")).To(BeEmpty())
+			Expect(req.Header.Get("X-OCP-NS")).To(BeEmpty())
+			Expect(req.Header.Get("Authorization")).To(BeEmpty())
+		})
+	})
+
+	Context("when the webhook denies the request", func() {
+		It("should return a forbidden error with the reason", func() {
+			decision = &Decision{Allowed: false, Reason: "infra indices are restricted"}
+			newHandler()
+			_, err = handler.Process(req)
+			Expect(err).To(Not(BeNil()))
+			structuredError := handlers.NewStructuredError(err)
+			Expect(structuredError.Code).To(Equal(http.StatusForbidden))
+			Expect(structuredError.Message).To(Equal("infra indices are restricted"))
+		})
+	})
+
+	Context("when caching decisions", func() {
+		It("should ask the webhook once for the same request", func() {
+			newHandler()
+			for i := 0; i < 3; i++ {
+				_, err = handler.Process(req)
+				Expect(err).To(BeNil())
+			}
+			Expect(receivedReviews()).To(HaveLen(1))
+		})
+		It("should ask the webhook for requests of other users", func() {
+			newHandler()
+			_, err = handler.Process(req)
+			Expect(err).To(BeNil())
+			_, err = handler.Process(req.WithContext(context.WithValue(req.Context(), handlers.UsernameKey, "other")))
+			Expect(err).To(BeNil())
+			Expect(receivedReviews()).To(HaveLen(2))
+		})
+		It("should not cache when disabled", func() {
+			opts.AuthWebhookCacheExpiry = 0
+			newHandler()
+			for i := 0; i < 3; i++ {
+				_, err = handler.Process(req)
+				Expect(err).To(BeNil())
+			}
+			Expect(receivedReviews()).To(HaveLen(3))
+		})
+		It("should not cache failures", func() {
+			status = http.StatusInternalServerError
+			newHandler()
+			_, err = handler.Process(req)
+			Expect(err).To(Not(BeNil()))
+			status = http.StatusOK
+			_, err = handler.Process(req)
+			Expect(err).To(BeNil())
+			Expect(receivedReviews()).To(HaveLen(2))
+		})
+	})
+
+	Context("when the webhook fails to decide", func() {
+		for _, failure := range []struct {
+			name  string
+			setup func()
+		}{
+			{"with an error response", func() { status = http.StatusInternalServerError }},
+			{"by timing out", func() {
+				delay = 200 * time.Millisecond
+				opts.AuthWebhookTimeout = 50 * time.Millisecond
+			}},
+		} {
+			failure := failure
+			Context(failure.name, func() {
+				BeforeEach(failure.setup)
+
+				It("should reject the request when failing closed", func() {
+					newHandler()
+					_, err = handler.Process(req)
+					Expect(err).To(Not(BeNil()))
+					Expect(handlers.NewStructuredError(err).Code).To(Equal(http.StatusServiceUnavailable))
+				})
+				It("should allow the request when failing open", func() {
+					opts.AuthWebhookFailOpen = true
+					newHandler()
+					_, err = handler.Process(req)
+					Expect(err).To(BeNil())
+				})
+			})
+		}
+	})
+})
+
+var _ = Describe("NewHandlers", func() {
+	It("should not return a handler without a webhook URL", func() {
+		Expect(NewHandlers(&config.Options{})).To(BeEmpty())
+	})
+})
@@ -0,0 +1,117 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/openshift/elasticsearch-proxy/pkg/handlers"
+)
+
+const (
+	adminCachePath      = "/_proxy/admin/cache"
+	adminCacheUsersPath = adminCachePath + "/users/"
+)
+
+type cacheResponse struct {
+	Identities []handlers.CachedIdentity `json:"identities,omitempty"`
+	Evicted    *int                      `json:"evicted,omitempty"`
+}
+
+// AdminHandler serves the admin API of the proxy in front of the given handler. Requests
+// to the admin API are authenticated by the request handlers and require the admin role:
+//
+//	GET    /_proxy/admin/cache                  lists the cached identities
+//	DELETE /_proxy/admin/cache                  evicts every cached identity
+//	DELETE /_proxy/admin/cache/users/<username> evicts the cached identities of a user
+//	GET    /_proxy/admin/loglevel               responds with the log level
+//	PUT    /_proxy/admin/loglevel               changes the log level for a bounded duration
+//	DELETE /_proxy/admin/loglevel               restores the log level
+func (p *ProxyServer) AdminHandler(next http.Handler) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/", next)
+	mux.HandleFunc(adminCachePath, p.withAdminRole(p.serveCache))
+	mux.HandleFunc(adminCacheUsersPath, p.withAdminRole(p.serveCacheUser))
+	if p.logLevel != nil {
+		mux.HandleFunc(adminLogLevelPath, p.withAdminRole(p.serveLogLevel))
+	}
+	return mux
+}
+
+// withAdminRole authenticates the request and only serves it when the user has the admin role
+func (p *ProxyServer) withAdminRole(fn http.HandlerFunc) http.HandlerFunc {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		req, ok := p.processRequest(rw, p.withRequestID(rw, req))
+		if !ok {
+			return
+		}
+		roles, _ := req.Context().Value(handlers.RolesKey).([]string)
+		for _, role := range roles {
+			if p.adminRole != "" && role == p.adminRole {
+				fn(rw, req)
+				return
+			}
+		}
+		handlers.Logger(req.Context()).Debugf("Denied admin request %s %s", req.Method, req.URL.Path)
+		p.StructuredError(rw, handlers.NewError("403", "Forbidden"))
+	}
+}
+
+func (p *ProxyServer) serveCache(rw http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		identities := []handlers.CachedIdentity{}
+		for _, cache := range p.identityCaches() {
+			identities = append(identities, cache.CachedIdentities()...)
+		}
+		p.writeJSON(rw, cacheResponse{Identities: identities})
+	case http.MethodDelete:
+		evicted := 0
+		for _, cache := range p.identityCaches() {
+			evicted += cache.FlushCache()
+		}
+		p.writeJSON(rw, cacheResponse{Evicted: &evicted})
+	default:
+		p.StructuredError(rw, handlers.NewError("405", "Method Not Allowed"))
+	}
+}
+
+func (p *ProxyServer) serveCacheUser(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodDelete {
+		p.StructuredError(rw, handlers.NewError("405", "Method Not Allowed"))
+		return
+	}
+	username := strings.TrimPrefix(req.URL.Path, adminCacheUsersPath)
+	if username == "" {
+		p.StructuredError(rw, handlers.NewError("400", "Missing username"))
+		return
+	}
+	evicted := 0
+	for _, cache := range p.identityCaches() {
+		evicted += cache.EvictUser(username)
+	}
+	p.writeJSON(rw, cacheResponse{Evicted: &evicted})
+}
+
+func (p *ProxyServer) identityCaches() []handlers.IdentityCache {
+	caches := []handlers.IdentityCache{}
+	for _, reqhandler := range p.requestHandlers {
+		if cache, ok := reqhandler.(handlers.IdentityCache); ok {
+			caches = append(caches, cache)
+		}
+	}
+	return caches
+}
+
+func (p *ProxyServer) writeJSON(rw http.ResponseWriter, value interface{}) {
+	b, err := json.Marshal(value)
+	if err != nil {
+		log.Errorf("failed marshalling admin response: %s", err)
+		p.StructuredError(rw, err)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	_, _ = rw.Write(b)
+}
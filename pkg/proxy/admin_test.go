@@ -0,0 +1,106 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/openshift/elasticsearch-proxy/pkg/handlers"
+)
+
+// fakeIdentityCache stores the given roles in the request context and caches a single identity
+type fakeIdentityCache struct {
+	roles   []string
+	evicted []string
+	flushed bool
+}
+
+func (h *fakeIdentityCache) Name() string {
+	return "cache"
+}
+
+func (h *fakeIdentityCache) Process(req *http.Request) (*http.Request, error) {
+	ctx := context.WithValue(req.Context(), handlers.UsernameKey, "jdoe")
+	return req.WithContext(context.WithValue(ctx, handlers.RolesKey, h.roles)), nil
+}
+
+func (h *fakeIdentityCache) CachedIdentities() []handlers.CachedIdentity {
+	return []handlers.CachedIdentity{{Username: "jdoe", Roles: h.roles, ProjectCount: 2, Age: "5s"}}
+}
+
+func (h *fakeIdentityCache) EvictUser(username string) int {
+	h.evicted = append(h.evicted, username)
+	return 1
+}
+
+func (h *fakeIdentityCache) FlushCache() int {
+	h.flushed = true
+	return 3
+}
+
+var _ = Describe("AdminHandler", func() {
+
+	var (
+		next    bool
+		cache   *fakeIdentityCache
+		handler http.Handler
+	)
+
+	BeforeEach(func() {
+		next = false
+		cache = &fakeIdentityCache{roles: []string{"admin_reader"}}
+		server := &ProxyServer{adminRole: "admin_reader"}
+		server.RegisterRequestHandlers([]handlers.RequestHandler{cache})
+		handler = server.AdminHandler(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			next = true
+		}))
+	})
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, httptest.NewRequest(method, path, nil))
+		return rw
+	}
+
+	It("should pass other requests to the next handler", func() {
+		serve("GET", "/metrics")
+		Expect(next).To(BeTrue())
+	})
+
+	It("should list the cached identities", func() {
+		rw := serve("GET", adminCachePath)
+		Expect(rw.Code).To(Equal(http.StatusOK))
+		Expect(rw.Body.String()).To(MatchJSON(`{"identities":[{"username":"jdoe","roles":["admin_reader"],"projectCount":2,"age":"5s"}]}`))
+	})
+
+	It("should flush the cache", func() {
+		rw := serve("DELETE", adminCachePath)
+		Expect(rw.Code).To(Equal(http.StatusOK))
+		Expect(rw.Body.String()).To(MatchJSON(`{"evicted":3}`))
+		Expect(cache.flushed).To(BeTrue())
+	})
+
+	It("should evict the cached identities of a user", func() {
+		rw := serve("DELETE", adminCacheUsersPath+"someone")
+		Expect(rw.Code).To(Equal(http.StatusOK))
+		Expect(rw.Body.String()).To(MatchJSON(`{"evicted":1}`))
+		Expect(cache.evicted).To(Equal([]string{"someone"}))
+	})
+
+	It("should reject other methods", func() {
+		Expect(serve("POST", adminCachePath).Code).To(Equal(http.StatusMethodNotAllowed))
+		Expect(serve("GET", adminCacheUsersPath+"someone").Code).To(Equal(http.StatusMethodNotAllowed))
+	})
+
+	Context("when the user does not have the admin role", func() {
+		It("should be forbidden", func() {
+			cache.roles = []string{"project_user"}
+			Expect(serve("GET", adminCachePath).Code).To(Equal(http.StatusForbidden))
+			Expect(serve("DELETE", adminCachePath).Code).To(Equal(http.StatusForbidden))
+			Expect(cache.flushed).To(BeFalse())
+		})
+	})
+})
@@ -0,0 +1,116 @@
+package proxy
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/openshift/elasticsearch-proxy/pkg/handlers"
+)
+
+const (
+	adminLogLevelPath = "/_proxy/admin/loglevel"
+
+	defaultLogLevelDuration = time.Duration(10) * time.Minute
+)
+
+type logLevelResponse struct {
+	Level string `json:"level"`
+	//Until is when the level is restored, if it was changed
+	Until string `json:"until,omitempty"`
+}
+
+// logLevelController changes the level of a logger for a bounded duration after
+// which the level it had before is restored
+type logLevelController struct {
+	lock        sync.Mutex
+	logger      *log.Logger
+	maxDuration time.Duration
+	//previous is the level to restore when the timer fires
+	previous log.Level
+	timer    *time.Timer
+	until    time.Time
+}
+
+func newLogLevelController(logger *log.Logger, maxDuration time.Duration) *logLevelController {
+	return &logLevelController{
+		logger:      logger,
+		maxDuration: maxDuration,
+	}
+}
+
+// set changes the level for the duration, extending or replacing a previous change
+func (c *logLevelController) set(level log.Level, duration time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.timer == nil {
+		c.previous = c.logger.GetLevel()
+	} else {
+		c.timer.Stop()
+	}
+	c.logger.SetLevel(level)
+	c.until = time.Now().Add(duration)
+	c.timer = time.AfterFunc(duration, c.restore)
+	log.Infof("Changed the log level to %s until %s", level, c.until.UTC().Format(time.RFC3339))
+}
+
+// restore sets the level the logger had before it was changed
+func (c *logLevelController) restore() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.timer == nil {
+		return
+	}
+	c.timer.Stop()
+	c.timer = nil
+	c.logger.SetLevel(c.previous)
+	log.Infof("Restored the log level to %s", c.previous)
+}
+
+func (c *logLevelController) current() logLevelResponse {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	response := logLevelResponse{Level: c.logger.GetLevel().String()}
+	if c.timer != nil {
+		response.Until = c.until.UTC().Format(time.RFC3339)
+	}
+	return response
+}
+
+// serveLogLevel responds with the current log level to GET, changes it with PUT
+// (i.e. ?level=debug&duration=10m) and restores it with DELETE
+func (p *ProxyServer) serveLogLevel(rw http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		if p.logLevel.maxDuration == 0 {
+			p.StructuredError(rw, handlers.NewError("403", "Changing the log level is disabled"))
+			return
+		}
+		level, err := log.ParseLevel(req.URL.Query().Get("level"))
+		if err != nil {
+			p.StructuredError(rw, handlers.NewError("400", err.Error()))
+			return
+		}
+		duration := defaultLogLevelDuration
+		if value := req.URL.Query().Get("duration"); value != "" {
+			if duration, err = time.ParseDuration(value); err != nil || duration <= 0 {
+				p.StructuredError(rw, handlers.NewError("400", "Invalid duration "+value))
+				return
+			}
+		}
+		if duration > p.logLevel.maxDuration {
+			duration = p.logLevel.maxDuration
+		}
+		handlers.Logger(req.Context()).Infof("Changing the log level to %s for %s", level, duration)
+		p.logLevel.set(level, duration)
+	case http.MethodDelete:
+		p.logLevel.restore()
+	default:
+		p.StructuredError(rw, handlers.NewError("405", "Method Not Allowed"))
+		return
+	}
+	p.writeJSON(rw, p.logLevel.current())
+}
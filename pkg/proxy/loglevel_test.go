@@ -0,0 +1,73 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	log "github.com/sirupsen/logrus"
+)
+
+var _ = Describe("log level admin API", func() {
+
+	var (
+		logger *log.Logger
+		server *ProxyServer
+	)
+
+	BeforeEach(func() {
+		logger = log.New()
+		logger.SetLevel(log.InfoLevel)
+		server = &ProxyServer{logLevel: newLogLevelController(logger, time.Hour)}
+	})
+
+	AfterEach(func() {
+		server.logLevel.restore()
+	})
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		rw := httptest.NewRecorder()
+		server.serveLogLevel(rw, httptest.NewRequest(method, path, nil))
+		return rw
+	}
+
+	It("should respond with the current level", func() {
+		rw := serve("GET", adminLogLevelPath)
+		Expect(rw.Code).To(Equal(http.StatusOK))
+		Expect(rw.Body.String()).To(MatchJSON(`{"level":"info"}`))
+	})
+
+	It("should change the level until it is restored", func() {
+		rw := serve("PUT", adminLogLevelPath+"?level=debug&duration=5m")
+		Expect(rw.Code).To(Equal(http.StatusOK))
+		Expect(rw.Body.String()).To(ContainSubstring(`"until"`))
+		Expect(logger.GetLevel()).To(Equal(log.DebugLevel))
+
+		serve("PUT", adminLogLevelPath+"?level=trace")
+		Expect(logger.GetLevel()).To(Equal(log.TraceLevel))
+
+		rw = serve("DELETE", adminLogLevelPath)
+		Expect(rw.Body.String()).To(MatchJSON(`{"level":"info"}`))
+		Expect(logger.GetLevel()).To(Equal(log.InfoLevel))
+	})
+
+	It("should restore the level after the duration", func() {
+		server.logLevel.maxDuration = 10 * time.Millisecond
+		serve("PUT", adminLogLevelPath+"?level=debug&duration=1h")
+		Expect(logger.GetLevel()).To(Equal(log.DebugLevel))
+		Eventually(logger.GetLevel).Should(Equal(log.InfoLevel))
+	})
+
+	It("should reject invalid levels and durations", func() {
+		Expect(serve("PUT", adminLogLevelPath+"?level=loud").Code).To(Equal(http.StatusBadRequest))
+		Expect(serve("PUT", adminLogLevelPath+"?level=debug&duration=-1m").Code).To(Equal(http.StatusBadRequest))
+		Expect(logger.GetLevel()).To(Equal(log.InfoLevel))
+	})
+
+	It("should forbid changes when disabled", func() {
+		server.logLevel.maxDuration = 0
+		Expect(serve("PUT", adminLogLevelPath+"?level=debug").Code).To(Equal(http.StatusForbidden))
+	})
+})
@@ -4,6 +4,8 @@ import (
 	"net/http"
 
 	log "github.com/sirupsen/logrus"
+
+	"github.com/openshift/elasticsearch-proxy/pkg/util"
 )
 
 type responseLogger struct {
@@ -11,7 +13,7 @@ type responseLogger struct {
 }
 
 func (rl *responseLogger) Header() http.Header {
-	log.Debugf("Response Write header %v", rl.rw.Header())
+	log.Debugf("Response Write header %v", util.RedactHeaders(rl.rw.Header()))
 	return rl.rw.Header()
 }
 
@@ -1,28 +1,47 @@
 package proxy
 
 import (
+	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httputil"
 	"net/http/pprof"
 	"net/url"
 	"strings"
+	"time"
 
 	configOptions "github.com/openshift/elasticsearch-proxy/pkg/config"
 	handlers "github.com/openshift/elasticsearch-proxy/pkg/handlers"
 	"github.com/openshift/elasticsearch-proxy/pkg/handlers/instrumentation"
+	"github.com/openshift/elasticsearch-proxy/pkg/tracing"
 	"github.com/openshift/elasticsearch-proxy/pkg/util"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	log "github.com/sirupsen/logrus"
 	"github.com/yhat/wsutil"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type ProxyServer struct {
 	serveMux http.Handler
 
+	//adminRole is required to use the admin API
+	adminRole string
+	//logLevel changes the log level using the admin API
+	logLevel *logLevelController
+
+	//requestIDHeader is the header a request ID is accepted from when trustRequestID is set
+	requestIDHeader  string
+	trustRequestID   bool
+	opaqueIDUsername bool
+
 	//handlers
 	requestHandlers []handlers.RequestHandler
 }
@@ -32,6 +51,20 @@ func (p *ProxyServer) RegisterRequestHandlers(reqHandlers []handlers.RequestHand
 	p.requestHandlers = append(p.requestHandlers, reqHandlers...)
 }
 
+// Reload applies the given options to the registered request handlers that support it
+func (p *ProxyServer) Reload(opts *configOptions.Options) error {
+	util.SetSensitiveHeaders(opts.LogRedactHeaders)
+	for _, reqhandler := range p.requestHandlers {
+		if reloadable, ok := reqhandler.(handlers.ReloadableHandler); ok {
+			log.Debugf("Reloading handler %q", reqhandler.Name())
+			if err := reloadable.Reload(opts); err != nil {
+				return fmt.Errorf("failed to reload handler %s: %v", reqhandler.Name(), err)
+			}
+		}
+	}
+	return nil
+}
+
 type UpstreamProxy struct {
 	upstream  string
 	handler   http.Handler
@@ -68,11 +101,41 @@ func NewReverseProxy(target *url.URL, opts *configOptions.Options) (*httputil.Re
 			RootCAs: pool,
 		}
 	}
-	proxy.Transport = transport
+	proxy.Transport = tracing.NewTransport(&upstreamLatencyTransport{next: transport})
+	proxy.ModifyResponse = handlers.ModifyResponse
+	proxy.ErrorHandler = proxyErrorHandler
 
 	return proxy, nil
 }
 
+// proxyErrorHandler responds with the error of a request handler rejecting the request given its
+// body and with 502 when Elasticsearch can not be reached
+func proxyErrorHandler(rw http.ResponseWriter, req *http.Request, err error) {
+	var bodyErr *handlers.RequestBodyError
+	if errors.As(err, &bodyErr) {
+		handlers.Logger(req.Context()).Errorf("Error processing request body: %v", bodyErr.Err)
+		writeStructuredError(rw, bodyErr.Err)
+		return
+	}
+	handlers.Logger(req.Context()).Errorf("http: proxy error: %v", err)
+	rw.WriteHeader(http.StatusBadGateway)
+}
+
+// upstreamLatencyTransport records the duration until the response headers are received
+// from upstream in the RequestInfo of the request
+type upstreamLatencyTransport struct {
+	next http.RoundTripper
+}
+
+func (t *upstreamLatencyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	if info := handlers.RequestInfoFrom(req.Context()); info != nil {
+		info.UpstreamLatency = time.Since(start)
+	}
+	return resp, err
+}
+
 func setProxyUpstreamHostHeader(proxy *httputil.ReverseProxy, target *url.URL) {
 	director := proxy.Director
 	proxy.Director = func(req *http.Request) {
@@ -138,33 +201,136 @@ func NewProxyServer(opts *configOptions.Options) *ProxyServer {
 		panic(fmt.Sprintf("unknown upstream protocol %s", u.Scheme))
 	}
 
-	return &ProxyServer{
-		serveMux: serveMux,
+	adminRole := opts.CacheAdminRole
+	if adminRole == "" {
+		adminRole = opts.AuthAdminRole
 	}
+	proxyServer := &ProxyServer{
+		serveMux:  serveMux,
+		adminRole: adminRole,
+		logLevel:  newLogLevelController(log.StandardLogger(), opts.LogLevelMaxDuration),
+
+		requestIDHeader:  opts.RequestIDHeader,
+		trustRequestID:   opts.TrustRequestID,
+		opaqueIDUsername: opts.OpaqueIDUsername,
+	}
+	serveMux.HandleFunc(whoamiPath, proxyServer.whoami)
+	return proxyServer
 }
 
 func (p *ProxyServer) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
-	log.Debugf("Serving request: %s", req.URL.Path)
-	log.Tracef("Content-Length: %v", req.ContentLength)
-	log.Tracef("Headers: %v", req.Header)
+	ctx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+	ctx, span := tracing.Tracer().Start(ctx, "ServeHTTP",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("http.request.method", req.Method),
+			attribute.String("url.path", req.URL.Path),
+		))
+	defer span.End()
+
+	req = handlers.WithESRequest(p.withRequestID(rw, req.WithContext(ctx)))
+	span.SetAttributes(
+		attribute.String("request.id", req.Context().Value(handlers.RequestIDKey).(string)),
+		attribute.String("db.operation", string(handlers.ESRequest(req.Context()).Action)),
+	)
+	logger := handlers.Logger(req.Context())
+	logger.Debugf("Serving request: %s", req.URL.Path)
+	logger.Tracef("Content-Length: %v", req.ContentLength)
+	logger.Tracef("Headers: %v", util.RedactHeaders(req.Header))
 
+	req, ok := p.processRequest(rw, req)
+	handlers.RequestInfoFrom(req.Context()).Update(req.Context())
+	if !ok {
+		span.SetStatus(codes.Error, "request handler failed")
+		return
+	}
+
+	req.Header.Set(handlers.OpaqueIDHeader, p.opaqueID(req))
+	p.serveMux.ServeHTTP(rw, req)
+}
+
+// processRequest runs the request handlers on the request. Each handler is given a logger
+// with its name and its own span, and the user is added to the logger of the request once
+// it is known. It responds with the error and returns false when a handler fails
+func (p *ProxyServer) processRequest(rw http.ResponseWriter, req *http.Request) (*http.Request, bool) {
+	logger := handlers.Logger(req.Context())
+	span := trace.SpanFromContext(req.Context())
 	for _, reqhandler := range p.requestHandlers {
-		log.Debugf("Handling request %q", reqhandler.Name())
+		handlerLogger := logger.WithField("handler", reqhandler.Name())
+		handlerLogger.Debug("Handling request")
 
+		ctx, handlerSpan := tracing.Tracer().Start(req.Context(), "handler "+reqhandler.Name())
 		var err error
-		req, err = reqhandler.Process(req)
+		req, err = reqhandler.Process(req.WithContext(context.WithValue(ctx, handlers.LoggerKey, handlerLogger)))
 		if err != nil {
-			log.Errorf("Error processing request in handler %s: %v", reqhandler.Name(), err)
+			handlerSpan.RecordError(err)
+			handlerSpan.SetStatus(codes.Error, err.Error())
+			handlerSpan.End()
+			handlerLogger.Errorf("Error processing request: %v", err)
 			p.StructuredError(rw, err)
-			break
+			return req, false
+		}
+		handlerSpan.End()
+		if _, found := logger.Data["user"]; !found {
+			if user := userFromContext(req.Context()); user != "" {
+				logger = logger.WithField("user", user)
+				span.SetAttributes(attribute.String("enduser.id", user))
+			}
 		}
+		ctx = trace.ContextWithSpan(req.Context(), span)
+		req = req.WithContext(context.WithValue(ctx, handlers.LoggerKey, logger))
 	}
+	return req, true
+}
 
-	p.serveMux.ServeHTTP(rw, req)
+// withRequestID returns the request with its ID, which is given in the response so it can
+// be correlated with the logs of the proxy and Elasticsearch. The ID given by the client is
+// used when trusted and valid
+func (p *ProxyServer) withRequestID(rw http.ResponseWriter, req *http.Request) *http.Request {
+	id := ""
+	if p.trustRequestID {
+		if incoming := req.Header.Get(p.requestIDHeader); handlers.ValidRequestID(incoming) {
+			id = incoming
+		}
+	}
+	if id == "" {
+		id = handlers.NewRequestID()
+	}
+	rw.Header().Set(handlers.RequestIDHeader, id)
+	return handlers.WithRequestID(req, id)
+}
+
+// opaqueID returns the X-Opaque-Id forwarded to Elasticsearch which is the request ID,
+// prefixed with the user when configured
+func (p *ProxyServer) opaqueID(req *http.Request) string {
+	id, _ := req.Context().Value(handlers.RequestIDKey).(string)
+	if p.opaqueIDUsername {
+		if user := userFromContext(req.Context()); user != "" {
+			return user + "/" + id
+		}
+	}
+	return id
+}
+
+// userFromContext returns the username or certificate subject stored in the context
+// by the authorization handler
+func userFromContext(ctx context.Context) string {
+	if username, ok := ctx.Value(handlers.UsernameKey).(string); ok && username != "" {
+		return username
+	}
+	if subject, ok := ctx.Value(handlers.SubjectKey).(string); ok {
+		return subject
+	}
+	return ""
 }
 
 func (p *ProxyServer) StructuredError(rw http.ResponseWriter, err error) {
+	writeStructuredError(rw, err)
+}
+
+func writeStructuredError(rw http.ResponseWriter, err error) {
 	structuredError := handlers.NewStructuredError(err)
+	structuredError.RequestID = rw.Header().Get(handlers.RequestIDHeader)
 	log.Debugf("Error %d %s %s", structuredError.Code, structuredError.Message, structuredError.Error)
 	rw.Header().Set("Content-Type", "application/json")
 	rw.WriteHeader(structuredError.Code)
@@ -0,0 +1,278 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	log "github.com/sirupsen/logrus"
+
+	configOptions "github.com/openshift/elasticsearch-proxy/pkg/config"
+	"github.com/openshift/elasticsearch-proxy/pkg/handlers"
+)
+
+type fakeRequestHandler struct {
+	err error
+}
+
+func (h *fakeRequestHandler) Name() string {
+	return "fake"
+}
+
+func (h *fakeRequestHandler) Process(req *http.Request) (*http.Request, error) {
+	return req, h.err
+}
+
+var _ = Describe("ProxyServer", func() {
+
+	var (
+		proxied bool
+		server  *ProxyServer
+	)
+
+	BeforeEach(func() {
+		proxied = false
+		server = &ProxyServer{
+			serveMux: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				proxied = true
+			}),
+		}
+	})
+
+	Context("when a request handler returns an error", func() {
+		It("should respond with the error and not proxy the request", func() {
+			server.RegisterRequestHandlers([]handlers.RequestHandler{
+				&fakeRequestHandler{err: handlers.NewError("403", "not allowed")},
+				&fakeRequestHandler{err: errors.New("not reached")},
+			})
+			rw := httptest.NewRecorder()
+			server.ServeHTTP(rw, httptest.NewRequest("GET", "/foo/_search", nil))
+			Expect(proxied).To(BeFalse())
+			Expect(rw.Code).To(Equal(http.StatusForbidden))
+			Expect(rw.Body.String()).To(ContainSubstring(`"message":"not allowed"`))
+		})
+	})
+
+	Context("when the request handlers succeed", func() {
+		It("should proxy the request", func() {
+			server.RegisterRequestHandlers([]handlers.RequestHandler{&fakeRequestHandler{}})
+			server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/foo/_search", nil))
+			Expect(proxied).To(BeTrue())
+		})
+	})
+})
+
+// loggingRequestHandler records the logger fields given to it by the server
+type loggingRequestHandler struct {
+	fields log.Fields
+}
+
+func (h *loggingRequestHandler) Name() string {
+	return "logging"
+}
+
+func (h *loggingRequestHandler) Process(req *http.Request) (*http.Request, error) {
+	h.fields = handlers.Logger(req.Context()).Data
+	return req, nil
+}
+
+var _ = Describe("ProxyServer logging", func() {
+	It("should give handlers a logger with the request ID, user and handler name", func() {
+		recorder := &loggingRequestHandler{}
+		var fields log.Fields
+		server := &ProxyServer{
+			serveMux: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				fields = handlers.Logger(req.Context()).Data
+			}),
+		}
+		server.RegisterRequestHandlers([]handlers.RequestHandler{&identityRequestHandler{}, recorder})
+		server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/foo/_search", nil))
+
+		Expect(recorder.fields).To(HaveKeyWithValue("handler", "logging"))
+		Expect(recorder.fields).To(HaveKeyWithValue("user", "jdoe"))
+		Expect(recorder.fields).To(HaveKey("request_id"))
+		Expect(fields).To(HaveKeyWithValue("user", "jdoe"))
+		Expect(fields).To(HaveKeyWithValue("request_id", recorder.fields["request_id"]))
+		Expect(fields).ToNot(HaveKey("handler"))
+	})
+})
+
+var _ = Describe("ProxyServer trace logging", func() {
+	It("should redact credentials from the logged headers", func() {
+		out := &bytes.Buffer{}
+		level := log.GetLevel()
+		log.SetOutput(out)
+		log.SetLevel(log.TraceLevel)
+		defer func() {
+			log.SetOutput(os.Stderr)
+			log.SetLevel(level)
+		}()
+
+		server := &ProxyServer{serveMux: http.NotFoundHandler()}
+		req := httptest.NewRequest("GET", "/foo/_search", nil)
+		req.Header.Set("Authorization", "Bearer sha256~secrettoken")
+		req.Header.Set("X-Forwarded-Access-Token", "sha256~secrettoken")
+		server.ServeHTTP(httptest.NewRecorder(), req)
+
+		Expect(out.String()).To(ContainSubstring("Headers:"))
+		Expect(out.String()).ToNot(ContainSubstring("secrettoken"))
+	})
+})
+
+var _ = Describe("ProxyServer request IDs", func() {
+
+	var (
+		forwarded *http.Request
+		server    *ProxyServer
+		rw        *httptest.ResponseRecorder
+		req       *http.Request
+	)
+
+	BeforeEach(func() {
+		forwarded = nil
+		server = &ProxyServer{
+			serveMux: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				forwarded = req
+			}),
+			requestIDHeader: "X-Opaque-Id",
+		}
+		server.RegisterRequestHandlers([]handlers.RequestHandler{&identityRequestHandler{}})
+		rw = httptest.NewRecorder()
+		req = httptest.NewRequest("GET", "/foo/_search", nil)
+		req.Header.Set("X-Opaque-Id", "kibana-1234")
+	})
+
+	It("should generate an ID and forward it to Elasticsearch", func() {
+		server.ServeHTTP(rw, req)
+		id := rw.Header().Get(handlers.RequestIDHeader)
+		Expect(id).To(HaveLen(32))
+		Expect(forwarded.Header.Get(handlers.OpaqueIDHeader)).To(Equal(id))
+		Expect(forwarded.Context().Value(handlers.RequestIDKey)).To(Equal(id))
+	})
+
+	It("should use a trusted incoming ID", func() {
+		server.trustRequestID = true
+		server.ServeHTTP(rw, req)
+		Expect(rw.Header().Get(handlers.RequestIDHeader)).To(Equal("kibana-1234"))
+		Expect(forwarded.Header.Get(handlers.OpaqueIDHeader)).To(Equal("kibana-1234"))
+	})
+
+	It("should not use an invalid incoming ID", func() {
+		server.trustRequestID = true
+		req.Header.Set("X-Opaque-Id", "bad id\n")
+		server.ServeHTTP(rw, req)
+		Expect(rw.Header().Get(handlers.RequestIDHeader)).To(HaveLen(32))
+	})
+
+	It("should prefix the forwarded ID with the username", func() {
+		server.opaqueIDUsername = true
+		server.ServeHTTP(rw, req)
+		Expect(forwarded.Header.Get(handlers.OpaqueIDHeader)).To(Equal("jdoe/" + rw.Header().Get(handlers.RequestIDHeader)))
+	})
+
+	It("should include the ID in structured errors", func() {
+		server.requestHandlers = []handlers.RequestHandler{&fakeRequestHandler{err: handlers.NewError("403", "not allowed")}}
+		server.ServeHTTP(rw, req)
+		Expect(rw.Body.String()).To(ContainSubstring(`"requestId":"` + rw.Header().Get(handlers.RequestIDHeader) + `"`))
+	})
+})
+
+var _ = Describe("ProxyServer request info", func() {
+	It("should record the identity of the request for the access log", func() {
+		server := &ProxyServer{serveMux: http.NotFoundHandler()}
+		server.RegisterRequestHandlers([]handlers.RequestHandler{&identityRequestHandler{}})
+		req, info := handlers.WithRequestInfo(httptest.NewRequest("GET", "/foo/_search", nil))
+		rw := httptest.NewRecorder()
+		server.ServeHTTP(rw, req)
+		Expect(info.User).To(Equal("jdoe"))
+		Expect(info.RequestID).To(Equal(rw.Header().Get(handlers.RequestIDHeader)))
+	})
+
+	It("should record the upstream latency", func() {
+		req, info := handlers.WithRequestInfo(httptest.NewRequest("GET", "/foo/_search", nil))
+		transport := &upstreamLatencyTransport{next: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			time.Sleep(5 * time.Millisecond)
+			return &http.Response{StatusCode: http.StatusOK}, nil
+		})}
+		_, err := transport.RoundTrip(req)
+		Expect(err).To(BeNil())
+		Expect(info.UpstreamLatency).To(BeNumerically(">=", 5*time.Millisecond))
+	})
+})
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+type failingReader struct {
+	err error
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
+
+var _ = Describe("ReverseProxy", func() {
+
+	var (
+		upstream *httptest.Server
+		proxy    http.Handler
+	)
+
+	BeforeEach(func() {
+		upstream = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			_, _ = io.Copy(ioutil.Discard, req.Body)
+			rw.Header().Set("Content-Type", "application/json")
+			_, _ = rw.Write([]byte(`{"acknowledged":true}`))
+		}))
+		target, err := url.Parse(upstream.URL)
+		Expect(err).To(BeNil())
+		proxy, err = NewReverseProxy(target, &configOptions.Options{})
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		upstream.Close()
+	})
+
+	It("should respond with the error of a request handler rejecting the body", func() {
+		body := io.MultiReader(bytes.NewBufferString("{}\n"), &failingReader{&handlers.RequestBodyError{Err: handlers.NewError("403", "Forbidden index app-other")}})
+		req := httptest.NewRequest("POST", "/_bulk", body)
+		rw := httptest.NewRecorder()
+		proxy.ServeHTTP(rw, req)
+		Expect(rw.Code).To(Equal(http.StatusForbidden))
+		Expect(rw.Body.String()).To(ContainSubstring(`"message":"Forbidden index app-other"`))
+	})
+
+	It("should respond with 502 when Elasticsearch fails", func() {
+		upstream.Close()
+		rw := httptest.NewRecorder()
+		proxy.ServeHTTP(rw, httptest.NewRequest("GET", "/_search", nil))
+		Expect(rw.Code).To(Equal(http.StatusBadGateway))
+	})
+
+	It("should apply the response modifiers of the request", func() {
+		req := handlers.WithResponseModifier(httptest.NewRequest("GET", "/_search", nil), func(resp *http.Response) error {
+			resp.Header.Set("X-Modified", "first")
+			return nil
+		})
+		req = handlers.WithResponseModifier(req, func(resp *http.Response) error {
+			resp.Header.Set("X-Modified", resp.Header.Get("X-Modified")+",second")
+			return nil
+		})
+		rw := httptest.NewRecorder()
+		proxy.ServeHTTP(rw, req)
+		Expect(rw.Code).To(Equal(http.StatusOK))
+		Expect(rw.Header().Get("X-Modified")).To(Equal("first,second"))
+	})
+})
@@ -0,0 +1,70 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"github.com/openshift/elasticsearch-proxy/pkg/handlers"
+	"github.com/openshift/elasticsearch-proxy/pkg/tracing"
+)
+
+var _ = Describe("ProxyServer tracing", func() {
+
+	const (
+		traceID      = "4bf92f3577b34da6a3ce929d0e0e4736"
+		parentSpanID = "00f067aa0ba902b7"
+	)
+
+	var (
+		recorder *tracetest.SpanRecorder
+		server   *ProxyServer
+	)
+
+	BeforeEach(func() {
+		recorder = tracetest.NewSpanRecorder()
+		otel.SetTracerProvider(tracing.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+		otel.SetTextMapPropagator(propagation.TraceContext{})
+		server = &ProxyServer{serveMux: http.NotFoundHandler()}
+	})
+
+	AfterEach(func() {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+	})
+
+	It("should continue the incoming trace with a span for each request handler", func() {
+		server.RegisterRequestHandlers([]handlers.RequestHandler{&identityRequestHandler{}, &fakeRequestHandler{}})
+		req := httptest.NewRequest("GET", "/foo/_search", nil)
+		req.Header.Set("traceparent", "00-"+traceID+"-"+parentSpanID+"-01")
+		server.ServeHTTP(httptest.NewRecorder(), req)
+
+		spans := recorder.Ended()
+		Expect(spans).To(HaveLen(3))
+		root := spans[2]
+		Expect(root.Name()).To(Equal("ServeHTTP"))
+		Expect(root.SpanContext().TraceID().String()).To(Equal(traceID))
+		Expect(root.Parent().SpanID().String()).To(Equal(parentSpanID))
+		Expect(spans[0].Name()).To(Equal("handler identity"))
+		Expect(spans[1].Name()).To(Equal("handler fake"))
+		for _, span := range spans[:2] {
+			Expect(span.Parent().SpanID()).To(Equal(root.SpanContext().SpanID()))
+		}
+	})
+
+	It("should record the error of a failing request handler", func() {
+		server.RegisterRequestHandlers([]handlers.RequestHandler{&fakeRequestHandler{err: handlers.NewError("403", "not allowed")}})
+		server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/foo/_search", nil))
+
+		spans := recorder.Ended()
+		Expect(spans).To(HaveLen(2))
+		Expect(spans[0].Status().Description).To(ContainSubstring("not allowed"))
+		Expect(spans[0].Events()).ToNot(BeEmpty())
+	})
+})
@@ -0,0 +1,63 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/openshift/elasticsearch-proxy/pkg/apis"
+	"github.com/openshift/elasticsearch-proxy/pkg/handlers"
+)
+
+const (
+	// whoamiPath is reserved by the proxy and never forwarded upstream
+	whoamiPath = "/_proxy/whoami"
+)
+
+type whoamiResponse struct {
+	Username string   `json:"username,omitempty"`
+	Subject  string   `json:"subject,omitempty"`
+	Roles    []string `json:"roles"`
+	Projects []string `json:"projects"`
+}
+
+// whoami responds with the identity the request handlers stored in the request context
+func (p *ProxyServer) whoami(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		p.StructuredError(rw, handlers.NewError("405", "Method Not Allowed"))
+		return
+	}
+	ctx := req.Context()
+	response := whoamiResponse{
+		Roles:    []string{},
+		Projects: []string{},
+	}
+	if username, ok := ctx.Value(handlers.UsernameKey).(string); ok {
+		response.Username = username
+	}
+	if subject, ok := ctx.Value(handlers.SubjectKey).(string); ok {
+		response.Subject = subject
+	}
+	if response.Username == "" && response.Subject == "" {
+		p.StructuredError(rw, handlers.NewError("401", "Unauthorized"))
+		return
+	}
+	if roles, ok := ctx.Value(handlers.RolesKey).([]string); ok {
+		response.Roles = roles
+	}
+	if projects, ok := ctx.Value(handlers.ProjectsKey).([]apis.Project); ok {
+		for _, project := range projects {
+			response.Projects = append(response.Projects, project.Name)
+		}
+	}
+
+	b, err := json.Marshal(response)
+	if err != nil {
+		log.Errorf("failed marshalling whoami response: %s", err)
+		p.StructuredError(rw, err)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	_, _ = rw.Write(b)
+}
@@ -0,0 +1,130 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/openshift/elasticsearch-proxy/pkg/apis"
+	configOptions "github.com/openshift/elasticsearch-proxy/pkg/config"
+	"github.com/openshift/elasticsearch-proxy/pkg/handlers"
+	"github.com/openshift/elasticsearch-proxy/pkg/handlers/indices"
+)
+
+var _ = Describe("whoami", func() {
+
+	var (
+		rw     *httptest.ResponseRecorder
+		req    *http.Request
+		server *ProxyServer
+	)
+
+	BeforeEach(func() {
+		rw = httptest.NewRecorder()
+		req = httptest.NewRequest("GET", whoamiPath, nil)
+		server = &ProxyServer{}
+	})
+
+	Context("for a user authenticated by token", func() {
+		It("should respond with the username, roles and projects", func() {
+			ctx := context.WithValue(req.Context(), handlers.UsernameKey, "jdoe")
+			ctx = context.WithValue(ctx, handlers.RolesKey, []string{"project_user"})
+			ctx = context.WithValue(ctx, handlers.ProjectsKey, []apis.Project{{Name: "foo"}, {Name: "bar"}})
+			server.whoami(rw, req.WithContext(ctx))
+			Expect(rw.Code).To(Equal(http.StatusOK))
+			Expect(rw.Header().Get("Content-Type")).To(Equal("application/json"))
+			Expect(rw.Body.String()).To(MatchJSON(`{"username":"jdoe","roles":["project_user"],"projects":["foo","bar"]}`))
+		})
+	})
+
+	Context("for a user authenticated by certificate", func() {
+		It("should respond with the subject", func() {
+			ctx := context.WithValue(req.Context(), handlers.SubjectKey, "CN=foo,O=org")
+			server.whoami(rw, req.WithContext(ctx))
+			Expect(rw.Code).To(Equal(http.StatusOK))
+			Expect(rw.Body.String()).To(MatchJSON(`{"subject":"CN=foo,O=org","roles":[],"projects":[]}`))
+		})
+	})
+
+	Context("for an unauthenticated request", func() {
+		It("should respond unauthorized", func() {
+			server.whoami(rw, req)
+			Expect(rw.Code).To(Equal(http.StatusUnauthorized))
+		})
+	})
+
+	Context("for methods other than GET", func() {
+		It("should respond method not allowed", func() {
+			server.whoami(rw, httptest.NewRequest("POST", whoamiPath, nil))
+			Expect(rw.Code).To(Equal(http.StatusMethodNotAllowed))
+		})
+	})
+})
+
+var _ = Describe("NewProxyServer", func() {
+	It("should serve whoami without forwarding it upstream", func() {
+		forwarded := []string{}
+		upstream := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			forwarded = append(forwarded, req.URL.Path)
+		}))
+		defer upstream.Close()
+		upstreamURL, err := url.Parse(upstream.URL + "/")
+		Expect(err).To(BeNil())
+
+		server := NewProxyServer(&configOptions.Options{ElasticsearchURL: upstreamURL})
+		server.RegisterRequestHandlers([]handlers.RequestHandler{&identityRequestHandler{}})
+
+		rw := httptest.NewRecorder()
+		server.ServeHTTP(rw, httptest.NewRequest("GET", whoamiPath, nil))
+		Expect(rw.Code).To(Equal(http.StatusOK))
+		Expect(rw.Body.String()).To(MatchJSON(`{"username":"jdoe","roles":[],"projects":[]}`))
+
+		server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/foo/_search", nil))
+		Expect(forwarded).To(Equal([]string{"/foo/_search"}))
+	})
+})
+
+var _ = Describe("whoami with index patterns", func() {
+	It("should respond to users without the admin role", func() {
+		mux := http.NewServeMux()
+		server := &ProxyServer{serveMux: mux}
+		mux.HandleFunc(whoamiPath, server.whoami)
+		opts := &configOptions.Options{AuthIndexPatterns: []string{"app-{namespace}-*"}}
+		server.RegisterRequestHandlers(append([]handlers.RequestHandler{&tokenRequestHandler{}}, indices.NewHandlers(opts)...))
+
+		rw := httptest.NewRecorder()
+		server.ServeHTTP(rw, httptest.NewRequest("GET", whoamiPath, nil))
+		Expect(rw.Code).To(Equal(http.StatusOK))
+		Expect(rw.Body.String()).To(MatchJSON(`{"username":"jdoe","roles":["project_user"],"projects":["foo"]}`))
+	})
+})
+
+// identityRequestHandler stores an identity in the request context like the authorization handler
+type identityRequestHandler struct{}
+
+func (h *identityRequestHandler) Name() string {
+	return "identity"
+}
+
+func (h *identityRequestHandler) Process(req *http.Request) (*http.Request, error) {
+	return req.WithContext(context.WithValue(req.Context(), handlers.UsernameKey, "jdoe")), nil
+}
+
+// tokenRequestHandler stores the identity of a user authenticated by token like the authorization handler
+type tokenRequestHandler struct{}
+
+func (h *tokenRequestHandler) Name() string {
+	return "token"
+}
+
+func (h *tokenRequestHandler) Process(req *http.Request) (*http.Request, error) {
+	ctx := context.WithValue(req.Context(), handlers.AuthMethodKey, handlers.AuthMethodToken)
+	ctx = context.WithValue(ctx, handlers.UsernameKey, "jdoe")
+	ctx = context.WithValue(ctx, handlers.RolesKey, []string{"project_user"})
+	ctx = context.WithValue(ctx, handlers.ProjectsKey, []apis.Project{{Name: "foo"}})
+	return req.WithContext(ctx), nil
+}
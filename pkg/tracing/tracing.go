@@ -0,0 +1,79 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/openshift/elasticsearch-proxy/pkg/config"
+)
+
+const (
+	instrumentationName = "github.com/openshift/elasticsearch-proxy"
+	serviceName         = "elasticsearch-proxy"
+)
+
+// Tracer returns the tracer of the proxy which records spans once tracing is initialized
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Init configures the exporter of the spans recorded by the proxy and the W3C trace context
+// propagation of incoming and upstream requests. The returned func flushes the spans not
+// yet exported
+func Init(opts *config.Options) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var (
+		exporter sdktrace.SpanExporter
+		err      error
+	)
+	switch opts.TracingExporter {
+	case config.TracingExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case config.TracingExporterOTLP:
+		exporter, err = otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(opts.TracingEndpoint))
+	case config.TracingExporterStdout:
+		exporter, err = NewWriterExporter(os.Stdout)
+	case config.TracingExporterFile:
+		var file *os.File
+		file, err = os.OpenFile(opts.TracingFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err == nil {
+			exporter, err = NewWriterExporter(file)
+		}
+	default:
+		err = fmt.Errorf("unknown exporter %q", opts.TracingExporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the %s trace exporter: %v", opts.TracingExporter, err)
+	}
+
+	provider := NewTracerProvider(sdktrace.WithBatcher(exporter))
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// NewTracerProvider returns a provider of tracers which sample every trace unless the
+// parent was not sampled
+func NewTracerProvider(opts ...sdktrace.TracerProviderOption) *sdktrace.TracerProvider {
+	opts = append([]sdktrace.TracerProviderOption{
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", serviceName))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.AlwaysSample())),
+	}, opts...)
+	return sdktrace.NewTracerProvider(opts...)
+}
+
+// NewWriterExporter returns an exporter writing each span as a JSON document to the writer
+func NewWriterExporter(w io.Writer) (sdktrace.SpanExporter, error) {
+	return stdouttrace.New(stdouttrace.WithWriter(w))
+}
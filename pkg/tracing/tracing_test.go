@@ -0,0 +1,69 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bmizerany/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"github.com/openshift/elasticsearch-proxy/pkg/config"
+)
+
+func TestTransportPropagatesTraceContext(t *testing.T) {
+	out := &bytes.Buffer{}
+	exporter, err := NewWriterExporter(out)
+	assert.Equal(t, nil, err)
+	provider := NewTracerProvider(sdktrace.WithSyncer(exporter))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+	var traceparent string
+	upstream := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		traceparent = req.Header.Get("traceparent")
+	}))
+	defer upstream.Close()
+
+	ctx, span := Tracer().Start(context.Background(), "ServeHTTP")
+	req, _ := http.NewRequestWithContext(ctx, "GET", upstream.URL+"/foo/_search", nil)
+	resp, err := (&http.Client{Transport: NewTransport(http.DefaultTransport)}).Do(req)
+	assert.Equal(t, nil, err)
+	resp.Body.Close()
+	span.End()
+
+	traceID := span.SpanContext().TraceID().String()
+	assert.Equal(t, true, strings.Contains(traceparent, traceID))
+	assert.Equal(t, "", req.Header.Get("traceparent"))
+	assert.Equal(t, true, strings.Contains(out.String(), `"Name":"upstream GET"`))
+	assert.Equal(t, true, strings.Contains(out.String(), traceID))
+}
+
+func TestInitFileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.json")
+	shutdown, err := Init(&config.Options{TracingExporter: config.TracingExporterFile, TracingFile: path})
+	assert.Equal(t, nil, err)
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+	_, span := Tracer().Start(context.Background(), "ServeHTTP")
+	span.End()
+	assert.Equal(t, nil, shutdown(context.Background()))
+
+	spans, err := os.ReadFile(path)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, strings.Contains(string(spans), `"Name":"ServeHTTP"`))
+}
+
+func TestInitUnknownExporter(t *testing.T) {
+	_, err := Init(&config.Options{TracingExporter: "zipkin"})
+	assert.NotEqual(t, nil, err)
+}
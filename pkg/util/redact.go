@@ -0,0 +1,59 @@
+package util
+
+import (
+	"net/http"
+	"sync"
+)
+
+const (
+	// Redacted replaces sensitive values in logs
+	Redacted = "REDACTED"
+)
+
+// DefaultSensitiveHeaders are the headers carrying credentials which are always redacted
+var DefaultSensitiveHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+	"X-Forwarded-Access-Token",
+}
+
+var (
+	sensitiveHeadersLock sync.RWMutex
+	sensitiveHeaders     = canonicalHeaders(DefaultSensitiveHeaders)
+)
+
+func canonicalHeaders(names []string) map[string]bool {
+	headers := map[string]bool{}
+	for _, name := range names {
+		headers[http.CanonicalHeaderKey(name)] = true
+	}
+	return headers
+}
+
+// SetSensitiveHeaders redacts the given headers in addition to the default sensitive headers
+func SetSensitiveHeaders(names []string) {
+	headers := canonicalHeaders(append(append([]string{}, DefaultSensitiveHeaders...), names...))
+	sensitiveHeadersLock.Lock()
+	defer sensitiveHeadersLock.Unlock()
+	sensitiveHeaders = headers
+}
+
+// RedactHeaders returns a copy of the headers that is safe to log where the values of sensitive
+// headers are redacted
+func RedactHeaders(header http.Header) http.Header {
+	sensitiveHeadersLock.RLock()
+	defer sensitiveHeadersLock.RUnlock()
+	redacted := make(http.Header, len(header))
+	for name, values := range header {
+		if sensitiveHeaders[http.CanonicalHeaderKey(name)] {
+			values = make([]string, len(values))
+			for i := range values {
+				values[i] = Redacted
+			}
+		}
+		redacted[name] = values
+	}
+	return redacted
+}
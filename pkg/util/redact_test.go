@@ -0,0 +1,30 @@
+package util
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/bmizerany/assert"
+)
+
+func TestRedactHeaders(t *testing.T) {
+	defer SetSensitiveHeaders(nil)
+	header := http.Header{
+		"Authorization":            []string{"Bearer secrettoken"},
+		"X-Forwarded-Access-Token": []string{"secrettoken"},
+		"X-Api-Key":                []string{"apikey"},
+		"Accept":                   []string{"application/json"},
+	}
+
+	redacted := RedactHeaders(header)
+	assert.Equal(t, []string{Redacted}, redacted["Authorization"])
+	assert.Equal(t, []string{Redacted}, redacted["X-Forwarded-Access-Token"])
+	assert.Equal(t, []string{"apikey"}, redacted["X-Api-Key"])
+	assert.Equal(t, []string{"application/json"}, redacted["Accept"])
+	assert.Equal(t, []string{"Bearer secrettoken"}, header["Authorization"])
+
+	SetSensitiveHeaders([]string{"x-api-key"})
+	redacted = RedactHeaders(header)
+	assert.Equal(t, []string{Redacted}, redacted["X-Api-Key"])
+	assert.Equal(t, []string{Redacted}, redacted["Authorization"])
+}
@@ -0,0 +1,99 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+
+	expectations "github.com/onsi/gomega"
+
+	"github.com/openshift/elasticsearch-proxy/pkg/apis"
+	"github.com/openshift/elasticsearch-proxy/pkg/handlers"
+)
+
+// RequestFixture gives the requests of the specs to a handler as the auth handler would, with the
+// identity of the user, or of the certificate, in their context
+type RequestFixture struct {
+	Handler    handlers.RequestHandler
+	AuthMethod string
+	// Subject of the certificate, which is not added to the context when empty
+	Subject  string
+	Username string
+	Roles    []string
+	Projects []apis.Project
+	// Header is set on every request
+	Header http.Header
+}
+
+// NewRequestFixture returns a fixture for a project user of the projects foo and bar
+func NewRequestFixture(handler handlers.RequestHandler) *RequestFixture {
+	return &RequestFixture{
+		Handler:    handler,
+		AuthMethod: handlers.AuthMethodToken,
+		Username:   "alice",
+		Roles:      []string{"project_user"},
+		Projects:   []apis.Project{{Name: "foo", UID: "8d5b"}, {Name: "bar", UID: "1f2e"}},
+		Header:     http.Header{"Accept-Encoding": []string{"gzip"}},
+	}
+}
+
+// Process returns the request processed by the handler. Requests are given no body when it is empty
+func (f *RequestFixture) Process(method, path, body string) (*http.Request, error) {
+	req := httptest.NewRequest(method, path, nil)
+	if body != "" {
+		req = httptest.NewRequest(method, path, strings.NewReader(body))
+	}
+	for name, values := range f.Header {
+		req.Header[name] = append([]string{}, values...)
+	}
+	ctx := context.WithValue(req.Context(), handlers.AuthMethodKey, f.AuthMethod)
+	if f.Subject != "" {
+		ctx = context.WithValue(ctx, handlers.SubjectKey, f.Subject)
+	}
+	ctx = context.WithValue(ctx, handlers.UsernameKey, f.Username)
+	ctx = context.WithValue(ctx, handlers.RolesKey, f.Roles)
+	ctx = context.WithValue(ctx, handlers.ProjectsKey, f.Projects)
+	return f.Handler.Process(handlers.WithESRequest(req.WithContext(ctx)))
+}
+
+// Check returns the error of the handler processing the request
+func (f *RequestFixture) Check(method, path, body string) error {
+	_, err := f.Process(method, path, body)
+	return err
+}
+
+// Read returns the body read until it ends or fails
+func Read(body io.Reader) (string, error) {
+	data, err := ioutil.ReadAll(body)
+	return string(data), err
+}
+
+// Respond returns the response of Elasticsearch to the request once modified for the request handlers
+func Respond(req *http.Request, status int, contentType, body string) (*http.Response, error) {
+	resp := &http.Response{
+		StatusCode:    status,
+		Header:        http.Header{"Content-Type": []string{contentType}, "Content-Length": []string{strconv.Itoa(len(body))}},
+		Body:          ioutil.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+	return resp, handlers.ModifyResponse(resp)
+}
+
+// Failure returns the message of the error, or of the error failing the body of the request, which
+// must have the code
+func Failure(err error, code int) string {
+	expectations.ExpectWithOffset(1, err).To(expectations.HaveOccurred())
+	var bodyErr *handlers.RequestBodyError
+	if errors.As(err, &bodyErr) {
+		err = bodyErr.Err
+	}
+	structured := handlers.NewStructuredError(err)
+	expectations.ExpectWithOffset(1, structured.Code).To(expectations.Equal(code))
+	return structured.Message
+}